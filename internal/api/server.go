@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"video-graphic-overlay-gstreamer/internal/channel"
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+// shutdownTimeout is how long Stop waits for requests in flight
+const shutdownTimeout = 5 * time.Second
+
+// Server is the HTTP/JSON control API of a channel manager
+type Server struct {
+	manager *channel.Manager
+	logger  logrus.FieldLogger
+	server  *http.Server
+}
+
+// NewServer creates a control API server listening on addr
+func NewServer(addr string, manager *channel.Manager, logger logrus.FieldLogger) *Server {
+	s := &Server{
+		manager: manager,
+		logger:  logger.WithField("component", "api"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/channels", s.listChannels)
+	mux.HandleFunc("GET /api/channels/{name}", s.getChannel)
+	mux.HandleFunc("GET /api/channels/{name}/config", s.getConfig)
+	mux.HandleFunc("POST /api/channels/{name}/start", s.startChannel)
+	mux.HandleFunc("POST /api/channels/{name}/stop", s.stopChannel)
+	mux.HandleFunc("POST /api/channels/{name}/restart", s.restartChannel)
+	mux.HandleFunc("GET /api/channels/{name}/overlay", s.getOverlay)
+	mux.HandleFunc("PATCH /api/channels/{name}/overlay", s.updateOverlay)
+	mux.HandleFunc("GET /api/channels/{name}/overlay/layers", s.listLayers)
+	mux.HandleFunc("GET /api/channels/{name}/overlay/layers/{layer}", s.getLayer)
+	mux.HandleFunc("PATCH /api/channels/{name}/overlay/layers/{layer}", s.updateLayer)
+
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Handler returns the HTTP handler of the API
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start starts listening and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+
+	s.logger.Infof("Control API listening on %s", listener.Addr())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Errorf("Control API stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops the server, waiting a short time for requests in flight
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// listChannels returns the status of every channel
+func (s *Server) listChannels(w http.ResponseWriter, _ *http.Request) {
+	channels := s.manager.Channels()
+	statuses := make([]channel.Status, 0, len(channels))
+	for _, ch := range channels {
+		statuses = append(statuses, ch.Status())
+	}
+	s.writeJSON(w, http.StatusOK, statuses)
+}
+
+// getChannel returns the status of one channel
+func (s *Server) getChannel(w http.ResponseWriter, r *http.Request) {
+	ch, ok := s.channel(w, r)
+	if !ok {
+		return
+	}
+	s.writeJSON(w, http.StatusOK, ch.Status())
+}
+
+// getConfig returns the effective configuration of a channel, with the keys of the
+// configuration file
+func (s *Server) getConfig(w http.ResponseWriter, r *http.Request) {
+	ch, ok := s.channel(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := yaml.Marshal(ch.Config())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	var cfg map[string]interface{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, cfg)
+}
+
+// startChannel starts a stopped or failed channel
+func (s *Server) startChannel(w http.ResponseWriter, r *http.Request) {
+	s.control(w, r, "start", s.manager.StartChannel)
+}
+
+// stopChannel stops a channel
+func (s *Server) stopChannel(w http.ResponseWriter, r *http.Request) {
+	s.control(w, r, "stop", s.manager.StopChannel)
+}
+
+// restartChannel restarts a channel with a new pipeline
+func (s *Server) restartChannel(w http.ResponseWriter, r *http.Request) {
+	s.control(w, r, "restart", s.manager.RestartChannel)
+}
+
+// control runs a lifecycle action and returns the channel status afterwards
+func (s *Server) control(w http.ResponseWriter, r *http.Request, action string, fn func(string) error) {
+	name := r.PathValue("name")
+	if err := fn(name); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.logger.Infof("Channel %s: %s requested", name, action)
+
+	ch, ok := s.channel(w, r)
+	if !ok {
+		return
+	}
+	s.writeJSON(w, http.StatusOK, ch.Status())
+}
+
+// getOverlay returns the current overlay configuration of a channel
+func (s *Server) getOverlay(w http.ResponseWriter, r *http.Request) {
+	ch, ok := s.channel(w, r)
+	if !ok {
+		return
+	}
+	s.writeOverlay(w, ch)
+}
+
+// updateOverlay changes the overlay of a channel on the live overlay elements
+func (s *Server) updateOverlay(w http.ResponseWriter, r *http.Request) {
+	s.update(w, r, "")
+}
+
+// listLayers returns the overlay layers of a channel in drawing order
+func (s *Server) listLayers(w http.ResponseWriter, r *http.Request) {
+	ch, ok := s.channel(w, r)
+	if !ok {
+		return
+	}
+	s.writeJSON(w, http.StatusOK, newOverlayResponse(ch.Config().Overlay).Layers)
+}
+
+// getLayer returns one overlay layer of a channel
+func (s *Server) getLayer(w http.ResponseWriter, r *http.Request) {
+	ch, ok := s.channel(w, r)
+	if !ok {
+		return
+	}
+	s.writeLayer(w, ch, r.PathValue("layer"))
+}
+
+// updateLayer changes one overlay layer of a channel on its live overlay element
+func (s *Server) updateLayer(w http.ResponseWriter, r *http.Request) {
+	s.update(w, r, r.PathValue("layer"))
+}
+
+// update applies the overlay update in the request body to a layer, or to the whole
+// overlay when layer is empty
+func (s *Server) update(w http.ResponseWriter, r *http.Request, layer string) {
+	ch, ok := s.channel(w, r)
+	if !ok {
+		return
+	}
+
+	var update pipeline.OverlayUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	if err := s.manager.UpdateLayer(ch.Name(), layer, update); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if layer == "" {
+		s.writeOverlay(w, ch)
+		return
+	}
+	s.writeLayer(w, ch, layer)
+}
+
+// channel looks up the channel named in the request path, it writes the error response
+// when there is none
+func (s *Server) channel(w http.ResponseWriter, r *http.Request) (*channel.Channel, bool) {
+	name := r.PathValue("name")
+	ch, ok := s.manager.Channel(name)
+	if !ok {
+		s.writeError(w, fmt.Errorf("%w %q", channel.ErrUnknownChannel, name))
+		return nil, false
+	}
+	return ch, true
+}
+
+// writeOverlay writes the overlay configuration of a channel
+func (s *Server) writeOverlay(w http.ResponseWriter, ch *channel.Channel) {
+	s.writeJSON(w, http.StatusOK, newOverlayResponse(ch.Config().Overlay))
+}
+
+// writeLayer writes one overlay layer of a channel
+func (s *Server) writeLayer(w http.ResponseWriter, ch *channel.Channel, name string) {
+	for _, layer := range newOverlayResponse(ch.Config().Overlay).Layers {
+		if layer.Name == name {
+			s.writeJSON(w, http.StatusOK, layer)
+			return
+		}
+	}
+	s.writeError(w, fmt.Errorf("%w %q", pipeline.ErrUnknownLayer, name))
+}
+
+// overlayResponse describes the overlay of a channel, or one of its layers
+type overlayResponse struct {
+	Name    string            `json:"name,omitempty"`
+	ZOrder  int               `json:"z_order"`
+	Visible bool              `json:"visible"`
+	Type    string            `json:"type"`
+	Text    string            `json:"text,omitempty"`
+	Image   string            `json:"image,omitempty"`
+	X       int               `json:"x"`
+	Y       int               `json:"y"`
+	Anchor  string            `json:"anchor,omitempty"`
+	Layers  []overlayResponse `json:"layers,omitempty"`
+}
+
+// newOverlayResponse describes an overlay with its layers in drawing order
+func newOverlayResponse(overlay config.OverlayConfig) overlayResponse {
+	response := overlayResponse{Visible: overlay.Enabled}
+	for _, layer := range overlay.LayerList() {
+		response.Layers = append(response.Layers, overlayResponse{
+			Name:    layer.Name,
+			ZOrder:  layer.ZOrder,
+			Visible: layer.Enabled,
+			Type:    layer.Type,
+			Text:    layer.Text.Content,
+			Image:   layer.Image.Path,
+			X:       layer.Position.X,
+			Y:       layer.Position.Y,
+			Anchor:  layer.Position.Anchor,
+		})
+	}
+
+	// An overlay without layers is described by its only layer
+	if len(overlay.Layers) == 0 {
+		layers := response.Layers
+		response = layers[0]
+		response.Name = ""
+		response.Layers = layers
+	}
+	return response
+}
+
+// errorResponse is the body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeError writes err with a status code matching its cause
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, channel.ErrUnknownChannel), errors.Is(err, pipeline.ErrUnknownLayer):
+		status = http.StatusNotFound
+	case errors.Is(err, pipeline.ErrInvalidOverlayUpdate):
+		status = http.StatusBadRequest
+	default:
+		s.logger.Errorf("Request failed: %v", err)
+	}
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeJSON writes v as the JSON response body
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warnf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package channel
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+// stableRunTime is how long a pipeline must run before its restart delay starts over
+const stableRunTime = 5 * time.Minute
+
+// State is the lifecycle state of a channel
+type State string
+
+const (
+	StateStopped  State = "stopped"  // Not running, either never started or stopped on request
+	StateStarting State = "starting" // Building and starting the pipeline
+	StateRunning  State = "running"  // Pipeline is running
+	StateFailed   State = "failed"   // Pipeline failed, waiting to be recreated or stopped for good
+)
+
+// Status describes a channel at one point in time
+type Status struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Since     time.Time `json:"since"`    // When the channel entered State
+	Restarts  int       `json:"restarts"` // Pipelines recreated after failures since the channel was started
+	LastError string    `json:"last_error,omitempty"`
+	// Pipeline details, PipelineState is empty while there is no pipeline
+	Running       bool   `json:"running"`
+	PipelineState string `json:"pipeline_state,omitempty"`
+}
+
+// Channel supervises the pipeline of one channel
+type Channel struct {
+	name   string
+	loaded config.ChannelConfig // Configuration as loaded, without runtime changes
+	logger logrus.FieldLogger
+
+	mutex    sync.Mutex
+	config   config.ChannelConfig
+	pipeline *pipeline.Pipeline
+	state    State
+	since    time.Time
+	restarts int
+	lastErr  error
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// newChannel creates a stopped channel
+func newChannel(cfg config.ChannelConfig, logger logrus.FieldLogger) *Channel {
+	return &Channel{
+		name:   cfg.Name,
+		loaded: cfg,
+		config: cfg,
+		logger: logger.WithField("channel", cfg.Name),
+		state:  StateStopped,
+		since:  time.Now(),
+	}
+}
+
+// Name returns the channel name
+func (c *Channel) Name() string {
+	return c.name
+}
+
+// Config returns the channel configuration, including overlay changes made at runtime
+func (c *Channel) Config() config.ChannelConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.config
+}
+
+// Pipeline returns the running pipeline, or nil if there is none
+func (c *Channel) Pipeline() *pipeline.Pipeline {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.pipeline
+}
+
+// Status returns the current status of the channel
+func (c *Channel) Status() Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status := Status{
+		Name:     c.name,
+		State:    c.state,
+		Since:    c.since,
+		Restarts: c.restarts,
+	}
+	if c.lastErr != nil {
+		status.LastError = c.lastErr.Error()
+	}
+	if c.pipeline != nil {
+		status.Running = c.pipeline.IsRunning()
+		status.PipelineState = c.pipeline.State().String()
+	}
+	return status
+}
+
+// updateLayer changes an overlay layer of the running pipeline, or the whole overlay
+// for an empty name, and keeps the change for pipelines recreated later
+func (c *Channel) updateLayer(name string, update pipeline.OverlayUpdate) error {
+	c.mutex.Lock()
+	overlay := c.config.Overlay
+	if err := update.ApplyLayer(&overlay, name); err != nil {
+		c.mutex.Unlock()
+		return err
+	}
+	c.config.Overlay = overlay
+	p := c.pipeline
+	c.mutex.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.UpdateLayer(name, update)
+}
+
+// start starts supervising the channel, it does nothing if the channel is running
+func (c *Channel) start(ctx context.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cancel != nil {
+		return
+	}
+
+	var runCtx context.Context
+	runCtx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	c.restarts = 0
+	c.lastErr = nil
+	go c.run(runCtx, c.done)
+}
+
+// stop stops the pipeline and waits for the supervisor to exit
+func (c *Channel) stop() {
+	c.mutex.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel = nil
+	c.mutex.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+
+	// The supervisor may have given up on a failed pipeline before
+	c.setState(StateStopped, nil, nil)
+}
+
+// setState records a state change
+func (c *Channel) setState(state State, p *pipeline.Pipeline, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.state = state
+	c.since = time.Now()
+	c.pipeline = p
+	if err != nil {
+		c.lastErr = err
+	}
+}
+
+// run creates and runs the pipeline until ctx is cancelled, recreating it with
+// backoff when it fails and the restart policy allows
+func (c *Channel) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	cfg := c.Config()
+	baseDelay := time.Duration(cfg.Pipeline.RestartDelay) * time.Second
+	if baseDelay <= 0 {
+		baseDelay = time.Second
+	}
+	maxDelay := time.Duration(cfg.Pipeline.MaxRestartDelay) * time.Second
+	delay := baseDelay
+
+	for {
+		c.setState(StateStarting, nil, nil)
+		c.logger.Info("Starting channel")
+
+		started := time.Now()
+		err := c.runPipeline(ctx)
+		if ctx.Err() != nil {
+			c.setState(StateStopped, nil, nil)
+			c.logger.Info("Channel stopped")
+			return
+		}
+
+		c.setState(StateFailed, nil, err)
+		if cfg.RestartPolicy == config.RestartNever {
+			c.logger.Errorf("Channel failed, restart policy is %q: %v", config.RestartNever, err)
+			return
+		}
+
+		if time.Since(started) >= stableRunTime {
+			delay = baseDelay
+		}
+		c.logger.Errorf("Channel failed, recreating pipeline in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			c.setState(StateStopped, nil, nil)
+			c.logger.Info("Channel stopped")
+			return
+		case <-time.After(delay):
+		}
+
+		c.mutex.Lock()
+		c.restarts++
+		c.mutex.Unlock()
+
+		delay *= 2
+		if maxDelay > 0 && delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// runPipeline runs one pipeline until it fails or ctx is cancelled
+func (c *Channel) runPipeline(ctx context.Context) error {
+	// The pipeline gets its own copy, overlay updates change both
+	c.mutex.Lock()
+	cfg := c.config.Config
+	c.mutex.Unlock()
+
+	p, err := pipeline.New(&cfg, c.logger)
+	if err != nil {
+		return err
+	}
+	defer p.Dispose()
+	p.SetName(c.name)
+
+	if err := p.Start(ctx); err != nil {
+		return err
+	}
+	c.setState(StateRunning, p, nil)
+
+	select {
+	case <-ctx.Done():
+	case <-p.Done():
+	}
+
+	err = p.Err()
+	if stopErr := p.Stop(); stopErr != nil {
+		c.logger.Warnf("Error stopping pipeline: %v", stopErr)
+	}
+	return err
+}
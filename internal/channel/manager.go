@@ -0,0 +1,236 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+// ErrUnknownChannel is returned for channel names that are not configured
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// Manager runs the channels of a multi-channel configuration. Channels are started,
+// stopped and reconfigured independently of each other.
+type Manager struct {
+	logger logrus.FieldLogger
+
+	// Held while channels are started, stopped or reloaded, so a channel is never
+	// started after a reload replaced it. It is taken before mutex.
+	lifecycle sync.Mutex
+
+	mutex    sync.Mutex
+	ctx      context.Context
+	channels map[string]*Channel
+	order    []string
+}
+
+// NewManager creates a channel manager
+func NewManager(logger logrus.FieldLogger) *Manager {
+	return &Manager{
+		logger:   logger,
+		channels: make(map[string]*Channel),
+	}
+}
+
+// Start starts every channel, they stop when ctx is cancelled
+func (m *Manager) Start(ctx context.Context, channels []config.ChannelConfig) error {
+	m.lifecycle.Lock()
+	defer m.lifecycle.Unlock()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ctx != nil {
+		return fmt.Errorf("channel manager is already running")
+	}
+	m.ctx = ctx
+
+	for _, cfg := range channels {
+		channel := newChannel(cfg, m.logger)
+		m.channels[cfg.Name] = channel
+		m.order = append(m.order, cfg.Name)
+		channel.start(ctx)
+	}
+
+	m.logger.Infof("Started %d channels", len(channels))
+	return nil
+}
+
+// Reload applies a new channel list. Channels whose configuration is unchanged keep
+// running along with their runtime overlay changes, changed channels are restarted,
+// removed channels are stopped.
+func (m *Manager) Reload(channels []config.ChannelConfig) error {
+	m.lifecycle.Lock()
+	defer m.lifecycle.Unlock()
+
+	m.mutex.Lock()
+	if m.ctx == nil {
+		m.mutex.Unlock()
+		return fmt.Errorf("channel manager is not running")
+	}
+	ctx := m.ctx
+
+	wanted := make(map[string]bool)
+	for _, cfg := range channels {
+		wanted[cfg.Name] = true
+	}
+	var stopping, starting []*Channel
+	for name, channel := range m.channels {
+		if !wanted[name] {
+			m.logger.Infof("Channel %s removed from configuration", name)
+			stopping = append(stopping, channel)
+			delete(m.channels, name)
+		}
+	}
+
+	order := make([]string, 0, len(channels))
+	for _, cfg := range channels {
+		order = append(order, cfg.Name)
+
+		existing, ok := m.channels[cfg.Name]
+		if ok && reflect.DeepEqual(existing.loaded, cfg) {
+			continue
+		}
+		if ok {
+			m.logger.Infof("Channel %s reconfigured", cfg.Name)
+			stopping = append(stopping, existing)
+		} else {
+			m.logger.Infof("Channel %s added to configuration", cfg.Name)
+		}
+
+		channel := newChannel(cfg, m.logger)
+		m.channels[cfg.Name] = channel
+		starting = append(starting, channel)
+	}
+	m.order = order
+	m.mutex.Unlock()
+
+	// A reconfigured channel releases its output before the new one takes it
+	stopChannels(stopping)
+	for _, channel := range starting {
+		channel.start(ctx)
+	}
+	return nil
+}
+
+// Stop stops every channel
+func (m *Manager) Stop() {
+	m.lifecycle.Lock()
+	defer m.lifecycle.Unlock()
+
+	m.mutex.Lock()
+	channels := make([]*Channel, 0, len(m.channels))
+	for _, channel := range m.channels {
+		channels = append(channels, channel)
+	}
+	m.mutex.Unlock()
+
+	stopChannels(channels)
+	m.logger.Info("All channels stopped")
+}
+
+// stopChannels stops channels in parallel, it must be called without the manager
+// mutex as stopping waits for the pipelines to shut down
+func stopChannels(channels []*Channel) {
+	var wg sync.WaitGroup
+	for _, channel := range channels {
+		wg.Add(1)
+		go func(channel *Channel) {
+			defer wg.Done()
+			channel.stop()
+		}(channel)
+	}
+	wg.Wait()
+}
+
+// Channel returns the channel with the given name
+func (m *Manager) Channel(name string) (*Channel, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	channel, ok := m.channels[name]
+	return channel, ok
+}
+
+// Channels returns the channels in configuration order
+func (m *Manager) Channels() []*Channel {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	channels := make([]*Channel, 0, len(m.order))
+	for _, name := range m.order {
+		channels = append(channels, m.channels[name])
+	}
+	return channels
+}
+
+// StartChannel starts a stopped or failed channel
+func (m *Manager) StartChannel(name string) error {
+	m.lifecycle.Lock()
+	defer m.lifecycle.Unlock()
+
+	channel, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	// A channel that failed for good still has its supervisor state
+	channel.stop()
+	channel.start(m.ctx)
+	return nil
+}
+
+// StopChannel stops a channel, it stays stopped until started again
+func (m *Manager) StopChannel(name string) error {
+	m.lifecycle.Lock()
+	defer m.lifecycle.Unlock()
+
+	channel, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	channel.stop()
+	return nil
+}
+
+// RestartChannel stops a channel and starts it with a new pipeline
+func (m *Manager) RestartChannel(name string) error {
+	return m.StartChannel(name)
+}
+
+// UpdateOverlay changes the overlay of a channel at runtime
+func (m *Manager) UpdateOverlay(name string, update pipeline.OverlayUpdate) error {
+	channel, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	return channel.updateLayer("", update)
+}
+
+// UpdateLayer changes one overlay layer of a channel at runtime
+func (m *Manager) UpdateLayer(name, layer string, update pipeline.OverlayUpdate) error {
+	channel, err := m.lookup(name)
+	if err != nil {
+		return err
+	}
+	return channel.updateLayer(layer, update)
+}
+
+// lookup returns a channel of a running manager
+func (m *Manager) lookup(name string) (*Channel, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ctx == nil {
+		return nil, fmt.Errorf("channel manager is not running")
+	}
+	channel, ok := m.channels[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownChannel, name)
+	}
+	return channel, nil
+}
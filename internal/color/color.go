@@ -0,0 +1,172 @@
+package color
+
+import (
+	"fmt"
+	imagecolor "image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Color is an 8-bit RGB color with alpha, A is 255 for opaque colors
+type Color struct {
+	R, G, B, A uint8
+}
+
+// Transparent is the fully transparent color
+var Transparent = Color{}
+
+// Parse parses a color given as
+//
+//	a CSS color name            white, steelblue, transparent
+//	#RGB or #RRGGBB             #fff, #ff8800 (a 0x prefix or none works too)
+//	#AARRGGBB                   #b3000000, alpha first like GStreamer
+//	rgb(r, g, b)                channels 0-255 or percentages
+//	rgba(r, g, b, a)            alpha 0-1 or a percentage
+func Parse(s string) (Color, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	if value == "" {
+		return Color{}, fmt.Errorf("empty color")
+	}
+
+	if named, ok := names[value]; ok {
+		return named, nil
+	}
+	if strings.HasPrefix(value, "rgb") {
+		return parseFunction(value)
+	}
+
+	hex := strings.TrimPrefix(strings.TrimPrefix(value, "#"), "0x")
+	c, err := parseHex(hex)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return c, nil
+}
+
+// ARGB returns the color as 0xAARRGGBB, the layout of GStreamer color properties
+func (c Color) ARGB() uint32 {
+	return uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+// Hex returns the color as RRGGBB without alpha
+func (c Color) Hex() string {
+	return fmt.Sprintf("%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// Opacity returns the alpha as 0-1
+func (c Color) Opacity() float64 {
+	return float64(c.A) / 255
+}
+
+// IsTransparent tells whether the color is invisible
+func (c Color) IsTransparent() bool {
+	return c.A == 0
+}
+
+// RGBA implements the image/color Color interface, so colors can be drawn with the
+// image packages
+func (c Color) RGBA() (r, g, b, a uint32) {
+	return imagecolor.NRGBA{R: c.R, G: c.G, B: c.B, A: c.A}.RGBA()
+}
+
+// String returns the color as #AARRGGBB
+func (c Color) String() string {
+	return fmt.Sprintf("#%08X", c.ARGB())
+}
+
+// parseHex parses RGB, RRGGBB and AARRGGBB
+func parseHex(hex string) (Color, error) {
+	switch len(hex) {
+	case 3, 6, 8:
+	default:
+		return Color{}, fmt.Errorf("expected 3, 6 or 8 hex digits")
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("invalid hex digits")
+	}
+
+	switch len(hex) {
+	case 3:
+		// Each digit is repeated, #f80 is #ff8800
+		r, g, b := uint8(value>>8&0xF), uint8(value>>4&0xF), uint8(value&0xF)
+		return Color{R: r * 0x11, G: g * 0x11, B: b * 0x11, A: 255}, nil
+	case 6:
+		return Color{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}, nil
+	default:
+		return Color{A: uint8(value >> 24), R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value)}, nil
+	}
+}
+
+// parseFunction parses rgb() and rgba()
+func parseFunction(value string) (Color, error) {
+	open := strings.IndexByte(value, '(')
+	if open < 0 || !strings.HasSuffix(value, ")") {
+		return Color{}, fmt.Errorf("invalid color %q: expected rgb(r, g, b) or rgba(r, g, b, a)", value)
+	}
+	name := strings.TrimSpace(value[:open])
+	args := strings.Split(value[open+1:len(value)-1], ",")
+
+	expected := 3
+	if name == "rgba" {
+		expected = 4
+	} else if name != "rgb" {
+		return Color{}, fmt.Errorf("invalid color %q: unknown function %s", value, name)
+	}
+	if len(args) != expected {
+		return Color{}, fmt.Errorf("invalid color %q: %s takes %d values, got %d", value, name, expected, len(args))
+	}
+
+	var channels [3]uint8
+	for i := range channels {
+		channel, err := parseChannel(args[i])
+		if err != nil {
+			return Color{}, fmt.Errorf("invalid color %q: %w", value, err)
+		}
+		channels[i] = channel
+	}
+	c := Color{R: channels[0], G: channels[1], B: channels[2], A: 255}
+
+	if len(args) == 4 {
+		alpha, err := parseAlpha(args[3])
+		if err != nil {
+			return Color{}, fmt.Errorf("invalid color %q: %w", value, err)
+		}
+		c.A = alpha
+	}
+	return c, nil
+}
+
+// parseChannel parses a color channel of 0-255 or 0%-100%
+func parseChannel(arg string) (uint8, error) {
+	arg = strings.TrimSpace(arg)
+	if percent, ok := strings.CutSuffix(arg, "%"); ok {
+		value, err := strconv.ParseFloat(percent, 64)
+		if err != nil || value < 0 || value > 100 {
+			return 0, fmt.Errorf("channel %q out of 0%%-100%%", arg)
+		}
+		return uint8(math.Round(value * 255 / 100)), nil
+	}
+
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || value < 0 || value > 255 {
+		return 0, fmt.Errorf("channel %q out of 0-255", arg)
+	}
+	return uint8(math.Round(value)), nil
+}
+
+// parseAlpha parses an alpha of 0-1 or 0%-100%
+func parseAlpha(arg string) (uint8, error) {
+	arg = strings.TrimSpace(arg)
+	number, scale := arg, 1.0
+	if percent, ok := strings.CutSuffix(arg, "%"); ok {
+		number, scale = percent, 100
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 || value > scale {
+		return 0, fmt.Errorf("alpha %q out of 0-1 or 0%%-100%%", arg)
+	}
+	return uint8(math.Round(value / scale * 255)), nil
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,6 +15,25 @@ type Config struct {
 	Output   OutputConfig   `yaml:"output"`
 	Overlay  OverlayConfig  `yaml:"overlay"`
 	Pipeline PipelineConfig `yaml:"pipeline"`
+	API      APIConfig      `yaml:"api"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	// Channels run several pipelines from one configuration, the settings above are
+	// their defaults
+	Channels []ChannelConfig `yaml:"channels,omitempty"`
+}
+
+// Channel restart policies
+const (
+	RestartOnFailure = "on-failure" // Recreate the pipeline when it fails for good
+	RestartNever     = "never"      // Leave a failed channel stopped
+)
+
+// ChannelConfig represents one channel of a multi-channel configuration. Its sections
+// override the top-level settings field by field.
+type ChannelConfig struct {
+	Name          string `yaml:"name"`
+	RestartPolicy string `yaml:"restart_policy"` // "on-failure" (default) or "never"
+	Config        `yaml:",inline"`
 }
 
 // InputConfig represents HLS input configuration
@@ -27,6 +48,28 @@ type InputConfig struct {
 	MinBitrate          int    `yaml:"min_bitrate"`           // Minimum bitrate to select (0 = auto)
 	ParseMasterPlaylist bool   `yaml:"parse_master_playlist"` // Enable master playlist parsing
 	StreamSelection     string `yaml:"stream_selection"`      // "highest", "lowest", "bandwidth", "auto"
+	// Variant filters, zero values are not enforced
+	MaxWidth      int      `yaml:"max_width"`      // Maximum variant width
+	MaxHeight     int      `yaml:"max_height"`     // Maximum variant height
+	MaxFrameRate  float64  `yaml:"max_frame_rate"` // Maximum variant frame rate
+	AllowedCodecs []string `yaml:"allowed_codecs"` // CODECS allow-list, e.g. ["avc1", "mp4a"]
+	// Automatic variant switching ("auto" stream selection)
+	AdaptiveHoldTime     int     `yaml:"adaptive_hold_time"`     // Minimum seconds between switching up
+	AdaptiveSafetyFactor float64 `yaml:"adaptive_safety_factor"` // Share of measured throughput a variant may use
+	// Alternate rendition selection (EXT-X-MEDIA)
+	AudioLanguage    string `yaml:"audio_language"`    // Preferred audio language, e.g. "en" or "deu"
+	AudioName        string `yaml:"audio_name"`        // Preferred audio rendition NAME, takes precedence over language
+	SubtitleLanguage string `yaml:"subtitle_language"` // Preferred subtitle language
+	SubtitleName     string `yaml:"subtitle_name"`     // Preferred subtitle rendition NAME
+	// Input failover
+	BackupURLs      []string `yaml:"backup_urls"`      // Inputs tried in order when the primary fails
+	Slate           string   `yaml:"slate"`            // Image or video file shown when every input has failed
+	FailoverTimeout int      `yaml:"failover_timeout"` // Seconds without video before failing over
+	FailbackDelay   int      `yaml:"failback_delay"`   // Seconds a higher priority input must stay healthy before failing back
+	// Live media playlist inspection
+	InspectPlaylist bool `yaml:"inspect_playlist"` // Poll the media playlist and report origin problems
+	// SCTE-35 ad marker detection
+	CueSource string `yaml:"cue_source"` // "playlist", "stream", "both" or empty to disable
 }
 
 // OutputConfig represents UDP output configuration
@@ -37,32 +80,123 @@ type OutputConfig struct {
 	VideoCodec string `yaml:"video_codec"`
 	AudioCodec string `yaml:"audio_codec"`
 	Format     string `yaml:"format"`
+	SCTE35PID  int    `yaml:"scte35_pid"` // PID for re-emitted SCTE-35 sections in MPEG-TS output (0 = disabled)
+	// Closed captions of the input carried into the output
+	Captions CaptionsConfig `yaml:"captions"`
+}
+
+// CaptionsConfig represents how CEA-608/708 closed captions of the input reach the output
+type CaptionsConfig struct {
+	Passthrough bool `yaml:"passthrough"` // Re-insert the captions as CEA-708 SEI of the H.264 output
+	BurnIn      bool `yaml:"burn_in"`     // Also draw the CEA-608 captions into the video
 }
 
 // OverlayConfig represents graphic overlay configuration
 type OverlayConfig struct {
-	Enabled  bool           `yaml:"enabled"`
-	Type     string         `yaml:"type"` // "text", "image", "cairo"
-	Text     TextOverlay    `yaml:"text"`
-	Image    ImageOverlay   `yaml:"image"`
-	Cairo    CairoOverlay   `yaml:"cairo"`
-	Position PositionConfig `yaml:"position"`
+	Enabled  bool            `yaml:"enabled"`
+	Type     string          `yaml:"type"` // "text", "image", "graphics", "ticker", "subtitles", "cairo"
+	Text     TextOverlay     `yaml:"text"`
+	Image    ImageOverlay    `yaml:"image"`
+	Cairo    CairoOverlay    `yaml:"cairo"`
+	Graphics GraphicsOverlay `yaml:"graphics"`
+	Ticker   TickerOverlay   `yaml:"ticker"` // Items of a ticker, drawn with the font and colors of text
+	Position PositionConfig  `yaml:"position"`
+	Schedule ScheduleConfig  `yaml:"schedule"`
+	// Subtitles burnt into the video, drawn with the font and colors of text
+	Subtitles SubtitlesOverlay `yaml:"subtitles"`
+	// Transitions animate the overlay when it is shown and hidden
+	Transitions TransitionsConfig `yaml:"transitions"`
+	// Layers show several overlays at once, the settings above are then unused
+	// except for enabled, which shows or hides all layers
+	Layers []LayerConfig `yaml:"layers,omitempty"`
+}
+
+// MainLayer is the name of the only layer of an overlay without layers
+const MainLayer = "main"
+
+// LayerConfig represents one overlay of a layered overlay. Unset fields take the
+// overlay defaults, not the settings of the enclosing overlay.
+type LayerConfig struct {
+	Name          string `yaml:"name"`
+	ZOrder        int    `yaml:"z_order"` // Layers with a higher z_order are drawn on top
+	OverlayConfig `yaml:",inline"`
+}
+
+// UnmarshalYAML decodes a layer on top of the overlay defaults
+func (l *LayerConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain LayerConfig
+	layer := plain{OverlayConfig: defaultOverlay()}
+	if err := node.Decode(&layer); err != nil {
+		return err
+	}
+	*l = LayerConfig(layer)
+	return nil
+}
+
+// LayerList returns the layers in drawing order, bottom first. An overlay without
+// layers is a single layer named MainLayer. Layers are only enabled when the overlay
+// is.
+func (o OverlayConfig) LayerList() []LayerConfig {
+	if len(o.Layers) == 0 {
+		return []LayerConfig{{Name: MainLayer, OverlayConfig: o}}
+	}
+
+	layers := make([]LayerConfig, len(o.Layers))
+	copy(layers, o.Layers)
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].ZOrder < layers[j].ZOrder })
+	for i := range layers {
+		layers[i].Enabled = layers[i].Enabled && o.Enabled
+	}
+	return layers
+}
+
+// validateLayers checks that layers have unique names and no layers of their own
+func (o OverlayConfig) validateLayers() error {
+	names := make(map[string]bool)
+	for i, layer := range o.Layers {
+		switch {
+		case layer.Name == "":
+			return fmt.Errorf("overlay layer %d has no name", i+1)
+		case names[layer.Name]:
+			return fmt.Errorf("overlay layer %q is defined more than once", layer.Name)
+		case len(layer.Layers) > 0:
+			return fmt.Errorf("overlay layer %q cannot define layers", layer.Name)
+		}
+		names[layer.Name] = true
+	}
+	return nil
 }
 
 // TextOverlay represents text overlay configuration
 type TextOverlay struct {
-	Content    string `yaml:"content"`
+	Content    string `yaml:"content"` // Go text/template, e.g. "{{.timestamp}}" or "{{format \"15:04\" now}}"
 	FontSize   int    `yaml:"font_size"`
 	FontFamily string `yaml:"font_family"`
-	Color      string `yaml:"color"`
-	Background string `yaml:"background"`
+	Color      string `yaml:"color"`      // CSS name, #RGB, #RRGGBB, #AARRGGBB, rgb() or rgba()
+	Background string `yaml:"background"` // Color of a box behind the text, its alpha is the opacity. Empty for none
+	Outline    string `yaml:"outline"`    // Outline color, "transparent" for none and empty for the default black
+	// Pixels between the text and the left and right edges of the background box
+	BackgroundPadding int `yaml:"background_padding"`
+	// Template rendering
+	Timezone  string `yaml:"timezone"`   // IANA time zone for template times, empty for local time
+	RefreshMs int    `yaml:"refresh_ms"` // Milliseconds between template renders
+	PerFrame  bool   `yaml:"per_frame"`  // Render the template for every frame instead, needed for {{pts}}
 }
 
 // ImageOverlay represents image overlay configuration
 type ImageOverlay struct {
-	Path  string  `yaml:"path"`
-	Scale float64 `yaml:"scale"`
-	Alpha float64 `yaml:"alpha"`
+	// Still image, animated GIF or APNG, or a PNG sequence given as a directory, a glob
+	// like "logo_*.png" or a pattern like "logo_%04d.png"
+	Path string `yaml:"path"`
+	// Size of the image as drawn, the first one set applies and the aspect ratio is kept.
+	// Without any the image is drawn at its native size.
+	WidthPercent float64 `yaml:"width_percent"` // Percent of the video width, follows resolution changes
+	Width        int     `yaml:"width"`         // Pixels, fitted inside width x height when both are set
+	Height       int     `yaml:"height"`
+	Scale        float64 `yaml:"scale"` // Factor of the native size
+	Alpha        float64 `yaml:"alpha"`
+	Loop         bool    `yaml:"loop"`       // Play animations in a loop, or once and hold the last frame
+	FrameRate    float64 `yaml:"frame_rate"` // Frames per second of PNG sequences
 }
 
 // CairoOverlay represents cairo overlay configuration
@@ -72,11 +206,73 @@ type CairoOverlay struct {
 	Height int    `yaml:"height"`
 }
 
+// GraphicsOverlay represents an overlay drawn in Go by a registered renderer
+type GraphicsOverlay struct {
+	Renderer  string            `yaml:"renderer"`   // Name of the renderer, "box" is built in
+	RefreshMs int               `yaml:"refresh_ms"` // Milliseconds between renders, unless the renderer reports changes itself
+	Width     int               `yaml:"width"`      // Size of the graphic, in the units of the position
+	Height    int               `yaml:"height"`
+	Color     string            `yaml:"color"`
+	Options   map[string]string `yaml:"options"` // Renderer specific settings
+}
+
+// TickerOverlay represents a crawl of text items scrolling right to left across a bar
+type TickerOverlay struct {
+	Source    string            `yaml:"source"`     // Where items come from: "static" (default), "file", "http" or a registered source
+	Items     []string          `yaml:"items"`      // Items of the static source
+	Path      string            `yaml:"path"`       // File of the file source, one item per line
+	URL       string            `yaml:"url"`        // JSON feed of the http source
+	RefreshMs int               `yaml:"refresh_ms"` // Milliseconds between reloads of file and http items
+	Speed     int               `yaml:"speed"`      // Pixels per second
+	Separator string            `yaml:"separator"`  // Drawn between items
+	BarHeight int               `yaml:"bar_height"` // Height of the bar in pixels
+	BarColor  string            `yaml:"bar_color"`  // Color of the bar, "transparent" for none
+	Options   map[string]string `yaml:"options"`    // Source specific settings
+}
+
+// SubtitlesOverlay represents subtitles burnt into the video. Cues of the rendition are
+// shown by the timestamps of the video, cues of a file count from its first frame.
+type SubtitlesOverlay struct {
+	Source   string `yaml:"source"`    // "rendition" for the subtitle track of the input (default) or "file"
+	Path     string `yaml:"path"`      // SRT or WebVTT file of the file source
+	OffsetMs int    `yaml:"offset_ms"` // Shows cues later, or earlier when negative
+}
+
 // PositionConfig represents overlay position
 type PositionConfig struct {
-	X      int    `yaml:"x"`
-	Y      int    `yaml:"y"`
-	Anchor string `yaml:"anchor"` // "top-left", "top-right", "bottom-left", "bottom-right", "center"
+	X        int    `yaml:"x"`         // Offset from the anchored edge, or right of the center
+	Y        int    `yaml:"y"`         // Offset from the anchored edge, or below the center
+	Anchor   string `yaml:"anchor"`    // "top-left", "top-center", "top-right", "center-left", "center", "center-right", "bottom-left", "bottom-center", "bottom-right"
+	Units    string `yaml:"units"`     // "pixels" (default) or "percent" of the video width and height
+	SafeArea string `yaml:"safe_area"` // Keep the overlay inside the "action" or "title" safe area, empty for none
+}
+
+// ScheduleConfig represents when an overlay is shown, without windows it is always shown
+type ScheduleConfig struct {
+	Timezone string           `yaml:"timezone"` // IANA time zone of daily windows and absolute times without offset, empty for local time
+	Windows  []ScheduleWindow `yaml:"windows"`  // The overlay is shown while any window is open
+}
+
+// ScheduleWindow represents a time span an overlay is shown. Both ends take the same form.
+type ScheduleWindow struct {
+	From  string   `yaml:"from"`  // "2024-06-01T18:00:00Z" or "2024-06-01 18:00" once, "18:00" daily, or "10m" after the pipeline started
+	Until string   `yaml:"until"` // Empty for open-ended, or the end of the day for daily windows
+	Days  []string `yaml:"days"`  // Weekdays daily windows start on, e.g. ["mon", "fri"], empty for every day
+}
+
+// TransitionsConfig represents how an overlay appears and disappears, without a type
+// it does so instantly
+type TransitionsConfig struct {
+	In  TransitionConfig `yaml:"in"`
+	Out TransitionConfig `yaml:"out"`
+}
+
+// TransitionConfig represents one animated transition of a text or image overlay
+type TransitionConfig struct {
+	Type       string `yaml:"type"`        // "fade", "slide" or "wipe", empty for none
+	DurationMs int    `yaml:"duration_ms"` // Length of the animation in pipeline running time
+	Easing     string `yaml:"easing"`      // "linear", "ease-in", "ease-out" or "ease-in-out" (default)
+	Edge       string `yaml:"edge"`        // Edge slides come from or leave to and wipes start at: "left" (default), "right", "top" or "bottom"
 }
 
 // PipelineConfig represents GStreamer pipeline configuration
@@ -85,6 +281,24 @@ type PipelineConfig struct {
 	LatencyMs     int  `yaml:"latency_ms"`
 	SyncOnClock   bool `yaml:"sync_on_clock"`
 	DropOnLatency bool `yaml:"drop_on_latency"`
+	// Automatic recovery
+	AutoRestart     bool `yaml:"auto_restart"`      // Rebuild and restart the pipeline after errors and stalls
+	MaxRestarts     int  `yaml:"max_restarts"`      // Consecutive restarts before giving up (0 = unlimited)
+	RestartDelay    int  `yaml:"restart_delay"`     // Seconds before the first restart, doubled for each consecutive one
+	MaxRestartDelay int  `yaml:"max_restart_delay"` // Upper bound for the restart delay in seconds
+	StallTimeout    int  `yaml:"stall_timeout"`     // Seconds without output data before restarting
+}
+
+// APIConfig represents the HTTP control API configuration
+type APIConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // Address to listen on, e.g. ":8080" or "127.0.0.1:8080"
+}
+
+// MetricsConfig represents the Prometheus metrics endpoint configuration
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // Address serving /metrics
 }
 
 // Load loads configuration from a YAML file
@@ -92,12 +306,16 @@ func Load(path string) (*Config, error) {
 	// Set default configuration
 	cfg := &Config{
 		Input: InputConfig{
-			BufferSize:          1024 * 1024, // 1MB
-			ConnectionRetry:     3,
-			Timeout:             30,
-			SourceType:          "playbin3", // Default to playbin3 implementation
-			ParseMasterPlaylist: true,       // Enable master playlist parsing by default
-			StreamSelection:     "highest",  // Select highest quality by default
+			BufferSize:           1024 * 1024, // 1MB
+			ConnectionRetry:      3,
+			Timeout:              30,
+			SourceType:           "playbin3", // Default to playbin3 implementation
+			ParseMasterPlaylist:  true,       // Enable master playlist parsing by default
+			StreamSelection:      "highest",  // Select highest quality by default
+			AdaptiveHoldTime:     10,
+			AdaptiveSafetyFactor: 0.8,
+			FailoverTimeout:      3,
+			FailbackDelay:        30,
 		},
 		Output: OutputConfig{
 			Host:       "127.0.0.1",
@@ -106,28 +324,28 @@ func Load(path string) (*Config, error) {
 			VideoCodec: "h264",
 			AudioCodec: "aac",
 			Format:     "mpegts",
-		},
-		Overlay: OverlayConfig{
-			Enabled: true,
-			Type:    "text",
-			Text: TextOverlay{
-				Content:    "Live Stream",
-				FontSize:   24,
-				FontFamily: "Arial",
-				Color:      "white",
-				Background: "black",
-			},
-			Position: PositionConfig{
-				X:      10,
-				Y:      10,
-				Anchor: "top-left",
+			SCTE35PID:  500,
+			Captions: CaptionsConfig{
+				Passthrough: true,
 			},
 		},
+		Overlay: defaultOverlay(),
 		Pipeline: PipelineConfig{
-			BufferTime:    200,
-			LatencyMs:     100,
-			SyncOnClock:   true,
-			DropOnLatency: true,
+			BufferTime:      200,
+			LatencyMs:       100,
+			SyncOnClock:     true,
+			DropOnLatency:   true,
+			AutoRestart:     true,
+			MaxRestarts:     10,
+			RestartDelay:    2,
+			MaxRestartDelay: 60,
+			StallTimeout:    30,
+		},
+		API: APIConfig{
+			Listen: "127.0.0.1:8080",
+		},
+		Metrics: MetricsConfig{
+			Listen: ":9464",
 		},
 	}
 
@@ -141,11 +359,136 @@ func Load(path string) (*Config, error) {
 		if err := yaml.Unmarshal(data, cfg); err != nil {
 			return nil, fmt.Errorf("failed to parse config file: %w", err)
 		}
+
+		if err := cfg.loadChannels(data); err != nil {
+			return nil, err
+		}
+
+		if err := cfg.Overlay.validateLayers(); err != nil {
+			return nil, err
+		}
+		for _, channel := range cfg.Channels {
+			if err := channel.Overlay.validateLayers(); err != nil {
+				return nil, fmt.Errorf("channel %q: %w", channel.Name, err)
+			}
+		}
 	}
 
 	return cfg, nil
 }
 
+// defaultOverlay returns the default overlay settings
+func defaultOverlay() OverlayConfig {
+	return OverlayConfig{
+		Enabled: true,
+		Type:    "text",
+		Text: TextOverlay{
+			Content:           "Live Stream",
+			FontSize:          24,
+			FontFamily:        "Arial",
+			Color:             "white",
+			BackgroundPadding: 6,
+			RefreshMs:         1000,
+		},
+		Image: ImageOverlay{
+			Loop:      true,
+			FrameRate: 25,
+		},
+		Graphics: GraphicsOverlay{
+			Renderer:  "box",
+			RefreshMs: 1000,
+		},
+		Ticker: TickerOverlay{
+			Source:    "static",
+			RefreshMs: 60000,
+			Speed:     120,
+			Separator: " • ",
+			BarHeight: 48,
+			BarColor:  "rgba(0, 0, 0, 0.7)",
+		},
+		Subtitles: SubtitlesOverlay{
+			Source: "rendition",
+		},
+		Position: PositionConfig{
+			X:      10,
+			Y:      10,
+			Anchor: "top-left",
+		},
+	}
+}
+
+// loadChannels decodes every channel on top of a copy of the top-level settings,
+// so a channel only lists what differs from the defaults
+func (c *Config) loadChannels(data []byte) error {
+	var raw struct {
+		Channels []yaml.Node `yaml:"channels"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("failed to parse channels: %w", err)
+	}
+
+	c.Channels = nil
+	defaults := c.clone()
+	names := make(map[string]bool)
+	var channels []ChannelConfig
+	for i, node := range raw.Channels {
+		channel := ChannelConfig{RestartPolicy: RestartOnFailure, Config: defaults.clone()}
+		if err := node.Decode(&channel); err != nil {
+			return fmt.Errorf("failed to parse channel %d: %w", i+1, err)
+		}
+
+		switch {
+		case channel.Name == "":
+			return fmt.Errorf("channel %d has no name", i+1)
+		case names[channel.Name]:
+			return fmt.Errorf("channel %q is defined more than once", channel.Name)
+		case len(channel.Channels) > 0:
+			return fmt.Errorf("channel %q cannot define channels", channel.Name)
+		case channel.API != defaults.API:
+			return fmt.Errorf("channel %q cannot configure the api", channel.Name)
+		case channel.Metrics != defaults.Metrics:
+			return fmt.Errorf("channel %q cannot configure metrics", channel.Name)
+		case channel.RestartPolicy != RestartOnFailure && channel.RestartPolicy != RestartNever:
+			return fmt.Errorf("channel %q has unknown restart policy %q", channel.Name, channel.RestartPolicy)
+		}
+		names[channel.Name] = true
+		channels = append(channels, channel)
+	}
+	c.Channels = channels
+
+	return nil
+}
+
+// clone returns a deep copy of the settings without the channels
+func (c *Config) clone() Config {
+	clone := *c
+	clone.Channels = nil
+	clone.Input.BackupURLs = append([]string(nil), c.Input.BackupURLs...)
+	clone.Input.AllowedCodecs = append([]string(nil), c.Input.AllowedCodecs...)
+	clone.Overlay = c.Overlay.clone()
+	return clone
+}
+
+// clone returns a deep copy of the overlay. Maps must not be shared, yaml decodes into
+// a map it finds in place.
+func (o OverlayConfig) clone() OverlayConfig {
+	clone := o
+	clone.Graphics.Options = maps.Clone(o.Graphics.Options)
+	clone.Ticker.Options = maps.Clone(o.Ticker.Options)
+	clone.Ticker.Items = append([]string(nil), o.Ticker.Items...)
+	clone.Schedule.Windows = nil
+	for _, window := range o.Schedule.Windows {
+		window.Days = append([]string(nil), window.Days...)
+		clone.Schedule.Windows = append(clone.Schedule.Windows, window)
+	}
+	clone.Layers = nil
+	for _, layer := range o.Layers {
+		layer.OverlayConfig = layer.OverlayConfig.clone()
+		clone.Layers = append(clone.Layers, layer)
+	}
+	return clone
+}
+
 // Save saves configuration to a YAML file
 func (c *Config) Save(path string) error {
 	data, err := yaml.Marshal(c)
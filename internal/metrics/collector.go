@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"video-graphic-overlay-gstreamer/internal/channel"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+const namespace = "video_overlay"
+
+// Collector exports the state and pipeline counters of every channel. Values are read
+// from the channels when scraped.
+type Collector struct {
+	manager *channel.Manager
+
+	channels         *prometheus.Desc
+	up               *prometheus.Desc
+	channelRestarts  *prometheus.Desc
+	pipelineRestarts *prometheus.Desc
+	framesIn         *prometheus.Desc
+	framesOut        *prometheus.Desc
+	framesDropped    *prometheus.Desc
+	bytesSent        *prometheus.Desc
+	encoderBytes     *prometheus.Desc
+	encoderBitrate   *prometheus.Desc
+	queueBuffers     *prometheus.Desc
+	queueBytes       *prometheus.Desc
+	queueTime        *prometheus.Desc
+	busErrors        *prometheus.Desc
+	variantBandwidth *prometheus.Desc
+	variantWidth     *prometheus.Desc
+	variantHeight    *prometheus.Desc
+}
+
+// NewCollector creates a collector for the channels of manager
+func NewCollector(manager *channel.Manager) *Collector {
+	channelLabels := []string{"channel"}
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help,
+			append(channelLabels, labels...), nil)
+	}
+
+	return &Collector{
+		manager: manager,
+		channels: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "channels"),
+			"Number of configured channels.", nil, nil),
+		up:               desc("channel_up", "Whether the channel pipeline is running (1) or not (0)."),
+		channelRestarts:  desc("channel_restarts_total", "Pipelines recreated after failures since the channel was started."),
+		pipelineRestarts: desc("pipeline_restarts_total", "Automatic restarts of the current pipeline after errors and stalls."),
+		framesIn:         desc("frames_in_total", "Video frames entering the processing chain."),
+		framesOut:        desc("frames_out_total", "Video frames leaving the encoder."),
+		framesDropped:    desc("frames_dropped_total", "Frames dropped by elements, as reported by QoS messages."),
+		bytesSent:        desc("output_bytes_total", "Bytes handed to udpsink."),
+		encoderBytes:     desc("encoder_output_bytes_total", "Bytes produced by the video encoder."),
+		encoderBitrate:   desc("encoder_output_bitrate_bps", "Video encoder output bitrate in bits per second."),
+		queueBuffers:     desc("queue_level_buffers", "Buffers waiting in the queue after the encoder.", "queue"),
+		queueBytes:       desc("queue_level_bytes", "Bytes waiting in the queue after the encoder.", "queue"),
+		queueTime:        desc("queue_level_seconds", "Duration of data waiting in the queue after the encoder.", "queue"),
+		busErrors:        desc("bus_errors_total", "Errors posted on the pipeline bus by error type.", "type"),
+		variantBandwidth: desc("variant_bandwidth_bps", "BANDWIDTH of the HLS variant being played."),
+		variantWidth:     desc("variant_width_pixels", "Width of the HLS variant being played."),
+		variantHeight:    desc("variant_height_pixels", "Height of the HLS variant being played."),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		c.channels, c.up, c.channelRestarts, c.pipelineRestarts,
+		c.framesIn, c.framesOut, c.framesDropped, c.bytesSent, c.encoderBytes, c.encoderBitrate,
+		c.queueBuffers, c.queueBytes, c.queueTime, c.busErrors,
+		c.variantBandwidth, c.variantWidth, c.variantHeight,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	channels := c.manager.Channels()
+	ch <- prometheus.MustNewConstMetric(c.channels, prometheus.GaugeValue, float64(len(channels)))
+
+	for _, channel := range channels {
+		c.collectChannel(ch, channel)
+	}
+}
+
+// collectChannel sends the metrics of one channel
+func (c *Collector) collectChannel(ch chan<- prometheus.Metric, channel *channel.Channel) {
+	name := channel.Name()
+	status := channel.Status()
+
+	up := 0.0
+	if status.Running {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, name)
+	ch <- prometheus.MustNewConstMetric(c.channelRestarts, prometheus.CounterValue, float64(status.Restarts), name)
+
+	p := channel.Pipeline()
+	if p == nil {
+		return
+	}
+	stats := p.Stats()
+
+	counter := func(desc *prometheus.Desc, value uint64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), append([]string{name}, labels...)...)
+	}
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, append([]string{name}, labels...)...)
+	}
+
+	counter(c.pipelineRestarts, stats.Restarts)
+	counter(c.framesIn, stats.FramesIn)
+	counter(c.framesOut, stats.FramesOut)
+	counter(c.framesDropped, stats.FramesDropped)
+	counter(c.bytesSent, stats.BytesSent)
+	counter(c.encoderBytes, stats.EncoderBytes)
+	gauge(c.encoderBitrate, stats.EncoderBitrate)
+
+	for queue, level := range map[string]pipeline.QueueLevel{"video": stats.VideoQueue, "audio": stats.AudioQueue} {
+		gauge(c.queueBuffers, float64(level.Buffers), queue)
+		gauge(c.queueBytes, float64(level.Bytes), queue)
+		gauge(c.queueTime, level.Time.Seconds(), queue)
+	}
+
+	// Every type is exported so rates work before the first error
+	for errorType := pipeline.ErrorTypeUnknown; errorType <= pipeline.ErrorTypeConfiguration; errorType++ {
+		counter(c.busErrors, stats.Errors[errorType], strings.ToLower(errorType.String()))
+	}
+
+	if stats.VariantBandwidth > 0 {
+		gauge(c.variantBandwidth, float64(stats.VariantBandwidth))
+		gauge(c.variantWidth, float64(stats.VariantWidth))
+		gauge(c.variantHeight, float64(stats.VariantHeight))
+	}
+}
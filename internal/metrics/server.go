@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"video-graphic-overlay-gstreamer/internal/channel"
+)
+
+// shutdownTimeout is how long Stop waits for scrapes in flight
+const shutdownTimeout = 5 * time.Second
+
+// Server serves the metrics of a channel manager on /metrics
+type Server struct {
+	logger logrus.FieldLogger
+	server *http.Server
+}
+
+// NewServer creates a metrics server listening on addr. Besides the channel metrics
+// it exports the Go runtime and process metrics.
+func NewServer(addr string, manager *channel.Manager, logger logrus.FieldLogger) *Server {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		NewCollector(manager),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	return &Server{
+		logger: logger.WithField("component", "metrics"),
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Handler returns the HTTP handler serving /metrics
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start starts listening and serves scrapes in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+
+	s.logger.Infof("Metrics listening on %s/metrics", listener.Addr())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops the server, waiting a short time for scrapes in flight
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// throughputSmoothing is the weight of a new sample in the throughput average
+	throughputSmoothing = 0.3
+	// lowBufferPercent forces a down-switch when the buffer drains below it
+	lowBufferPercent = 25
+	// healthyBufferPercent is required before switching up
+	healthyBufferPercent = 50
+)
+
+// AdaptiveController chooses HLS variants from measured download throughput and
+// buffer levels, switching down immediately and up one step at a time
+type AdaptiveController struct {
+	mutex        sync.Mutex
+	variants     []HLSStream
+	current      int
+	throughput   float64
+	samples      int
+	bufferLevel  int
+	lastSwitch   time.Time
+	holdTime     time.Duration
+	safetyFactor float64
+}
+
+// NewAdaptiveController creates a controller for the given variants, starting at the lowest one.
+// holdTime is the minimum time between up-switches and safetyFactor the share of
+// measured throughput a variant may use.
+func NewAdaptiveController(variants []HLSStream, holdTime time.Duration, safetyFactor float64) *AdaptiveController {
+	sorted := make([]HLSStream, len(variants))
+	copy(sorted, variants)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Bandwidth < sorted[j].Bandwidth
+	})
+
+	if safetyFactor <= 0 || safetyFactor > 1 {
+		safetyFactor = 0.8
+	}
+
+	return &AdaptiveController{
+		variants:     sorted,
+		bufferLevel:  -1,
+		lastSwitch:   time.Now(),
+		holdTime:     holdTime,
+		safetyFactor: safetyFactor,
+	}
+}
+
+// AddSample records the download of a fragment
+func (a *AdaptiveController) AddSample(bytes uint64, downloadTime time.Duration) {
+	if bytes == 0 || downloadTime <= 0 {
+		return
+	}
+
+	bitsPerSecond := float64(bytes*8) / downloadTime.Seconds()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.samples == 0 {
+		a.throughput = bitsPerSecond
+	} else {
+		a.throughput = throughputSmoothing*bitsPerSecond + (1-throughputSmoothing)*a.throughput
+	}
+	a.samples++
+}
+
+// SetBufferLevel records the latest buffering percentage
+func (a *AdaptiveController) SetBufferLevel(percent int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.bufferLevel = percent
+}
+
+// Throughput returns the smoothed throughput estimate in bits per second
+func (a *AdaptiveController) Throughput() float64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.throughput
+}
+
+// Current returns the variant currently playing
+func (a *AdaptiveController) Current() HLSStream {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.variants[a.current]
+}
+
+// Variants returns the variants the controller chooses from, by ascending bandwidth
+func (a *AdaptiveController) Variants() []HLSStream {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	variants := make([]HLSStream, len(a.variants))
+	copy(variants, a.variants)
+	return variants
+}
+
+// Decide returns the variant to switch to, if any. A returned variant becomes
+// the current one.
+func (a *AdaptiveController) Decide(now time.Time) (HLSStream, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.samples == 0 || len(a.variants) < 2 {
+		return HLSStream{}, false
+	}
+
+	// Highest variant that fits into the usable throughput
+	target := 0
+	usable := a.throughput * a.safetyFactor
+	for i, variant := range a.variants {
+		if float64(variant.Bandwidth) <= usable {
+			target = i
+		}
+	}
+
+	// A draining buffer means we are already too slow
+	if a.bufferLevel >= 0 && a.bufferLevel < lowBufferPercent && a.current > 0 && target >= a.current {
+		target = a.current - 1
+	}
+
+	switch {
+	case target < a.current:
+		// Switch down immediately
+	case target > a.current:
+		if now.Sub(a.lastSwitch) < a.holdTime {
+			return HLSStream{}, false
+		}
+		if a.bufferLevel >= 0 && a.bufferLevel < healthyBufferPercent {
+			return HLSStream{}, false
+		}
+		// Step up one variant at a time
+		target = a.current + 1
+	default:
+		return HLSStream{}, false
+	}
+
+	a.current = target
+	a.lastSwitch = now
+	return a.variants[target], true
+}
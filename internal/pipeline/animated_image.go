@@ -0,0 +1,345 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// Frames shown for no time or nearly none are shown this long, like browsers do
+const defaultFrameDelay = 100 * time.Millisecond
+
+// ImageAnimation is an animated image overlay. Frames are either files of a PNG
+// sequence or decoded GIF or APNG frames, each the full size of the animation.
+type ImageAnimation struct {
+	Files  []string
+	Frames []*image.NRGBA
+	Delays []time.Duration // How long each frame is shown
+	Loop   bool            // Start over after the last frame, or hold it
+}
+
+// LoadImageAnimation loads the frames of an animated image overlay, nil for a still image
+func LoadImageAnimation(img config.ImageOverlay) (*ImageAnimation, error) {
+	files, err := sequenceFiles(img.Path)
+	if err != nil {
+		return nil, err
+	}
+	if files != nil {
+		if img.FrameRate <= 0 {
+			return nil, fmt.Errorf("image sequence frame rate must be positive, got %g", img.FrameRate)
+		}
+		delay := time.Duration(float64(time.Second) / img.FrameRate)
+		a := &ImageAnimation{Files: files, Delays: make([]time.Duration, len(files)), Loop: img.Loop}
+		for i := range a.Delays {
+			a.Delays[i] = delay
+		}
+		return a, nil
+	}
+
+	data, err := os.ReadFile(img.Path)
+	if err != nil {
+		return nil, err
+	}
+	var a *ImageAnimation
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		a, err = decodeGIF(data)
+	case bytes.HasPrefix(data, pngSignature):
+		a, err = decodeAPNG(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", img.Path, err)
+	}
+	if a == nil || len(a.Frames) < 2 {
+		return nil, nil
+	}
+	a.Loop = img.Loop
+	return a, nil
+}
+
+// sequenceFiles lists the files of a PNG sequence in playing order, nil when path is a
+// single file. Sequences are directories, globs or printf patterns numbered from 0 or 1.
+func sequenceFiles(path string) ([]string, error) {
+	var files []string
+	switch {
+	case strings.Contains(path, "%"):
+		first := 0
+		if _, err := os.Stat(fmt.Sprintf(path, 0)); err != nil {
+			first = 1
+		}
+		for i := first; ; i++ {
+			file := fmt.Sprintf(path, i)
+			if _, err := os.Stat(file); err != nil {
+				break
+			}
+			files = append(files, file)
+		}
+	case strings.ContainsAny(path, "*?["):
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image sequence %q: %w", path, err)
+		}
+		files = matches
+	default:
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			return nil, nil
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.png"))
+		if err != nil {
+			return nil, err
+		}
+		files = matches
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("image sequence %q has no frames", path)
+	}
+	// Globs sort by name, so frames need zero-padded numbers
+	sort.Strings(files)
+	return files, nil
+}
+
+// Duration returns how long one pass of the animation takes
+func (a *ImageAnimation) Duration() time.Duration {
+	var total time.Duration
+	for _, delay := range a.Delays {
+		total += delay
+	}
+	return total
+}
+
+// FrameAt returns the frame shown after elapsed running time
+func (a *ImageAnimation) FrameAt(elapsed time.Duration) int {
+	total := a.Duration()
+	if elapsed < 0 || total <= 0 {
+		return 0
+	}
+	if elapsed >= total {
+		if !a.Loop {
+			return len(a.Delays) - 1
+		}
+		elapsed %= total
+	}
+	for i, delay := range a.Delays {
+		if elapsed < delay {
+			return i
+		}
+		elapsed -= delay
+	}
+	return len(a.Delays) - 1
+}
+
+// frameDelay returns a frame delay, with the browser default for delays of 10ms or less
+func frameDelay(delay time.Duration) time.Duration {
+	if delay <= 10*time.Millisecond {
+		return defaultFrameDelay
+	}
+	return delay
+}
+
+// decodeGIF decodes the frames of a GIF onto its logical screen
+func decodeGIF(data []byte) (*ImageAnimation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ImageAnimation{}
+	canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, frame := range g.Image {
+		var previous *image.NRGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		a.Frames = append(a.Frames, cloneNRGBA(canvas))
+		delay := time.Duration(0)
+		if i < len(g.Delay) {
+			delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+		a.Delays = append(a.Delays, frameDelay(delay))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return a, nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// APNG dispose and blend operations
+const (
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendOver         = 1
+)
+
+// apngFrame is a frame control chunk and the image data of its frame
+type apngFrame struct {
+	width, height int
+	x, y          int
+	delay         time.Duration
+	dispose       byte
+	blend         byte
+	data          []byte
+}
+
+// decodeAPNG decodes the frames of an APNG, nil for a still PNG. Every frame is
+// decoded by image/png as a PNG of its own, built from the shared chunks and its data.
+func decodeAPNG(data []byte) (*ImageAnimation, error) {
+	var (
+		header   []byte
+		shared   bytes.Buffer // Chunks like PLTE and tRNS every frame needs
+		frames   []*apngFrame
+		animated bool
+	)
+	for pos := len(pngSignature); pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			return nil, fmt.Errorf("truncated %s chunk", kind)
+		}
+		chunk := data[pos+8 : pos+8+length]
+		raw := data[pos : pos+12+length]
+		pos += 12 + length
+
+		switch kind {
+		case "IHDR":
+			header = chunk
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if length < 26 {
+				return nil, fmt.Errorf("short fcTL chunk")
+			}
+			delayNum, delayDen := binary.BigEndian.Uint16(chunk[20:]), binary.BigEndian.Uint16(chunk[22:])
+			if delayDen == 0 {
+				delayDen = 100
+			}
+			frames = append(frames, &apngFrame{
+				width:   int(binary.BigEndian.Uint32(chunk[4:])),
+				height:  int(binary.BigEndian.Uint32(chunk[8:])),
+				x:       int(binary.BigEndian.Uint32(chunk[12:])),
+				y:       int(binary.BigEndian.Uint32(chunk[16:])),
+				delay:   frameDelay(time.Duration(delayNum) * time.Second / time.Duration(delayDen)),
+				dispose: chunk[24],
+				blend:   chunk[25],
+			})
+		case "IDAT":
+			// Image data before the first frame control is a default image that isn't
+			// part of the animation
+			if len(frames) == 1 {
+				frames[0].data = append(frames[0].data, chunk...)
+			}
+		case "fdAT":
+			if len(frames) > 0 && length > 4 {
+				frames[len(frames)-1].data = append(frames[len(frames)-1].data, chunk[4:]...)
+			}
+		case "IEND":
+		default:
+			if len(frames) == 0 {
+				shared.Write(raw)
+			}
+		}
+	}
+	if !animated {
+		return nil, nil
+	}
+	if len(header) != 13 {
+		return nil, fmt.Errorf("missing IHDR chunk")
+	}
+
+	a := &ImageAnimation{}
+	width, height := int(binary.BigEndian.Uint32(header)), int(binary.BigEndian.Uint32(header[4:]))
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, frame := range frames {
+		img, err := decodeAPNGFrame(header, shared.Bytes(), frame)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i+1, err)
+		}
+
+		bounds := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		var previous *image.NRGBA
+		if frame.dispose == apngDisposePrevious && i > 0 {
+			previous = cloneNRGBA(canvas)
+		}
+		op := draw.Src
+		if frame.blend == apngBlendOver {
+			op = draw.Over
+		}
+		draw.Draw(canvas, bounds, img, img.Bounds().Min, op)
+		a.Frames = append(a.Frames, cloneNRGBA(canvas))
+		a.Delays = append(a.Delays, frame.delay)
+
+		// The first frame can't restore a previous one, it is cleared instead
+		switch {
+		case previous != nil:
+			canvas = previous
+		case frame.dispose == apngDisposeBackground || frame.dispose == apngDisposePrevious:
+			draw.Draw(canvas, bounds, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return a, nil
+}
+
+// decodeAPNGFrame decodes the image data of an APNG frame
+func decodeAPNGFrame(header, shared []byte, frame *apngFrame) (image.Image, error) {
+	if len(frame.data) == 0 {
+		return nil, fmt.Errorf("no image data")
+	}
+	frameHeader := append([]byte(nil), header...)
+	binary.BigEndian.PutUint32(frameHeader, uint32(frame.width))
+	binary.BigEndian.PutUint32(frameHeader[4:], uint32(frame.height))
+
+	var b bytes.Buffer
+	b.Write(pngSignature)
+	writePNGChunk(&b, "IHDR", frameHeader)
+	b.Write(shared)
+	writePNGChunk(&b, "IDAT", frame.data)
+	writePNGChunk(&b, "IEND", nil)
+	return png.Decode(&b)
+}
+
+// writePNGChunk writes a PNG chunk with its checksum
+func writePNGChunk(b *bytes.Buffer, kind string, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	b.Write(length[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	b.WriteString(kind)
+	b.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	b.Write(sum[:])
+}
+
+// cloneNRGBA copies an image
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	clone := image.NewNRGBA(img.Bounds())
+	copy(clone.Pix, img.Pix)
+	return clone
+}
@@ -0,0 +1,267 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/go-gst/go-gst/gst/app"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// captionState carries closed captions from the decoded input to the output video,
+// guarded by its own mutex as both ends run in streaming threads
+type captionState struct {
+	mutex    sync.Mutex
+	pending  []byte       // cc_data taken off the input, not yet sent on
+	source   *app.Source  // Feeds the captions to cccombiner
+	inserter *gst.Element // Bin putting the captions back on the output video
+	inserted bool         // The inserter is linked into the output video
+
+	// Set when the pipeline is linked: the inserter goes between upstream and the encoder
+	pipeline *gst.Pipeline
+	upstream *gst.Element
+}
+
+// setupCaptions prepares carrying the closed captions of the input into the output. It
+// returns the video sink playbin3 plays to: videoSink, or a bin taking the caption meta
+// off the decoded video in front of it. The bin putting them back on the output video
+// is only linked once the input has captions, so inputs without them get no cccombiner
+// and no added latency. Without the closedcaption plugin the captions are dropped.
+func (p *Pipeline) setupCaptions(cfg *config.Config, videoSink *gst.Element) *gst.Element {
+	p.captions = nil
+	captions := cfg.Output.Captions
+	if captions.Passthrough && !CaptionsCarried(cfg.Output.VideoCodec) {
+		p.logger.Warnf("Closed captions are not carried by %s output", cfg.Output.VideoCodec)
+		captions.Passthrough = false
+	}
+	if !captions.Passthrough && !captions.BurnIn {
+		return videoSink
+	}
+
+	c := &captionState{}
+	inserter, err := p.createCaptionInserter(c, captions)
+	if err != nil {
+		p.logger.Warnf("Closed captions are dropped: %v", err)
+		return videoSink
+	}
+	extractor, err := p.createCaptionExtractor(c, videoSink)
+	if err != nil {
+		p.logger.Warnf("Closed captions are dropped: %v", err)
+		return videoSink
+	}
+	c.inserter = inserter
+	p.captions = c
+
+	p.logger.Infof("Closed captions carried into the output: passthrough=%t burn-in=%t",
+		captions.Passthrough, captions.BurnIn)
+	return extractor
+}
+
+// createCaptionExtractor builds a bin taking the caption meta off the decoded video in
+// front of videoSink. ccextractor adds its caption pad with the first captions, they are
+// converted to CEA-708 cc_data for an appsink.
+func (p *Pipeline) createCaptionExtractor(c *captionState, videoSink *gst.Element) (*gst.Element, error) {
+	extractor, err := gst.NewElement("ccextractor")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ccextractor: %w", err)
+	}
+	// The captions are put back on the output video, the meta would be copied as well
+	extractor.SetProperty("remove-caption-meta", true)
+
+	converter, err := gst.NewElement("ccconverter")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ccconverter: %w", err)
+	}
+	filter, err := gst.NewElement("capsfilter")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create caption caps filter: %w", err)
+	}
+	filter.SetProperty("caps", gst.NewCapsFromString("closedcaption/x-cea-708,format=cc_data"))
+
+	sink, err := app.NewAppSink()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create caption appsink: %w", err)
+	}
+	sink.SetProperty("sync", false)
+	sink.SetProperty("async", false)
+	sink.SetCallbacks(&app.SinkCallbacks{
+		NewSampleFunc: func(sink *app.Sink) gst.FlowReturn {
+			sample := sink.PullSample()
+			if sample == nil {
+				return gst.FlowEOS
+			}
+			if buffer := sample.GetBuffer(); buffer != nil {
+				c.mutex.Lock()
+				c.pending = AppendCCData(c.pending, buffer.Bytes(), maxPendingCCData)
+				c.mutex.Unlock()
+			}
+			return gst.FlowOK
+		},
+	})
+
+	bin := gst.NewBin("")
+	if err := bin.AddMany(extractor, videoSink, converter, filter, sink.Element); err != nil {
+		return nil, fmt.Errorf("failed to add caption extraction elements: %w", err)
+	}
+	if err := extractor.Link(videoSink); err != nil {
+		return nil, fmt.Errorf("failed to link ccextractor: %w", err)
+	}
+	if err := converter.Link(filter); err != nil {
+		return nil, fmt.Errorf("failed to link ccconverter: %w", err)
+	}
+	if err := filter.Link(sink.Element); err != nil {
+		return nil, fmt.Errorf("failed to link caption appsink: %w", err)
+	}
+
+	extractor.Connect("pad-added", func(_ *gst.Element, pad *gst.Pad) {
+		if pad.GetName() != "caption" {
+			return
+		}
+		if ret := pad.Link(converter.GetStaticPad("sink")); ret != gst.PadLinkOK {
+			p.logger.Warnf("Closed captions found in the input but not linked: %s", ret)
+			return
+		}
+		p.logger.Info("Closed captions found in the input")
+		p.insertCaptions(c)
+	})
+
+	if !bin.AddPad(gst.NewGhostPad("sink", extractor.GetStaticPad("sink")).Pad) {
+		return nil, fmt.Errorf("failed to add caption extraction bin pad")
+	}
+	return bin.Element, nil
+}
+
+// createCaptionInserter builds a bin putting the captions back on the output video in
+// front of the encoder: a cccombiner fed by an appsrc, followed by a cea608overlay when
+// the captions are burnt in. x264enc writes the caption meta as CEA-708 SEI.
+func (p *Pipeline) createCaptionInserter(c *captionState, captions config.CaptionsConfig) (*gst.Element, error) {
+	combiner, err := gst.NewElement("cccombiner")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cccombiner: %w", err)
+	}
+	// Captions of a frame are spread over the next ones when there are too many for one
+	if err := combiner.SetProperty("schedule", true); err != nil {
+		p.logger.Debugf("cccombiner does not schedule captions: %v", err)
+	}
+
+	c.source, err = app.NewAppSrc()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create caption appsrc: %w", err)
+	}
+	c.source.SetCaps(gst.NewCapsFromString("closedcaption/x-cea-708,format=cc_data"))
+	c.source.SetProperty("is-live", true)
+	c.source.SetProperty("format", gst.FormatTime)
+
+	bin := gst.NewBin("")
+	if err := bin.AddMany(combiner, c.source.Element); err != nil {
+		return nil, fmt.Errorf("failed to add caption insertion elements: %w", err)
+	}
+	captionPad := combiner.GetRequestPad("caption")
+	if captionPad == nil {
+		return nil, fmt.Errorf("failed to request cccombiner caption pad")
+	}
+	if ret := c.source.GetStaticPad("src").Link(captionPad); ret != gst.PadLinkOK {
+		return nil, fmt.Errorf("failed to link caption appsrc to cccombiner: %s", ret)
+	}
+
+	last := combiner
+	if captions.BurnIn {
+		overlay, err := gst.NewElement("cea608overlay")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cea608overlay: %w", err)
+		}
+		overlay.SetProperty("remove-caption-meta", !captions.Passthrough)
+		if err := bin.Add(overlay); err != nil {
+			return nil, fmt.Errorf("failed to add cea608overlay: %w", err)
+		}
+		if err := combiner.Link(overlay); err != nil {
+			return nil, fmt.Errorf("failed to link cea608overlay: %w", err)
+		}
+		last = overlay
+	}
+
+	// Every frame gets the captions taken off the input since the previous one
+	videoPad := combiner.GetStaticPad("sink")
+	videoPad.AddProbe(gst.PadProbeTypeBuffer,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if buffer := info.GetBuffer(); buffer != nil {
+				p.sendCaptions(c, buffer)
+			}
+			return gst.PadProbeOK
+		})
+
+	if !bin.AddPad(gst.NewGhostPad("sink", videoPad).Pad) ||
+		!bin.AddPad(gst.NewGhostPad("src", last.GetStaticPad("src")).Pad) {
+		return nil, fmt.Errorf("failed to add caption insertion bin pads")
+	}
+	return bin.Element, nil
+}
+
+// insertCaptions links the caption inserter into the output video, in front of the
+// encoder. The upstream pad is blocked while the inserter is put in, so no frame passes
+// during the change.
+func (p *Pipeline) insertCaptions(c *captionState) {
+	c.mutex.Lock()
+	if c.inserted || c.upstream == nil {
+		c.mutex.Unlock()
+		return
+	}
+	c.inserted = true
+	upstream, pipeline := c.upstream, c.pipeline
+	c.mutex.Unlock()
+
+	upstream.GetStaticPad("src").AddProbe(gst.PadProbeTypeBlockDownstream,
+		func(pad *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+			encoderPad := pad.GetPeer()
+			if encoderPad == nil || !pad.Unlink(encoderPad) {
+				p.logger.Warn("Closed captions not inserted: the output video is not linked")
+				return gst.PadProbeRemove
+			}
+			if err := pipeline.Add(c.inserter); err != nil {
+				p.logger.Warnf("Closed captions not inserted: %v", err)
+				pad.Link(encoderPad)
+				return gst.PadProbeRemove
+			}
+			sinkPad, srcPad := c.inserter.GetStaticPad("sink"), c.inserter.GetStaticPad("src")
+			if ret := pad.Link(sinkPad); ret != gst.PadLinkOK {
+				p.logger.Warnf("Closed captions not inserted: %s", ret)
+				pipeline.Remove(c.inserter)
+				pad.Link(encoderPad)
+				return gst.PadProbeRemove
+			}
+			if ret := srcPad.Link(encoderPad); ret != gst.PadLinkOK {
+				p.logger.Warnf("Closed captions not inserted: %s", ret)
+				pad.Unlink(sinkPad)
+				pipeline.Remove(c.inserter)
+				pad.Link(encoderPad)
+				return gst.PadProbeRemove
+			}
+			c.inserter.SyncStateWithParent()
+			p.logger.Info("Closed captions inserted into the output video")
+			return gst.PadProbeRemove
+		})
+}
+
+// sendCaptions pushes the pending captions timed like a video frame on its way to
+// cccombiner. Without captions a gap is pushed, so cccombiner doesn't wait for them.
+func (p *Pipeline) sendCaptions(c *captionState, frame *gst.Buffer) {
+	c.mutex.Lock()
+	data := c.pending
+	c.pending = nil
+	c.mutex.Unlock()
+
+	var buffer *gst.Buffer
+	if len(data) > 0 {
+		buffer = gst.NewBufferFromBytes(data)
+	} else {
+		buffer = gst.NewEmptyBuffer()
+		buffer.SetFlags(gst.BufferFlagGap)
+	}
+	buffer.SetPresentationTimestamp(frame.PresentationTimestamp())
+	buffer.SetDuration(frame.Duration())
+	if ret := c.source.PushBuffer(buffer); ret != gst.FlowOK && ret != gst.FlowFlushing {
+		p.logger.Debugf("Closed captions not pushed: %s", ret)
+	}
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+// Caption data waiting for the output is capped at about two seconds of CEA-708 at
+// 30 frames per second, 20 cc_data triplets a frame
+const maxPendingCCData = 2 * 30 * 20 * 3
+
+// AppendCCData appends the valid triplets of CEA-708 cc_data to pending data. Padding
+// triplets and a trailing partial triplet are dropped, and the oldest triplets are
+// dropped beyond limit bytes.
+func AppendCCData(pending, data []byte, limit int) []byte {
+	for i := 0; i+3 <= len(data); i += 3 {
+		// The cc_valid bit is unset for padding
+		if data[i]&0x04 != 0 {
+			pending = append(pending, data[i:i+3]...)
+		}
+	}
+	if excess := len(pending) - limit; excess > 0 {
+		excess = (excess + 2) / 3 * 3
+		pending = append(pending[:0], pending[excess:]...)
+	}
+	return pending
+}
+
+// CaptionsCarried reports whether the output encoder of a video codec writes caption
+// meta into the stream, as CEA-708 SEI
+func CaptionsCarried(codec string) bool {
+	switch codec {
+	case "h265", "vp8", "vp9":
+		return false
+	default:
+		// Other codecs are encoded with x264enc
+		return true
+	}
+}
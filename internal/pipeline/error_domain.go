@@ -0,0 +1,47 @@
+package pipeline
+
+/*
+#cgo pkg-config: gstreamer-1.0
+#include <gst/gst.h>
+
+// message_error_domain returns the domain of the GError carried by an error
+// message and stores its code, or returns NULL for other messages
+static const gchar *
+message_error_domain (GstMessage * msg, gint * code)
+{
+  GError *err = NULL;
+  const gchar *domain;
+
+  if (GST_MESSAGE_TYPE (msg) != GST_MESSAGE_ERROR)
+    return NULL;
+
+  gst_message_parse_error (msg, &err, NULL);
+  if (err == NULL)
+    return NULL;
+
+  // Quark strings are interned and outlive the error
+  domain = g_quark_to_string (err->domain);
+  *code = err->code;
+  g_error_free (err);
+
+  return domain;
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/go-gst/go-gst/gst"
+)
+
+// errorDomain returns the GError domain and code of an error message, go-gst only
+// exposes the message text
+func errorDomain(msg *gst.Message) (string, int) {
+	var code C.gint
+	domain := C.message_error_domain((*C.GstMessage)(unsafe.Pointer(msg.Instance())), &code)
+	if domain == nil {
+		return "", 0
+	}
+	return C.GoString(domain), int(code)
+}
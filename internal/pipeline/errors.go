@@ -1,7 +1,9 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -12,6 +14,8 @@ type PipelineError struct {
 	Timestamp time.Time
 	Source    string
 	Debug     string
+	Domain    string // GError domain, empty for errors not posted by GStreamer
+	Code      int    // GError code within Domain
 }
 
 // ErrorType represents the type of pipeline error
@@ -66,91 +70,210 @@ func NewPipelineError(errorType ErrorType, source, message, debug string) *Pipel
 	}
 }
 
+// GStreamer error domains, as named by their GQuark
+const (
+	ErrorDomainCore     = "gst-core-error-quark"
+	ErrorDomainLibrary  = "gst-library-error-quark"
+	ErrorDomainResource = "gst-resource-error-quark"
+	ErrorDomainStream   = "gst-stream-error-quark"
+)
+
+// GStreamer error codes used for classification (GstCoreError, GstLibraryError,
+// GstResourceError and GstStreamError)
+const (
+	coreErrorNotImplemented = 3
+	coreErrorNegotiation    = 7
+	coreErrorCaps           = 10
+	coreErrorMissingPlugin  = 12
+	coreErrorDisabled       = 14
+
+	libraryErrorInit     = 3
+	libraryErrorSettings = 5
+	libraryErrorEncode   = 6
+
+	resourceErrorOpenWrite     = 6
+	resourceErrorWrite         = 10
+	resourceErrorSettings      = 13
+	resourceErrorNoSpaceLeft   = 14
+	resourceErrorNotAuthorized = 15
+
+	streamErrorEncode       = 8
+	streamErrorMux          = 10
+	streamErrorDecrypt      = 12
+	streamErrorDecryptNoKey = 13
+)
+
+// ClassifyError maps a GError domain and code to an ErrorType. fromInput tells whether
+// the error was posted from within the input (playbin3), which decides between
+// network and local resource errors.
+func ClassifyError(domain string, code int, fromInput bool) ErrorType {
+	switch domain {
+	case ErrorDomainResource:
+		switch code {
+		case resourceErrorSettings, resourceErrorNotAuthorized:
+			return ErrorTypeConfiguration
+		case resourceErrorOpenWrite, resourceErrorWrite, resourceErrorNoSpaceLeft:
+			return ErrorTypeOutput
+		}
+		if fromInput {
+			return ErrorTypeNetwork
+		}
+		return ErrorTypeResource
+	case ErrorDomainStream:
+		switch code {
+		case streamErrorEncode, streamErrorMux:
+			return ErrorTypeEncoding
+		case streamErrorDecrypt, streamErrorDecryptNoKey:
+			return ErrorTypeInput
+		}
+		if fromInput {
+			return ErrorTypeDecoding
+		}
+		return ErrorTypeEncoding
+	case ErrorDomainCore:
+		switch code {
+		case coreErrorNotImplemented, coreErrorMissingPlugin, coreErrorDisabled:
+			return ErrorTypeConfiguration
+		case coreErrorNegotiation, coreErrorCaps:
+			if fromInput {
+				return ErrorTypeDecoding
+			}
+			return ErrorTypeEncoding
+		}
+	case ErrorDomainLibrary:
+		switch code {
+		case libraryErrorInit, libraryErrorSettings:
+			return ErrorTypeConfiguration
+		case libraryErrorEncode:
+			return ErrorTypeEncoding
+		}
+	}
+	if fromInput {
+		return ErrorTypeInput
+	}
+	return ErrorTypeUnknown
+}
+
+// retryResetPeriod is how long the pipeline must run without errors before
+// retries are no longer counted as consecutive
+const retryResetPeriod = 5 * time.Minute
+
 // ErrorHandler handles pipeline errors with retry logic
 type ErrorHandler struct {
+	mutex         sync.Mutex
 	maxRetries    int
 	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	attempts      int
 	retryCount    map[ErrorType]int
 	lastError     *PipelineError
 	errorCallback func(*PipelineError)
 }
 
-// NewErrorHandler creates a new error handler
-func NewErrorHandler(maxRetries int, retryDelay time.Duration) *ErrorHandler {
+// NewErrorHandler creates a new error handler. The retry delay doubles with every
+// consecutive retry up to maxRetryDelay, maxRetries of 0 retries forever.
+func NewErrorHandler(maxRetries int, retryDelay, maxRetryDelay time.Duration) *ErrorHandler {
 	return &ErrorHandler{
-		maxRetries: maxRetries,
-		retryDelay: retryDelay,
-		retryCount: make(map[ErrorType]int),
+		maxRetries:    maxRetries,
+		retryDelay:    retryDelay,
+		maxRetryDelay: maxRetryDelay,
+		retryCount:    make(map[ErrorType]int),
 	}
 }
 
 // SetErrorCallback sets a callback function for error notifications
 func (eh *ErrorHandler) SetErrorCallback(callback func(*PipelineError)) {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
 	eh.errorCallback = callback
 }
 
-// HandleError processes a pipeline error and determines if retry is needed
-func (eh *ErrorHandler) HandleError(err *PipelineError) bool {
+// HandleError processes a pipeline error and returns how long to wait before
+// retrying, or false if the error must not be retried
+func (eh *ErrorHandler) HandleError(err *PipelineError) (time.Duration, bool) {
+	eh.mutex.Lock()
+	if eh.lastError != nil && err.Timestamp.Sub(eh.lastError.Timestamp) >= retryResetPeriod {
+		// The previous failure was recovered from long ago
+		eh.attempts = 0
+		eh.retryCount = make(map[ErrorType]int)
+	}
 	eh.lastError = err
-	
-	// Call error callback if set
-	if eh.errorCallback != nil {
-		eh.errorCallback(err)
+	callback := eh.errorCallback
+
+	retry := eh.shouldRetry(err.Type) && (eh.maxRetries == 0 || eh.attempts < eh.maxRetries)
+	var delay time.Duration
+	if retry {
+		eh.attempts++
+		eh.retryCount[err.Type]++
+		delay = eh.backoff(eh.attempts)
 	}
+	eh.mutex.Unlock()
 
-	// Check if we should retry based on error type
-	if !eh.shouldRetry(err.Type) {
-		return false
+	// Call error callback if set
+	if callback != nil {
+		callback(err)
 	}
 
-	// Increment retry count for this error type
-	eh.retryCount[err.Type]++
+	return delay, retry
+}
 
-	// Check if we've exceeded max retries
-	if eh.retryCount[err.Type] > eh.maxRetries {
-		return false
+// backoff returns the delay before the given consecutive attempt
+func (eh *ErrorHandler) backoff(attempt int) time.Duration {
+	delay := eh.retryDelay
+	for i := 1; i < attempt && delay < eh.maxRetryDelay; i++ {
+		delay *= 2
 	}
-
-	// Wait before retry
-	time.Sleep(eh.retryDelay)
-	return true
+	if eh.maxRetryDelay > 0 && delay > eh.maxRetryDelay {
+		delay = eh.maxRetryDelay
+	}
+	return delay
 }
 
-// shouldRetry determines if an error type should be retried
+// shouldRetry determines if an error type should be retried. Configuration
+// errors repeat on every restart, anything else may be transient.
 func (eh *ErrorHandler) shouldRetry(errorType ErrorType) bool {
-	switch errorType {
-	case ErrorTypeNetwork, ErrorTypeInput:
-		return true
-	case ErrorTypeResource:
-		return true
-	case ErrorTypeConfiguration:
-		return false
-	default:
-		return false
-	}
+	return errorType != ErrorTypeConfiguration
 }
 
 // Reset resets the retry counters
 func (eh *ErrorHandler) Reset() {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+	eh.attempts = 0
 	eh.retryCount = make(map[ErrorType]int)
 	eh.lastError = nil
 }
 
 // GetLastError returns the last error encountered
 func (eh *ErrorHandler) GetLastError() *PipelineError {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
 	return eh.lastError
 }
 
 // GetRetryCount returns the retry count for a specific error type
 func (eh *ErrorHandler) GetRetryCount(errorType ErrorType) int {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
 	return eh.retryCount[errorType]
 }
 
+// Attempts returns the number of consecutive retries
+func (eh *ErrorHandler) Attempts() int {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+	return eh.attempts
+}
+
+// healthCheckInterval is how often the health checker looks at the pipeline
+const healthCheckInterval = 5 * time.Second
+
 // HealthChecker monitors pipeline health
 type HealthChecker struct {
 	pipeline         *Pipeline
 	checkInterval    time.Duration
 	timeoutThreshold time.Duration
+	mutex            sync.Mutex
 	lastActivity     time.Time
 	isHealthy        bool
 	healthCallback   func(bool)
@@ -172,114 +295,179 @@ func (hc *HealthChecker) SetHealthCallback(callback func(bool)) {
 	hc.healthCallback = callback
 }
 
-// Start starts the health monitoring
-func (hc *HealthChecker) Start() {
-	go hc.monitor()
+// Start starts the health monitoring until ctx is cancelled
+func (hc *HealthChecker) Start(ctx context.Context) {
+	hc.Reset()
+	go hc.monitor(ctx)
 }
 
 // monitor runs the health monitoring loop
-func (hc *HealthChecker) monitor() {
+func (hc *HealthChecker) monitor(ctx context.Context) {
 	ticker := time.NewTicker(hc.checkInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		healthy := hc.checkHealth()
-		
-		if healthy != hc.isHealthy {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			healthy := hc.pipeline.IsRunning() && hc.checkHealth(now)
+
+			hc.mutex.Lock()
+			changed := healthy != hc.isHealthy
 			hc.isHealthy = healthy
-			if hc.healthCallback != nil {
+			hc.mutex.Unlock()
+
+			if changed && hc.healthCallback != nil {
 				hc.healthCallback(healthy)
 			}
 		}
 	}
 }
 
-// checkHealth performs health checks
-func (hc *HealthChecker) checkHealth() bool {
-	// Check if pipeline is running
-	if !hc.pipeline.IsRunning() {
-		return false
-	}
-
-	// Check for timeout (no activity)
-	if time.Since(hc.lastActivity) > hc.timeoutThreshold {
-		return false
-	}
-
-	// Additional health checks can be added here
-	return true
+// checkHealth reports whether the pipeline produced data recently
+func (hc *HealthChecker) checkHealth(now time.Time) bool {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	return now.Sub(hc.lastActivity) <= hc.timeoutThreshold
 }
 
 // UpdateActivity updates the last activity timestamp
 func (hc *HealthChecker) UpdateActivity() {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
 	hc.lastActivity = time.Now()
 }
 
+// Reset marks the pipeline healthy and restarts the activity timeout, giving a
+// (re)started pipeline time to produce data
+func (hc *HealthChecker) Reset() {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	hc.lastActivity = time.Now()
+	hc.isHealthy = true
+}
+
 // IsHealthy returns the current health status
 func (hc *HealthChecker) IsHealthy() bool {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
 	return hc.isHealthy
 }
 
-// RecoveryManager handles pipeline recovery
+// RecoveryManager rebuilds and restarts the pipeline after errors and stalls
 type RecoveryManager struct {
 	pipeline      *Pipeline
 	errorHandler  *ErrorHandler
 	healthChecker *HealthChecker
-	autoRestart   bool
-	restartDelay  time.Duration
+
+	mutex      sync.Mutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	recovering bool
 }
 
-// NewRecoveryManager creates a new recovery manager
-func NewRecoveryManager(pipeline *Pipeline, autoRestart bool, restartDelay time.Duration) *RecoveryManager {
+// NewRecoveryManager creates a new recovery manager. Restarts wait restartDelay, doubled
+// for each consecutive restart up to maxRestartDelay, and stop after maxRestarts
+// consecutive restarts (0 = never). A pipeline delivering no data to the output for
+// stallTimeout is restarted as well.
+func NewRecoveryManager(pipeline *Pipeline, maxRestarts int, restartDelay, maxRestartDelay, stallTimeout time.Duration) *RecoveryManager {
 	return &RecoveryManager{
-		pipeline:     pipeline,
-		autoRestart:  autoRestart,
-		restartDelay: restartDelay,
-		errorHandler: NewErrorHandler(3, 5*time.Second),
-		healthChecker: NewHealthChecker(pipeline, 10*time.Second, 30*time.Second),
+		pipeline:      pipeline,
+		errorHandler:  NewErrorHandler(maxRestarts, restartDelay, maxRestartDelay),
+		healthChecker: NewHealthChecker(pipeline, healthCheckInterval, stallTimeout),
 	}
 }
 
 // Start starts the recovery manager
-func (rm *RecoveryManager) Start() {
-	// Set up error callback
-	rm.errorHandler.SetErrorCallback(func(err *PipelineError) {
-		rm.pipeline.logger.Errorf("Pipeline error: %v", err)
-		
-		if rm.autoRestart && rm.errorHandler.shouldRetry(err.Type) {
-			go rm.attemptRestart()
-		}
-	})
+func (rm *RecoveryManager) Start(ctx context.Context) {
+	rm.mutex.Lock()
+	rm.ctx, rm.cancel = context.WithCancel(ctx)
+	rm.mutex.Unlock()
 
 	// Set up health callback
 	rm.healthChecker.SetHealthCallback(func(healthy bool) {
-		if !healthy && rm.autoRestart {
-			rm.pipeline.logger.Warn("Pipeline unhealthy, attempting restart")
-			go rm.attemptRestart()
+		if !healthy {
+			rm.HandleError(NewPipelineError(ErrorTypeOutput, "health-checker",
+				fmt.Sprintf("no data reached the output for %s", rm.healthChecker.timeoutThreshold), ""))
 		}
 	})
 
 	// Start health monitoring
-	rm.healthChecker.Start()
+	rm.healthChecker.Start(rm.ctx)
 }
 
-// attemptRestart attempts to restart the pipeline
-func (rm *RecoveryManager) attemptRestart() {
-	rm.pipeline.logger.Info("Attempting pipeline restart...")
-	
-	// Stop current pipeline
-	if err := rm.pipeline.Stop(); err != nil {
-		rm.pipeline.logger.Errorf("Error stopping pipeline: %v", err)
+// Stop stops recovering, a restart in progress is waited for by Pipeline.Stop
+func (rm *RecoveryManager) Stop() {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if rm.cancel != nil {
+		rm.cancel()
 	}
+}
 
-	// Wait before restart
-	time.Sleep(rm.restartDelay)
+// UpdateActivity records that data reached the output
+func (rm *RecoveryManager) UpdateActivity() {
+	rm.healthChecker.UpdateActivity()
+}
 
-	// Restart pipeline
-	if err := rm.pipeline.Start(nil); err != nil {
-		rm.pipeline.logger.Errorf("Error restarting pipeline: %v", err)
-	} else {
-		rm.pipeline.logger.Info("Pipeline restarted successfully")
-		rm.errorHandler.Reset()
+// HandleError restarts the pipeline if the error is recoverable. Errors arriving while
+// a restart is pending belong to the failure already being recovered from.
+func (rm *RecoveryManager) HandleError(err *PipelineError) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.recovering || rm.ctx == nil || rm.ctx.Err() != nil {
+		return
+	}
+	rm.recovering = true
+	go rm.recover(rm.ctx, err)
+}
+
+// recover restarts the pipeline with backoff until it starts or retries run out
+func (rm *RecoveryManager) recover(ctx context.Context, err *PipelineError) {
+	defer func() {
+		rm.mutex.Lock()
+		rm.recovering = false
+		rm.mutex.Unlock()
+	}()
+
+	logger := rm.pipeline.logger
+	for {
+		delay, retry := rm.errorHandler.HandleError(err)
+		if !retry {
+			logger.Errorf("Pipeline cannot recover from %v after %d restarts", err, rm.errorHandler.Attempts())
+			rm.pipeline.fail(err)
+			return
+		}
+
+		logger.Warnf("Restarting pipeline in %s after %v (attempt %d)", delay, err, rm.errorHandler.Attempts())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		restartErr := rm.restart(ctx)
+		if restartErr == nil {
+			logger.Info("Pipeline restarted successfully")
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		err = NewPipelineError(ErrorTypeResource, "pipeline", restartErr.Error(), "")
+	}
+}
+
+// restart rebuilds the pipeline unless the recovery manager was stopped meanwhile
+func (rm *RecoveryManager) restart(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := rm.pipeline.Restart(); err != nil {
+		return err
 	}
+	rm.healthChecker.Reset()
+	return nil
 }
@@ -0,0 +1,211 @@
+package pipeline
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inputStartupTimeout is how long a newly activated input may take to deliver video
+const inputStartupTimeout = 15 * time.Second
+
+// failoverHealthInterval is how often inputs with higher priority than the active one are checked
+const failoverHealthInterval = 5 * time.Second
+
+// switchGracePeriod ignores errors reported right after a switch, they usually
+// belong to the input that was just replaced
+const switchGracePeriod = time.Second
+
+// InputSwitcher decides which input feeds the output. Inputs are ordered by
+// priority, an optional slate follows the last input.
+type InputSwitcher struct {
+	mutex         sync.Mutex
+	inputs        []string
+	hasSlate      bool
+	active        int
+	timeout       time.Duration
+	failbackDelay time.Duration
+	switchedAt    time.Time
+	lastActivity  time.Time
+	healthySince  []time.Time
+}
+
+// NewInputSwitcher creates a switcher starting on the first input. timeout is how long
+// the active input may deliver no video, failbackDelay how long a higher priority
+// input must be healthy before switching back to it.
+func NewInputSwitcher(inputs []string, hasSlate bool, timeout, failbackDelay time.Duration) *InputSwitcher {
+	return &InputSwitcher{
+		inputs:        inputs,
+		hasSlate:      hasSlate,
+		timeout:       timeout,
+		failbackDelay: failbackDelay,
+		switchedAt:    time.Now(),
+		healthySince:  make([]time.Time, len(inputs)),
+	}
+}
+
+// Active returns the index of the active input, len(inputs) for the slate
+func (s *InputSwitcher) Active() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.active
+}
+
+// Name describes an input index for logging
+func (s *InputSwitcher) Name(index int) string {
+	if index >= len(s.inputs) {
+		return "slate"
+	}
+	if index == 0 {
+		return fmt.Sprintf("primary input %s", s.inputs[0])
+	}
+	return fmt.Sprintf("backup input %d %s", index, s.inputs[index])
+}
+
+// Activity records that the active input delivered video
+func (s *InputSwitcher) Activity(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastActivity = now
+}
+
+// Failed reports an error on the active input and returns the input to switch to
+func (s *InputSwitcher) Failed(now time.Time) (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.Sub(s.switchedAt) < switchGracePeriod {
+		return 0, false
+	}
+	return s.next(now)
+}
+
+// CheckStall returns the input to switch to when the active input stopped delivering video
+func (s *InputSwitcher) CheckStall(now time.Time) (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.active >= len(s.inputs) {
+		// The slate doesn't stall
+		return 0, false
+	}
+
+	if s.lastActivity.Before(s.switchedAt) {
+		// Nothing received since the switch, allow the input to start up
+		if now.Sub(s.switchedAt) < inputStartupTimeout {
+			return 0, false
+		}
+	} else if now.Sub(s.lastActivity) < s.timeout {
+		return 0, false
+	}
+
+	return s.next(now)
+}
+
+// next moves to the input following the active one, wrapping to the primary
+// when there is no slate to fall back to. The slate is the last resort, errors
+// while it plays don't switch.
+func (s *InputSwitcher) next(now time.Time) (int, bool) {
+	if s.active >= len(s.inputs) {
+		return 0, false
+	}
+	next := s.active + 1
+	if next >= len(s.inputs) && !s.hasSlate {
+		next = 0
+	}
+	s.healthySince[s.active] = time.Time{}
+	s.switchTo(next, now)
+	return next, true
+}
+
+// switchTo makes index the active input
+func (s *InputSwitcher) switchTo(index int, now time.Time) {
+	s.active = index
+	s.switchedAt = now
+}
+
+// ReportHealth records the result of a health check on an input that is not active
+func (s *InputSwitcher) ReportHealth(index int, healthy bool, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !healthy {
+		s.healthySince[index] = time.Time{}
+	} else if s.healthySince[index].IsZero() {
+		s.healthySince[index] = now
+	}
+}
+
+// Failback returns the highest priority input above the active one that has been
+// healthy for the failback delay
+func (s *InputSwitcher) Failback(now time.Time) (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i < s.active && i < len(s.inputs); i++ {
+		since := s.healthySince[i]
+		if !since.IsZero() && now.Sub(since) >= s.failbackDelay {
+			s.switchTo(i, now)
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Standby returns the inputs with higher priority than the active one, which are health checked
+func (s *InputSwitcher) Standby() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var standby []int
+	for i := 0; i < s.active && i < len(s.inputs); i++ {
+		standby = append(standby, i)
+	}
+	return standby
+}
+
+// checkPlaylist verifies that url serves an HLS playlist
+func checkPlaylist(client *http.Client, url string) error {
+	body, _, err := fetchPlaylist(client, url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "#EXTM3U" {
+		return fmt.Errorf("response is not an HLS playlist")
+	}
+	return nil
+}
+
+// slateImageExtensions are slate files shown as a still image
+var slateImageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".bmp": true,
+}
+
+// slateSourceName names the filesrc of the slate pipeline, its location is set on the
+// element as gst_parse has its own quoting rules
+const slateSourceName = "slate-source"
+
+// slateDescription returns the pipeline description playing a slate file into the inter
+// channels. The file is read by the filesrc named slateSourceName.
+func slateDescription(path, videoChannel, audioChannel string) string {
+	source := "filesrc name=" + slateSourceName
+	videoSink := fmt.Sprintf("intervideosink channel=%s async=false", videoChannel)
+	audioSink := fmt.Sprintf("interaudiosink channel=%s async=false", audioChannel)
+
+	if slateImageExtensions[strings.ToLower(filepath.Ext(path))] {
+		return fmt.Sprintf("%s ! decodebin ! imagefreeze is-live=true ! videoconvert ! %s "+
+			"audiotestsrc wave=silence is-live=true ! %s", source, videoSink, audioSink)
+	}
+
+	// Video slates loop on EOS, files without audio leave the audio branch unlinked
+	return fmt.Sprintf("%s ! decodebin name=slate "+
+		"slate. ! queue ! videoconvert ! %s "+
+		"slate. ! queue ! audioconvert ! audioresample ! %s", source, videoSink, audioSink)
+}
@@ -0,0 +1,282 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/go-gst/go-gst/gst/app"
+
+	"video-graphic-overlay-gstreamer/internal/color"
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// Renderer draws a graphics overlay in Go. Frames are the size of the video, start out
+// transparent and hold straight (not premultiplied) alpha like GStreamer RGBA, so the
+// image/draw package and font renderers can draw on them directly.
+type Renderer interface {
+	Render(frame *image.NRGBA, ctx TemplateContext) error
+}
+
+// Notifier is implemented by renderers that know when their content changes. They are
+// only rendered when notified and when the video resolution changes, other renderers
+// are rendered every graphics.refresh_ms.
+type Notifier interface {
+	Notify() <-chan struct{}
+}
+
+// RendererFactory creates the renderer of a graphics overlay
+type RendererFactory func(overlay config.OverlayConfig) (Renderer, error)
+
+var (
+	renderersMutex sync.RWMutex
+	renderers      = map[string]RendererFactory{
+		"box": newBoxRenderer,
+	}
+)
+
+// RegisterRenderer makes a renderer available to graphics overlays as graphics.renderer.
+// Registering a name again replaces the renderer for pipelines created afterwards.
+func RegisterRenderer(name string, factory RendererFactory) {
+	renderersMutex.Lock()
+	defer renderersMutex.Unlock()
+	renderers[name] = factory
+}
+
+// NewRenderer creates the renderer a graphics overlay names
+func NewRenderer(overlay config.OverlayConfig) (Renderer, error) {
+	renderersMutex.RLock()
+	factory, ok := renderers[overlay.Graphics.Renderer]
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	renderersMutex.RUnlock()
+
+	if !ok {
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown graphics renderer %q, registered are %s", overlay.Graphics.Renderer, strings.Join(names, ", "))
+	}
+	return factory(overlay)
+}
+
+// createGraphicsLayer builds the bin of a graphics layer: a compositor drawing the
+// frames of an appsrc over the video passing through
+func (p *Pipeline) createGraphicsLayer(layer *overlayLayer, overlay config.OverlayConfig) error {
+	renderer, err := NewRenderer(overlay)
+	if err != nil {
+		return err
+	}
+	layer.renderer = renderer
+	layer.refresh = time.Duration(overlay.Graphics.RefreshMs) * time.Millisecond
+	if layer.refresh <= 0 {
+		layer.refresh = time.Second
+	}
+
+	layer.element, err = p.createGraphicsBin(layer)
+	return err
+}
+
+// createGraphicsBin builds a bin drawing the frames of the layer renderer over the
+// video passing through: a compositor fed by an appsrc
+func (p *Pipeline) createGraphicsBin(layer *overlayLayer) (*gst.Element, error) {
+	layer.redraw = make(chan struct{}, 1)
+
+	compositor, err := gst.NewElement("compositor")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compositor: %w", err)
+	}
+	// The appsrc only pushes changed frames, don't wait for it
+	compositor.SetProperty("ignore-inactive-pads", true)
+
+	convert, err := gst.NewElement("videoconvert")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create graphics converter: %w", err)
+	}
+
+	layer.source, err = app.NewAppSrc()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create graphics appsrc: %w", err)
+	}
+	layer.source.SetProperty("is-live", true)
+	layer.source.SetProperty("format", gst.FormatTime)
+	layer.source.SetProperty("do-timestamp", true)
+
+	bin := gst.NewBin("")
+	if err := bin.AddMany(compositor, convert, layer.source.Element); err != nil {
+		return nil, fmt.Errorf("failed to add graphics elements: %w", err)
+	}
+	if err := compositor.Link(convert); err != nil {
+		return nil, fmt.Errorf("failed to link compositor: %w", err)
+	}
+
+	videoPad := compositor.GetRequestPad("sink_%u")
+	layer.graphicsPad = compositor.GetRequestPad("sink_%u")
+	if videoPad == nil || layer.graphicsPad == nil {
+		return nil, fmt.Errorf("failed to request compositor pads")
+	}
+	videoPad.SetProperty("zorder", uint(0))
+	layer.graphicsPad.SetProperty("zorder", uint(1))
+	if ret := layer.source.GetStaticPad("src").Link(layer.graphicsPad); ret != gst.PadLinkOK {
+		return nil, fmt.Errorf("failed to link graphics appsrc to compositor: %s", ret)
+	}
+
+	if !bin.AddPad(gst.NewGhostPad("sink", videoPad).Pad) ||
+		!bin.AddPad(gst.NewGhostPad("src", convert.GetStaticPad("src")).Pad) {
+		return nil, fmt.Errorf("failed to add graphics bin pads")
+	}
+	return bin.Element, nil
+}
+
+// runGraphics renders a graphics layer until ctx is cancelled
+func (p *Pipeline) runGraphics(ctx context.Context, layer *overlayLayer) {
+	ticker := time.NewTicker(layer.refresh)
+	defer ticker.Stop()
+
+	for {
+		p.renderGraphics(layer)
+
+		// The renderer may have been replaced by an overlay update
+		p.layoutMutex.Lock()
+		renderer := layer.renderer
+		p.layoutMutex.Unlock()
+		tick, notify := ticker.C, (<-chan struct{})(nil)
+		if notifier, ok := renderer.(Notifier); ok {
+			tick, notify = nil, notifier.Notify()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-notify:
+		case <-layer.redraw:
+		}
+	}
+}
+
+// requestRedraw renders a graphics layer again soon, it never blocks
+func (layer *overlayLayer) requestRedraw() {
+	select {
+	case layer.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// renderGraphics renders a frame of a graphics layer and pushes it when it differs
+// from the last one
+func (p *Pipeline) renderGraphics(layer *overlayLayer) {
+	p.layoutMutex.Lock()
+	width, height := layer.videoWidth, layer.videoHeight
+	renderer := layer.renderer
+	p.layoutMutex.Unlock()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	p.textMutex.Lock()
+	now := time.Now()
+	ctx := TemplateContext{Now: now, Started: p.startedAt, Channel: p.name}
+	p.textMutex.Unlock()
+	if ctx.Started.IsZero() {
+		ctx.Started = now
+	}
+
+	frame := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if err := renderer.Render(frame, ctx); err != nil {
+		// Report a failing renderer once, not for every render
+		if err.Error() != layer.lastRenderErr {
+			layer.lastRenderErr = err.Error()
+			p.logger.Warnf("Overlay %s not rendered: %v", layer.name, err)
+		}
+		return
+	}
+	layer.lastRenderErr = ""
+
+	resized := width != layer.frameWidth || height != layer.frameHeight
+	if !resized && bytes.Equal(frame.Pix, layer.lastFrame) {
+		return
+	}
+	if resized {
+		layer.source.SetCaps(gst.NewCapsFromString(fmt.Sprintf(
+			"video/x-raw,format=RGBA,width=%d,height=%d,framerate=0/1", width, height)))
+		layer.frameWidth, layer.frameHeight = width, height
+	}
+
+	// Without a duration the compositor keeps showing the frame until the next one
+	if ret := layer.source.PushBuffer(gst.NewBufferFromBytes(frame.Pix)); ret != gst.FlowOK {
+		p.logger.Debugf("Overlay %s frame not pushed: %s", layer.name, ret)
+		return
+	}
+	layer.lastFrame = frame.Pix
+}
+
+// setRenderer replaces the renderer of a live graphics layer
+func (p *Pipeline) setRenderer(layer *overlayLayer, overlay config.OverlayConfig) {
+	renderer, err := NewRenderer(overlay)
+	if err != nil {
+		p.logger.Warnf("Overlay %s renderer not updated: %v", layer.name, err)
+		return
+	}
+
+	p.layoutMutex.Lock()
+	layer.renderer = renderer
+	p.layoutMutex.Unlock()
+	layer.requestRedraw()
+}
+
+// boxRenderer draws a filled rectangle, e.g. the band behind a lower third
+type boxRenderer struct {
+	position config.PositionConfig
+	width    int
+	height   int
+	color    color.Color
+}
+
+// newBoxRenderer creates the built-in "box" renderer. A zero width or height fills
+// the video in that direction.
+func newBoxRenderer(overlay config.OverlayConfig) (Renderer, error) {
+	box := &boxRenderer{
+		position: overlay.Position,
+		width:    overlay.Graphics.Width,
+		height:   overlay.Graphics.Height,
+		color:    color.Color{R: 255, G: 255, B: 255, A: 255},
+	}
+	if overlay.Graphics.Color != "" {
+		c, err := color.Parse(overlay.Graphics.Color)
+		if err != nil {
+			return nil, fmt.Errorf("invalid box color: %w", err)
+		}
+		box.color = c
+	}
+	if box.width < 0 || box.height < 0 {
+		return nil, fmt.Errorf("box size must not be negative, got %dx%d", box.width, box.height)
+	}
+	return box, nil
+}
+
+// Render draws the box at its position
+func (b *boxRenderer) Render(frame *image.NRGBA, _ TemplateContext) error {
+	width, height := frame.Bounds().Dx(), frame.Bounds().Dy()
+	w, h := b.width, b.height
+	if b.position.Units == "percent" {
+		w, h = w*width/100, h*height/100
+	}
+	if w == 0 {
+		w = width
+	}
+	if h == 0 {
+		h = height
+	}
+
+	x, y := ResolvePosition(b.position, width, height, w, h)
+	draw.Draw(frame, image.Rect(x, y, x+w, y+h), image.NewUniform(b.color), image.Point{}, draw.Src)
+	return nil
+}
@@ -0,0 +1,178 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// attributeValue holds a single raw attribute value from an HLS attribute list
+type attributeValue struct {
+	raw    string
+	quoted bool
+}
+
+// AttributeList represents a parsed RFC 8216 attribute list (section 4.2)
+type AttributeList map[string]attributeValue
+
+// ParseAttributeList parses an attribute list such as
+// BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720
+func ParseAttributeList(s string) (AttributeList, error) {
+	attrs := make(AttributeList)
+	i := 0
+
+	for i < len(s) {
+		// Attribute name: [A-Z0-9-]+
+		start := i
+		for i < len(s) && isAttributeNameChar(s[i]) {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("invalid attribute name at offset %d", start)
+		}
+		name := s[start:i]
+
+		if i >= len(s) || s[i] != '=' {
+			return nil, fmt.Errorf("attribute %s is missing '='", name)
+		}
+		i++
+
+		var value attributeValue
+		if i < len(s) && s[i] == '"' {
+			// Quoted string: no CR, LF or double quote inside
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted string for attribute %s", name)
+			}
+			value = attributeValue{raw: s[i+1 : i+1+end], quoted: true}
+			i += end + 2
+		} else {
+			end := strings.IndexByte(s[i:], ',')
+			if end < 0 {
+				end = len(s) - i
+			}
+			value = attributeValue{raw: s[i : i+end]}
+			i += end
+			if value.raw == "" {
+				return nil, fmt.Errorf("attribute %s has an empty value", name)
+			}
+		}
+
+		if _, exists := attrs[name]; exists {
+			return nil, fmt.Errorf("duplicate attribute %s", name)
+		}
+		attrs[name] = value
+
+		if i < len(s) {
+			if s[i] != ',' {
+				return nil, fmt.Errorf("expected ',' after attribute %s", name)
+			}
+			i++
+			if i == len(s) {
+				return nil, fmt.Errorf("trailing ',' after attribute %s", name)
+			}
+		}
+	}
+
+	return attrs, nil
+}
+
+// isAttributeNameChar reports whether c may appear in an attribute name
+func isAttributeNameChar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-'
+}
+
+// Has reports whether the attribute is present
+func (a AttributeList) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+// QuotedString returns a quoted-string attribute value
+func (a AttributeList) QuotedString(name string) (string, error) {
+	v, ok := a[name]
+	if !ok {
+		return "", fmt.Errorf("missing attribute %s", name)
+	}
+	if !v.quoted {
+		return "", fmt.Errorf("attribute %s must be a quoted string", name)
+	}
+	return v.raw, nil
+}
+
+// Enum returns an enumerated-string attribute value
+func (a AttributeList) Enum(name string) (string, error) {
+	v, ok := a[name]
+	if !ok {
+		return "", fmt.Errorf("missing attribute %s", name)
+	}
+	if v.quoted {
+		return "", fmt.Errorf("attribute %s must not be quoted", name)
+	}
+	return v.raw, nil
+}
+
+// Int returns a decimal-integer attribute value
+func (a AttributeList) Int(name string) (int64, error) {
+	v, err := a.Enum(name)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("attribute %s is not a decimal integer: %q", name, v)
+	}
+	return int64(value), nil
+}
+
+// Float returns a decimal-floating-point attribute value
+func (a AttributeList) Float(name string) (float64, error) {
+	v, err := a.Enum(name)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseFloat(v, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("attribute %s is not a decimal floating point value: %q", name, v)
+	}
+	return value, nil
+}
+
+// Hex returns a hexadecimal-sequence attribute value (0x or 0X prefixed)
+func (a AttributeList) Hex(name string) ([]byte, error) {
+	v, err := a.Enum(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) < 3 || v[0] != '0' || (v[1] != 'x' && v[1] != 'X') {
+		return nil, fmt.Errorf("attribute %s is not a hexadecimal sequence: %q", name, v)
+	}
+	digits := v[2:]
+	if len(digits)%2 != 0 {
+		digits = "0" + digits
+	}
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("attribute %s is not a hexadecimal sequence: %q", name, v)
+	}
+	return data, nil
+}
+
+// Resolution returns a decimal-resolution attribute value such as 1920x1080
+func (a AttributeList) Resolution(name string) (int, int, error) {
+	v, err := a.Enum(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	parts := strings.Split(v, "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("attribute %s is not a decimal resolution: %q", name, v)
+	}
+	width, err1 := strconv.ParseUint(parts[0], 10, 31)
+	height, err2 := strconv.ParseUint(parts[1], 10, 31)
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("attribute %s is not a decimal resolution: %q", name, v)
+	}
+	return int(width), int(height), nil
+}
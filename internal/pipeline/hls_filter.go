@@ -0,0 +1,196 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNoMatchingStream is returned when no variant of a master playlist passes a StreamFilter
+var ErrNoMatchingStream = errors.New("no variant matches the stream filter")
+
+// codecAliases maps common codec names to the sample entries used in CODECS
+var codecAliases = map[string][]string{
+	"h264": {"avc1", "avc3"},
+	"avc":  {"avc1", "avc3"},
+	"h265": {"hvc1", "hev1"},
+	"hevc": {"hvc1", "hev1"},
+	"vp9":  {"vp09"},
+	"av1":  {"av01"},
+	"aac":  {"mp4a"},
+	"ac3":  {"ac-3"},
+	"eac3": {"ec-3"},
+}
+
+// Codec kinds, an allow-list only restricts the kinds it names
+const (
+	codecKindVideo = "video"
+	codecKindAudio = "audio"
+	codecKindOther = "other"
+)
+
+// codecKinds maps sample entries to the kind of media they carry
+var codecKinds = map[string]string{
+	"avc1": codecKindVideo, "avc3": codecKindVideo,
+	"hvc1": codecKindVideo, "hev1": codecKindVideo,
+	"dvh1": codecKindVideo, "dvhe": codecKindVideo,
+	"vp09": codecKindVideo, "av01": codecKindVideo,
+	"mp4a": codecKindAudio, "ac-3": codecKindAudio,
+	"ec-3": codecKindAudio, "ac-4": codecKindAudio,
+	"opus": codecKindAudio, "flac": codecKindAudio,
+}
+
+// StreamFilter restricts which variants of a master playlist may be selected.
+// Zero values are not enforced.
+type StreamFilter struct {
+	MinBitrate   int
+	MaxBitrate   int
+	MaxWidth     int
+	MaxHeight    int
+	MaxFrameRate float64
+	// Codecs is an allow-list of CODECS sample entries ("avc1") or aliases ("h264").
+	// It only restricts the media kinds it names, so "avc1" alone leaves audio unrestricted.
+	Codecs []string
+}
+
+// NoMatchingStreamError explains why every variant was rejected
+type NoMatchingStreamError struct {
+	Filter   StreamFilter
+	Rejected []string
+}
+
+// Error implements the error interface
+func (e *NoMatchingStreamError) Error() string {
+	if len(e.Rejected) == 0 {
+		return fmt.Sprintf("%s: playlist has no variants", ErrNoMatchingStream)
+	}
+	return fmt.Sprintf("%s: %s", ErrNoMatchingStream, strings.Join(e.Rejected, "; "))
+}
+
+// Unwrap allows errors.Is(err, ErrNoMatchingStream)
+func (e *NoMatchingStreamError) Unwrap() error {
+	return ErrNoMatchingStream
+}
+
+// Reject returns why the stream does not pass the filter, or an empty string if it does.
+// Streams that don't advertise a resolution, frame rate or CODECS pass those checks.
+func (f StreamFilter) Reject(stream HLSStream) string {
+	if f.MinBitrate > 0 && stream.Bandwidth < f.MinBitrate {
+		return fmt.Sprintf("bandwidth %d below minimum %d", stream.Bandwidth, f.MinBitrate)
+	}
+	if f.MaxBitrate > 0 && stream.Bandwidth > f.MaxBitrate {
+		return fmt.Sprintf("bandwidth %d above maximum %d", stream.Bandwidth, f.MaxBitrate)
+	}
+	if f.MaxWidth > 0 && stream.Width > f.MaxWidth {
+		return fmt.Sprintf("width %d above maximum %d", stream.Width, f.MaxWidth)
+	}
+	if f.MaxHeight > 0 && stream.Height > f.MaxHeight {
+		return fmt.Sprintf("height %d above maximum %d", stream.Height, f.MaxHeight)
+	}
+	if f.MaxFrameRate > 0 && stream.FrameRate > f.MaxFrameRate {
+		return fmt.Sprintf("frame rate %.3f above maximum %.3f", stream.FrameRate, f.MaxFrameRate)
+	}
+	if codec := f.rejectedCodec(stream.Codecs); codec != "" {
+		return fmt.Sprintf("codec %q not allowed", codec)
+	}
+	return ""
+}
+
+// rejectedCodec returns the first codec of a CODECS attribute that the allow-list rejects
+func (f StreamFilter) rejectedCodec(codecs string) string {
+	if len(f.Codecs) == 0 || codecs == "" {
+		return ""
+	}
+
+	allowed := make(map[string]bool)
+	restricted := make(map[string]bool)
+	for _, codec := range f.Codecs {
+		codec = strings.ToLower(strings.TrimSpace(codec))
+		entries, ok := codecAliases[codec]
+		if !ok {
+			entries = []string{codec}
+		}
+		for _, entry := range entries {
+			allowed[entry] = true
+			restricted[codecKind(entry)] = true
+		}
+	}
+
+	for _, codec := range strings.Split(codecs, ",") {
+		codec = strings.TrimSpace(codec)
+		entry := strings.ToLower(codec)
+		if i := strings.Index(entry, "."); i >= 0 {
+			entry = entry[:i]
+		}
+		if restricted[codecKind(entry)] && !allowed[entry] {
+			return codec
+		}
+	}
+	return ""
+}
+
+// codecKind returns the media kind of a CODECS sample entry
+func codecKind(entry string) string {
+	if kind, ok := codecKinds[entry]; ok {
+		return kind
+	}
+	return codecKindOther
+}
+
+// FilterStreams returns the streams passing the filter, sorted by ascending bandwidth.
+// It returns a *NoMatchingStreamError when none does.
+func (h *HLSMasterPlaylist) FilterStreams(filter StreamFilter) ([]HLSStream, error) {
+	var streams []HLSStream
+	var rejected []string
+	for _, stream := range h.Streams {
+		if reason := filter.Reject(stream); reason != "" {
+			rejected = append(rejected, fmt.Sprintf("%s: %s", stream.URL, reason))
+			continue
+		}
+		streams = append(streams, stream)
+	}
+
+	if len(streams) == 0 {
+		return nil, &NoMatchingStreamError{Filter: filter, Rejected: rejected}
+	}
+
+	sort.SliceStable(streams, func(i, j int) bool {
+		return streams[i].Bandwidth < streams[j].Bandwidth
+	})
+
+	return streams, nil
+}
+
+// SelectBestStreamFiltered selects the best stream by criteria among the streams passing the filter
+func (h *HLSMasterPlaylist) SelectBestStreamFiltered(criteria string, filter StreamFilter) (*HLSStream, error) {
+	streams, err := h.FilterStreams(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := &HLSMasterPlaylist{Streams: streams}
+	return candidates.SelectBestStream(criteria), nil
+}
+
+// Filtered returns a copy of the playlist holding only the variants and I-frame variants
+// passing the filter, the renditions are kept. It returns a *NoMatchingStreamError when
+// no variant passes.
+func (h *HLSMasterPlaylist) Filtered(filter StreamFilter) (*HLSMasterPlaylist, error) {
+	streams, err := h.FilterStreams(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := &HLSMasterPlaylist{
+		Streams:    streams,
+		Renditions: append([]HLSRendition(nil), h.Renditions...),
+		BaseURL:    h.BaseURL,
+	}
+	for _, stream := range h.IFrameStreams {
+		if filter.Reject(stream) == "" {
+			filtered.IFrameStreams = append(filtered.IFrameStreams, stream)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,352 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// liveHoldBackTargets is how many target durations playback trails the end of a live
+// playlist, where the demuxer starts playing (RFC 8216 section 6.3.3)
+const liveHoldBackTargets = 3
+
+// PlaylistIssueType represents the kind of problem found in a live media playlist
+type PlaylistIssueType int
+
+const (
+	PlaylistIssueFetch PlaylistIssueType = iota
+	PlaylistIssueStale
+	PlaylistIssueSequenceGap
+	PlaylistIssueSequenceReset
+	PlaylistIssueTargetDuration
+)
+
+// String returns a string representation of the issue type
+func (t PlaylistIssueType) String() string {
+	switch t {
+	case PlaylistIssueFetch:
+		return "FETCH"
+	case PlaylistIssueStale:
+		return "STALE"
+	case PlaylistIssueSequenceGap:
+		return "SEQUENCE_GAP"
+	case PlaylistIssueSequenceReset:
+		return "SEQUENCE_RESET"
+	case PlaylistIssueTargetDuration:
+		return "TARGET_DURATION"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// PlaylistIssue describes a problem detected while polling a live media playlist
+type PlaylistIssue struct {
+	Type      PlaylistIssueType
+	Message   string
+	URL       string
+	Sequence  int64
+	Timestamp time.Time
+}
+
+// Error implements the error interface
+func (i PlaylistIssue) Error() string {
+	return fmt.Sprintf("[%s] %s: %s", i.Type.String(), i.URL, i.Message)
+}
+
+// LiveWindow describes the segments currently advertised by a live media playlist
+type LiveWindow struct {
+	FirstSequence  int64
+	LastSequence   int64
+	SegmentCount   int
+	Duration       time.Duration
+	TargetDuration time.Duration
+	EndList        bool
+	LastChange     time.Time
+	LastFetch      time.Time
+}
+
+// PlaylistInspector polls a live media playlist, tracks its sliding window and
+// reports stale playlists, sequence gaps and target duration violations
+type PlaylistInspector struct {
+	url           string
+	client        *http.Client
+	logger        logrus.FieldLogger
+	staleFactor   float64
+	issueCallback func(PlaylistIssue)
+	cueCallback   func(CueEvent)
+
+	mutex        sync.RWMutex
+	last         *HLSMediaPlaylist
+	window       LiveWindow
+	checkedUpTo  int64
+	staleWarned  bool
+	issueCounts  map[PlaylistIssueType]int
+	pollInterval time.Duration
+	pendingCues  []CueEvent
+}
+
+// NewPlaylistInspector creates a new inspector for the media playlist at url
+func NewPlaylistInspector(url string, logger logrus.FieldLogger) *PlaylistInspector {
+	return &PlaylistInspector{
+		url:         url,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		logger:      logger,
+		staleFactor: 1.5,
+		checkedUpTo: -1,
+		issueCounts: make(map[PlaylistIssueType]int),
+	}
+}
+
+// SetIssueCallback sets a callback for detected playlist issues
+func (pi *PlaylistInspector) SetIssueCallback(callback func(PlaylistIssue)) {
+	pi.issueCallback = callback
+}
+
+// SetCueCallback sets a callback for ad markers found in newly seen segments
+func (pi *PlaylistInspector) SetCueCallback(callback func(CueEvent)) {
+	pi.cueCallback = callback
+}
+
+// SetStaleFactor sets how many target durations a playlist may stay unchanged before it is reported stale
+func (pi *PlaylistInspector) SetStaleFactor(factor float64) {
+	pi.staleFactor = factor
+}
+
+// Start starts polling in a separate goroutine until the context is cancelled
+func (pi *PlaylistInspector) Start(ctx context.Context) {
+	go pi.run(ctx)
+}
+
+// run polls the playlist using the reload intervals of RFC 8216 section 6.3.4
+func (pi *PlaylistInspector) run(ctx context.Context) {
+	pi.logger.Infof("Inspecting live media playlist %s", pi.URL())
+
+	for {
+		interval := pi.poll(time.Now())
+		if interval <= 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// poll fetches the playlist once and returns the delay before the next reload,
+// or zero when the playlist has ended or cannot be inspected
+func (pi *PlaylistInspector) poll(now time.Time) time.Duration {
+	url := pi.URL()
+	playlist, err := ParseHLSMediaPlaylist(url, pi.logger)
+	if errors.Is(err, ErrMasterPlaylist) {
+		// Polling again would fail the same way, the variant playbin3 plays is unknown
+		pi.logger.Warnf("%s is a master playlist, enable parse_master_playlist to inspect the played variant", url)
+		return 0
+	}
+	if err != nil {
+		pi.report(PlaylistIssue{
+			Type:      PlaylistIssueFetch,
+			Message:   err.Error(),
+			URL:       url,
+			Timestamp: now,
+		})
+		// Retry quickly but do not hammer the origin
+		pi.mutex.RLock()
+		interval := pi.window.TargetDuration / 2
+		pi.mutex.RUnlock()
+		if interval <= 0 {
+			interval = time.Second
+		}
+		return interval
+	}
+
+	for _, issue := range pi.Inspect(playlist, now) {
+		pi.report(issue)
+	}
+
+	for _, cue := range pi.TakeCues() {
+		pi.logger.Debugf("Playlist cue: %v", cue)
+		if pi.cueCallback != nil {
+			pi.cueCallback(cue)
+		}
+	}
+
+	if playlist.EndList {
+		pi.logger.Infof("Media playlist %s has ended, stopping inspection", url)
+		return 0
+	}
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	return pi.pollInterval
+}
+
+// Inspect compares a freshly loaded playlist with the previous one and returns the issues found
+func (pi *PlaylistInspector) Inspect(playlist *HLSMediaPlaylist, now time.Time) []PlaylistIssue {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	var issues []PlaylistIssue
+	issue := func(issueType PlaylistIssueType, sequence int64, format string, args ...interface{}) {
+		issues = append(issues, PlaylistIssue{
+			Type:      issueType,
+			Message:   fmt.Sprintf(format, args...),
+			URL:       pi.url,
+			Sequence:  sequence,
+			Timestamp: now,
+		})
+	}
+
+	targetDuration := time.Duration(playlist.TargetDuration) * time.Second
+	first := playlist.MediaSequence
+	last := playlist.LastSequenceNumber()
+	changed := pi.last == nil || last != pi.last.LastSequenceNumber() || playlist.EndList != pi.last.EndList
+
+	// Segments of the first window are playing or past already, as are those of a
+	// window after a reset. Only segments added afterwards are checked and cued.
+	prime := pi.checkedUpTo < 0
+	if pi.last != nil {
+		previousLast := pi.last.LastSequenceNumber()
+		switch {
+		case first < pi.last.MediaSequence:
+			issue(PlaylistIssueSequenceReset, first,
+				"media sequence went backwards from %d to %d", pi.last.MediaSequence, first)
+			prime = true
+		case first > previousLast+1:
+			issue(PlaylistIssueSequenceGap, previousLast+1,
+				"segments %d to %d expired before they were seen", previousLast+1, first-1)
+		}
+	}
+
+	if prime {
+		pi.checkedUpTo = last
+	}
+
+	// Only check segments that were not checked on a previous reload
+	var start time.Duration
+	total := playlist.Duration()
+	for _, segment := range playlist.Segments {
+		edgeOffset := total - start
+		start += time.Duration(segment.Duration * float64(time.Second))
+		if segment.SequenceNumber <= pi.checkedUpTo {
+			continue
+		}
+		if int(math.Round(segment.Duration)) > playlist.TargetDuration {
+			issue(PlaylistIssueTargetDuration, segment.SequenceNumber,
+				"segment %d lasts %.3fs, exceeding target duration %ds",
+				segment.SequenceNumber, segment.Duration, playlist.TargetDuration)
+		}
+
+		cues, err := segment.Cues()
+		if err != nil {
+			pi.logger.Warnf("Invalid ad marker before segment %d: %v", segment.SequenceNumber, err)
+		}
+		for _, cue := range cues {
+			cue.Timestamp = now
+			cue.EdgeOffset = edgeOffset
+			pi.pendingCues = append(pi.pendingCues, cue)
+		}
+	}
+	if last > pi.checkedUpTo {
+		pi.checkedUpTo = last
+	}
+
+	if changed {
+		pi.window.LastChange = now
+		pi.staleWarned = false
+		pi.pollInterval = targetDuration
+	} else {
+		// Unchanged playlists are reloaded after half the target duration
+		pi.pollInterval = targetDuration / 2
+		unchanged := now.Sub(pi.window.LastChange)
+		limit := time.Duration(pi.staleFactor * float64(targetDuration))
+		if !playlist.EndList && unchanged > limit && !pi.staleWarned {
+			issue(PlaylistIssueStale, last,
+				"playlist unchanged for %s (limit %s), last segment %d",
+				unchanged.Round(time.Millisecond), limit, last)
+			pi.staleWarned = true
+		}
+	}
+	if pi.pollInterval <= 0 {
+		pi.pollInterval = time.Second
+	}
+
+	pi.last = playlist
+	pi.window.FirstSequence = first
+	pi.window.LastSequence = last
+	pi.window.SegmentCount = len(playlist.Segments)
+	pi.window.Duration = playlist.Duration()
+	pi.window.TargetDuration = targetDuration
+	pi.window.EndList = playlist.EndList
+	pi.window.LastFetch = now
+
+	for _, i := range issues {
+		pi.issueCounts[i.Type]++
+	}
+
+	return issues
+}
+
+// TakeCues returns the cues found by Inspect since the last call
+func (pi *PlaylistInspector) TakeCues() []CueEvent {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+	cues := pi.pendingCues
+	pi.pendingCues = nil
+	return cues
+}
+
+// report logs an issue and forwards it to the issue callback
+func (pi *PlaylistInspector) report(issue PlaylistIssue) {
+	if issue.Type == PlaylistIssueFetch {
+		pi.mutex.Lock()
+		pi.issueCounts[issue.Type]++
+		pi.mutex.Unlock()
+	}
+
+	pi.logger.Warnf("Playlist issue: %v", issue)
+
+	if pi.issueCallback != nil {
+		pi.issueCallback(issue)
+	}
+}
+
+// SetURL switches inspection to another media playlist, e.g. after a variant switch.
+// The live window is tracked from scratch for the new playlist. Variants share media
+// sequence numbers, so segments already checked are not checked (or cued) again.
+func (pi *PlaylistInspector) SetURL(url string) {
+	pi.mutex.Lock()
+	defer pi.mutex.Unlock()
+
+	pi.url = url
+	pi.last = nil
+	pi.staleWarned = false
+}
+
+// URL returns the URL of the inspected media playlist
+func (pi *PlaylistInspector) URL() string {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	return pi.url
+}
+
+// Window returns the current live window
+func (pi *PlaylistInspector) Window() LiveWindow {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	return pi.window
+}
+
+// IssueCount returns how many issues of the given type have been detected
+func (pi *PlaylistInspector) IssueCount(issueType PlaylistIssueType) int {
+	pi.mutex.RLock()
+	defer pi.mutex.RUnlock()
+	return pi.issueCounts[issueType]
+}
@@ -0,0 +1,504 @@
+package pipeline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrMasterPlaylist is returned when a master playlist is parsed as a media playlist
+var ErrMasterPlaylist = errors.New("this is a master playlist")
+
+// HLSByteRange represents an EXT-X-BYTERANGE sub-range of a segment resource
+type HLSByteRange struct {
+	Length int64
+	Offset int64
+}
+
+// HLSKey represents the encryption parameters of an EXT-X-KEY tag
+type HLSKey struct {
+	Method            string
+	URI               string
+	IV                []byte
+	KeyFormat         string
+	KeyFormatVersions string
+}
+
+// HLSSegment represents a single media segment of a media playlist
+type HLSSegment struct {
+	URL                   string
+	Duration              float64
+	Title                 string
+	SequenceNumber        int64
+	DiscontinuitySequence int64
+	Discontinuity         bool
+	ProgramDateTime       time.Time
+	ByteRange             *HLSByteRange
+	Key                   *HLSKey
+	// Ad markers preceding the segment
+	CueOut         bool
+	CueOutDuration float64
+	CueIn          bool
+	DateRanges     []HLSDateRange
+	// Ad marker tags that could not be parsed, reported by Cues
+	InvalidMarkers []error
+}
+
+// HLSDateRange represents an EXT-X-DATERANGE tag
+type HLSDateRange struct {
+	ID              string
+	Class           string
+	StartDate       time.Time
+	EndDate         time.Time
+	Duration        float64
+	PlannedDuration float64
+	EndOnNext       bool
+	// Binary splice_info_section carried in SCTE35-CMD, SCTE35-OUT and SCTE35-IN
+	SCTE35Cmd []byte
+	SCTE35Out []byte
+	SCTE35In  []byte
+}
+
+// HLSMediaPlaylist represents a parsed media playlist
+type HLSMediaPlaylist struct {
+	URL                   string
+	Version               int
+	TargetDuration        int
+	MediaSequence         int64
+	DiscontinuitySequence int64
+	PlaylistType          string
+	EndList               bool
+	Segments              []HLSSegment
+}
+
+// ParseHLSMediaPlaylist fetches and parses an HLS media playlist
+func ParseHLSMediaPlaylist(playlistURL string, logger logrus.FieldLogger) (*HLSMediaPlaylist, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	body, baseURL, err := fetchPlaylist(client, playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch media playlist: %w", err)
+	}
+	defer body.Close()
+
+	playlist, err := ParseHLSMediaPlaylistFrom(body, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("Parsed media playlist %s: %d segments starting at sequence %d",
+		playlistURL, len(playlist.Segments), playlist.MediaSequence)
+
+	return playlist, nil
+}
+
+// ParseHLSMediaPlaylistFrom parses media playlist content read from r.
+// Relative segment and key URIs are resolved against playlistURL.
+func ParseHLSMediaPlaylistFrom(r io.Reader, playlistURL string) (*HLSMediaPlaylist, error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist URL: %w", err)
+	}
+
+	playlist := &HLSMediaPlaylist{URL: playlistURL}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	targetDurationSeen := false
+
+	// State carried from tags to the next segment URI
+	var segment HLSSegment
+	var segmentLine int
+	var key *HLSKey
+	var programDateTime time.Time
+	var lastRange *HLSByteRange
+	var lastRangeURL string
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if lineNum == 1 {
+			if line != "#EXTM3U" {
+				return nil, fmt.Errorf("line 1: playlist must start with #EXTM3U")
+			}
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+
+		switch {
+		case line == "":
+			continue
+		case tag == "#EXT-X-STREAM-INF":
+			return nil, fmt.Errorf("line %d: #EXT-X-STREAM-INF found, %w", lineNum, ErrMasterPlaylist)
+		case tag == "#EXT-X-VERSION":
+			version, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid #EXT-X-VERSION %q", lineNum, value)
+			}
+			playlist.Version = version
+		case tag == "#EXT-X-TARGETDURATION":
+			duration, err := strconv.Atoi(value)
+			if err != nil || duration < 0 {
+				return nil, fmt.Errorf("line %d: invalid #EXT-X-TARGETDURATION %q", lineNum, value)
+			}
+			playlist.TargetDuration = duration
+			targetDurationSeen = true
+		case tag == "#EXT-X-MEDIA-SEQUENCE":
+			if len(playlist.Segments) > 0 || segmentLine != 0 {
+				return nil, fmt.Errorf("line %d: #EXT-X-MEDIA-SEQUENCE must appear before the first segment", lineNum)
+			}
+			sequence, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || sequence < 0 {
+				return nil, fmt.Errorf("line %d: invalid #EXT-X-MEDIA-SEQUENCE %q", lineNum, value)
+			}
+			playlist.MediaSequence = sequence
+		case tag == "#EXT-X-DISCONTINUITY-SEQUENCE":
+			sequence, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || sequence < 0 {
+				return nil, fmt.Errorf("line %d: invalid #EXT-X-DISCONTINUITY-SEQUENCE %q", lineNum, value)
+			}
+			playlist.DiscontinuitySequence = sequence
+		case tag == "#EXT-X-PLAYLIST-TYPE":
+			if value != "EVENT" && value != "VOD" {
+				return nil, fmt.Errorf("line %d: invalid #EXT-X-PLAYLIST-TYPE %q", lineNum, value)
+			}
+			playlist.PlaylistType = value
+		case tag == "#EXT-X-ENDLIST":
+			playlist.EndList = true
+		case tag == "#EXTINF":
+			durationStr, title, _ := strings.Cut(value, ",")
+			duration, err := strconv.ParseFloat(durationStr, 64)
+			if err != nil || duration < 0 {
+				return nil, fmt.Errorf("line %d: invalid #EXTINF duration %q", lineNum, durationStr)
+			}
+			segment.Duration = duration
+			segment.Title = title
+			segmentLine = lineNum
+		case tag == "#EXT-X-DISCONTINUITY":
+			segment.Discontinuity = true
+		case tag == "#EXT-X-PROGRAM-DATE-TIME":
+			t, err := parseProgramDateTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid #EXT-X-PROGRAM-DATE-TIME %q", lineNum, value)
+			}
+			programDateTime = t
+			segment.ProgramDateTime = t
+		case tag == "#EXT-X-BYTERANGE":
+			byteRange, err := parseByteRange(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: #EXT-X-BYTERANGE: %w", lineNum, err)
+			}
+			segment.ByteRange = byteRange
+		case tag == "#EXT-X-KEY":
+			parsed, err := parseKey(value, base)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: #EXT-X-KEY: %w", lineNum, err)
+			}
+			key = parsed
+		case tag == "#EXT-X-CUE-OUT":
+			// Packagers write many variants of ad markers, a bad one must not cost the
+			// rest of the playlist
+			duration, err := parseCueOutDuration(value)
+			if err != nil {
+				segment.InvalidMarkers = append(segment.InvalidMarkers,
+					fmt.Errorf("line %d: #EXT-X-CUE-OUT: %w", lineNum, err))
+				continue
+			}
+			segment.CueOut = true
+			segment.CueOutDuration = duration
+		case tag == "#EXT-X-CUE-IN":
+			segment.CueIn = true
+		case tag == "#EXT-X-DATERANGE":
+			dateRange, err := parseDateRange(value)
+			if err != nil {
+				segment.InvalidMarkers = append(segment.InvalidMarkers,
+					fmt.Errorf("line %d: #EXT-X-DATERANGE: %w", lineNum, err))
+				continue
+			}
+			segment.DateRanges = append(segment.DateRanges, *dateRange)
+		case strings.HasPrefix(line, "#"):
+			// Other tags and comments are ignored
+			continue
+		default:
+			if segmentLine == 0 {
+				return nil, fmt.Errorf("line %d: segment URI without preceding #EXTINF", lineNum)
+			}
+
+			if segment.URL, err = resolveURI(base, line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+
+			// A byte range without offset continues the previous sub-range of the same resource
+			if segment.ByteRange != nil && segment.ByteRange.Offset < 0 {
+				if lastRange == nil || lastRangeURL != segment.URL {
+					return nil, fmt.Errorf("line %d: #EXT-X-BYTERANGE without offset does not follow a range of the same resource", lineNum)
+				}
+				segment.ByteRange.Offset = lastRange.Offset + lastRange.Length
+			}
+			lastRange, lastRangeURL = segment.ByteRange, segment.URL
+
+			// Program date time extrapolates over following segments until a discontinuity
+			if segment.ProgramDateTime.IsZero() && !programDateTime.IsZero() && !segment.Discontinuity {
+				segment.ProgramDateTime = programDateTime
+			}
+			if !segment.ProgramDateTime.IsZero() {
+				programDateTime = segment.ProgramDateTime.Add(time.Duration(segment.Duration * float64(time.Second)))
+			} else {
+				programDateTime = time.Time{}
+			}
+
+			segment.SequenceNumber = playlist.MediaSequence + int64(len(playlist.Segments))
+			segment.DiscontinuitySequence = playlist.DiscontinuitySequence
+			if n := len(playlist.Segments); n > 0 {
+				segment.DiscontinuitySequence = playlist.Segments[n-1].DiscontinuitySequence
+			}
+			if segment.Discontinuity {
+				segment.DiscontinuitySequence++
+			}
+			if key != nil && key.Method != "NONE" {
+				segment.Key = key
+			}
+
+			playlist.Segments = append(playlist.Segments, segment)
+			segment = HLSSegment{}
+			segmentLine = 0
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading playlist: %w", err)
+	}
+
+	if lineNum == 0 {
+		return nil, fmt.Errorf("playlist is empty")
+	}
+
+	if segmentLine != 0 {
+		return nil, fmt.Errorf("line %d: #EXTINF is not followed by a URI", segmentLine)
+	}
+
+	if !targetDurationSeen {
+		return nil, fmt.Errorf("missing required #EXT-X-TARGETDURATION tag")
+	}
+
+	return playlist, nil
+}
+
+// parseCueOutDuration parses the break duration of an EXT-X-CUE-OUT tag, which
+// packagers write either as a bare number or as DURATION=<seconds>
+func parseCueOutDuration(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if !strings.Contains(value, "=") {
+		duration, err := strconv.ParseFloat(value, 64)
+		if err != nil || duration < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return duration, nil
+	}
+
+	attrs, err := ParseAttributeList(value)
+	if err != nil {
+		return 0, err
+	}
+	if !attrs.Has("DURATION") {
+		return 0, nil
+	}
+	return attrs.Float("DURATION")
+}
+
+// parseDateRange parses the attribute list of an EXT-X-DATERANGE tag
+func parseDateRange(attrList string) (*HLSDateRange, error) {
+	attrs, err := ParseAttributeList(attrList)
+	if err != nil {
+		return nil, err
+	}
+
+	dateRange := &HLSDateRange{}
+	if dateRange.ID, err = attrs.QuotedString("ID"); err != nil {
+		return nil, err
+	}
+
+	startDate, err := attrs.QuotedString("START-DATE")
+	if err != nil {
+		return nil, err
+	}
+	if dateRange.StartDate, err = parseProgramDateTime(startDate); err != nil {
+		return nil, fmt.Errorf("START-DATE: %w", err)
+	}
+
+	if attrs.Has("CLASS") {
+		if dateRange.Class, err = attrs.QuotedString("CLASS"); err != nil {
+			return nil, err
+		}
+	}
+
+	if attrs.Has("END-DATE") {
+		endDate, err := attrs.QuotedString("END-DATE")
+		if err != nil {
+			return nil, err
+		}
+		if dateRange.EndDate, err = parseProgramDateTime(endDate); err != nil {
+			return nil, fmt.Errorf("END-DATE: %w", err)
+		}
+	}
+
+	for name, duration := range map[string]*float64{
+		"DURATION":         &dateRange.Duration,
+		"PLANNED-DURATION": &dateRange.PlannedDuration,
+	} {
+		if attrs.Has(name) {
+			if *duration, err = attrs.Float(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for name, section := range map[string]*[]byte{
+		"SCTE35-CMD": &dateRange.SCTE35Cmd,
+		"SCTE35-OUT": &dateRange.SCTE35Out,
+		"SCTE35-IN":  &dateRange.SCTE35In,
+	} {
+		if attrs.Has(name) {
+			if *section, err = attrs.Hex(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if attrs.Has("END-ON-NEXT") {
+		endOnNext, err := attrs.Enum("END-ON-NEXT")
+		if err != nil {
+			return nil, err
+		}
+		if endOnNext != "YES" {
+			return nil, fmt.Errorf("END-ON-NEXT must be YES, got %q", endOnNext)
+		}
+		dateRange.EndOnNext = true
+	}
+
+	return dateRange, nil
+}
+
+// parseProgramDateTime parses an ISO 8601 date with optional fractional seconds
+func parseProgramDateTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// parseByteRange parses <n>[@<o>]; a missing offset is returned as -1
+func parseByteRange(value string) (*HLSByteRange, error) {
+	lengthStr, offsetStr, hasOffset := strings.Cut(value, "@")
+	length, err := strconv.ParseInt(lengthStr, 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid length %q", lengthStr)
+	}
+
+	byteRange := &HLSByteRange{Length: length, Offset: -1}
+	if hasOffset {
+		offset, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset %q", offsetStr)
+		}
+		byteRange.Offset = offset
+	}
+
+	return byteRange, nil
+}
+
+// parseKey parses the attribute list of an EXT-X-KEY tag
+func parseKey(attrList string, base *url.URL) (*HLSKey, error) {
+	attrs, err := ParseAttributeList(attrList)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &HLSKey{}
+	if key.Method, err = attrs.Enum("METHOD"); err != nil {
+		return nil, err
+	}
+
+	switch key.Method {
+	case "NONE":
+		if attrs.Has("URI") {
+			return nil, fmt.Errorf("URI must not be present with METHOD=NONE")
+		}
+		return key, nil
+	case "AES-128", "SAMPLE-AES", "SAMPLE-AES-CTR":
+	default:
+		return nil, fmt.Errorf("unknown METHOD %s", key.Method)
+	}
+
+	uri, err := attrs.QuotedString("URI")
+	if err != nil {
+		return nil, err
+	}
+	if key.URI, err = resolveURI(base, uri); err != nil {
+		return nil, err
+	}
+
+	if attrs.Has("IV") {
+		if key.IV, err = attrs.Hex("IV"); err != nil {
+			return nil, err
+		}
+		if len(key.IV) != 16 {
+			return nil, fmt.Errorf("IV must be 128 bits, got %d", len(key.IV)*8)
+		}
+	}
+
+	if attrs.Has("KEYFORMAT") {
+		if key.KeyFormat, err = attrs.QuotedString("KEYFORMAT"); err != nil {
+			return nil, err
+		}
+	}
+	if attrs.Has("KEYFORMATVERSIONS") {
+		if key.KeyFormatVersions, err = attrs.QuotedString("KEYFORMATVERSIONS"); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// LastSequenceNumber returns the media sequence number of the last segment
+func (m *HLSMediaPlaylist) LastSequenceNumber() int64 {
+	return m.MediaSequence + int64(len(m.Segments)) - 1
+}
+
+// Duration returns the total duration of all segments in the playlist
+func (m *HLSMediaPlaylist) Duration() time.Duration {
+	var total float64
+	for _, segment := range m.Segments {
+		total += segment.Duration
+	}
+	return time.Duration(total * float64(time.Second))
+}
+
+// TargetDurationViolations returns the segments whose duration, rounded to the
+// nearest integer, exceeds the target duration
+func (m *HLSMediaPlaylist) TargetDurationViolations() []HLSSegment {
+	var violations []HLSSegment
+	for _, segment := range m.Segments {
+		if int(math.Round(segment.Duration)) > m.TargetDuration {
+			violations = append(violations, segment)
+		}
+	}
+	return violations
+}
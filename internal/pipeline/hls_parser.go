@@ -3,10 +3,10 @@ package pipeline
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net/http"
-	"regexp"
+	"net/url"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -15,177 +15,458 @@ import (
 
 // HLSStream represents a single stream variant from the master playlist
 type HLSStream struct {
-	URL           string
-	Bandwidth     int
-	Resolution    string
-	Width         int
-	Height        int
-	Codecs        string
-	FrameRate     float64
+	URL              string
+	Bandwidth        int
+	Resolution       string
+	Width            int
+	Height           int
+	Codecs           string
+	FrameRate        float64
 	AverageBandwidth int
+	// Rendition group references
+	Audio          string
+	Video          string
+	Subtitles      string
+	ClosedCaptions string
+}
+
+// Rendition types used by EXT-X-MEDIA
+const (
+	RenditionTypeAudio          = "AUDIO"
+	RenditionTypeVideo          = "VIDEO"
+	RenditionTypeSubtitles      = "SUBTITLES"
+	RenditionTypeClosedCaptions = "CLOSED-CAPTIONS"
+)
+
+// HLSRendition represents an alternate rendition from an EXT-X-MEDIA tag
+type HLSRendition struct {
+	Type            string
+	GroupID         string
+	Name            string
+	Language        string
+	AssocLanguage   string
+	URI             string
+	Default         bool
+	Autoselect      bool
+	Forced          bool
+	InstreamID      string
+	Characteristics string
+	Channels        string
 }
 
 // HLSMasterPlaylist represents the parsed master playlist
 type HLSMasterPlaylist struct {
-	Streams []HLSStream
-	BaseURL string
+	Streams       []HLSStream
+	Renditions    []HLSRendition
+	IFrameStreams []HLSStream
+	BaseURL       string
 }
 
-// parseResolution parses resolution string like "1920x1080" into width and height
-func parseResolution(resolution string) (int, int) {
-	parts := strings.Split(resolution, "x")
-	if len(parts) != 2 {
-		return 0, 0
-	}
-	
-	width, err1 := strconv.Atoi(parts[0])
-	height, err2 := strconv.Atoi(parts[1])
-	
-	if err1 != nil || err2 != nil {
-		return 0, 0
-	}
-	
-	return width, height
-}
+// ParseHLSMasterPlaylist fetches and parses an HLS master playlist and returns stream information
+func ParseHLSMasterPlaylist(playlistURL string, logger logrus.FieldLogger) (*HLSMasterPlaylist, error) {
+	logger.Infof("Parsing HLS master playlist: %s", playlistURL)
 
-// parseBandwidth parses bandwidth string and returns integer value
-func parseBandwidth(bandwidth string) int {
-	if bandwidth == "" {
-		return 0
-	}
-	
-	// Remove any non-numeric characters and parse
-	re := regexp.MustCompile(`\d+`)
-	matches := re.FindAllString(bandwidth, -1)
-	if len(matches) == 0 {
-		return 0
+	// Create HTTP client with timeout
+	client := &http.Client{
+		Timeout: 30 * time.Second,
 	}
-	
-	value, err := strconv.Atoi(matches[0])
+
+	// Fetch the master playlist
+	body, baseURL, err := fetchPlaylist(client, playlistURL)
 	if err != nil {
-		return 0
+		return nil, fmt.Errorf("failed to fetch master playlist: %w", err)
 	}
-	
-	return value
-}
+	defer body.Close()
 
-// parseFrameRate parses frame rate string and returns float value
-func parseFrameRate(frameRate string) float64 {
-	if frameRate == "" {
-		return 0
-	}
-	
-	value, err := strconv.ParseFloat(frameRate, 64)
+	playlist, err := ParseHLSMasterPlaylistFrom(body, baseURL)
 	if err != nil {
-		return 0
+		return nil, err
 	}
-	
-	return value
-}
 
-// ParseHLSMasterPlaylist parses an HLS master playlist and returns stream information
-func ParseHLSMasterPlaylist(url string, logger *logrus.Logger) (*HLSMasterPlaylist, error) {
-	logger.Infof("Parsing HLS master playlist: %s", url)
-	
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	for _, stream := range playlist.Streams {
+		logger.Infof("Found stream: %dx%d, %d bps, %s",
+			stream.Width, stream.Height,
+			stream.Bandwidth, stream.URL)
 	}
-	
-	// Fetch the master playlist
-	resp, err := client.Get(url)
+	logger.Infof("Parsed %d streams from master playlist", len(playlist.Streams))
+
+	return playlist, nil
+}
+
+// fetchPlaylist issues a GET for a playlist and returns its body together with the
+// final URL after redirects, which relative URIs must be resolved against
+func fetchPlaylist(client *http.Client, playlistURL string) (io.ReadCloser, string, error) {
+	resp, err := client.Get(playlistURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch master playlist: %w", err)
+		return nil, "", err
 	}
-	defer resp.Body.Close()
-	
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d", resp.StatusCode)
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("HTTP error: %d", resp.StatusCode)
+	}
+
+	baseURL := playlistURL
+	if resp.Request != nil && resp.Request.URL != nil {
+		baseURL = resp.Request.URL.String()
+	}
+
+	return resp.Body, baseURL, nil
+}
+
+// ParseHLSMasterPlaylistFrom parses master playlist content read from r.
+// Relative variant URIs are resolved against playlistURL.
+func ParseHLSMasterPlaylistFrom(r io.Reader, playlistURL string) (*HLSMasterPlaylist, error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist URL: %w", err)
 	}
-	
-	// Parse the playlist content
-	scanner := bufio.NewScanner(resp.Body)
+
+	scanner := bufio.NewScanner(r)
 	var streams []HLSStream
-	var currentStream HLSStream
-	var baseURL string
-	
-	// Extract base URL for relative URLs
-	urlParts := strings.Split(url, "/")
-	if len(urlParts) > 0 {
-		baseURL = strings.Join(urlParts[:len(urlParts)-1], "/") + "/"
-	}
-	
+	var renditions []HLSRendition
+	var iframeStreams []HLSStream
+	var pending *HLSStream
+	pendingLine := 0
+	lineNum := 0
+
 	for scanner.Scan() {
+		lineNum++
 		line := strings.TrimSpace(scanner.Text())
-		
-		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
-			// Parse stream info line
-			info := strings.TrimPrefix(line, "#EXT-X-STREAM-INF:")
-			currentStream = HLSStream{}
-			
-			// Parse attributes
-			attrs := strings.Split(info, ",")
-			for _, attr := range attrs {
-				parts := strings.SplitN(attr, "=", 2)
-				if len(parts) != 2 {
-					continue
-				}
-				
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				
-				switch key {
-				case "BANDWIDTH":
-					currentStream.Bandwidth = parseBandwidth(value)
-				case "AVERAGE-BANDWIDTH":
-					currentStream.AverageBandwidth = parseBandwidth(value)
-				case "RESOLUTION":
-					currentStream.Resolution = value
-					currentStream.Width, currentStream.Height = parseResolution(value)
-				case "CODECS":
-					currentStream.Codecs = value
-				case "FRAME-RATE":
-					currentStream.FrameRate = parseFrameRate(value)
-				}
+
+		if lineNum == 1 {
+			if line != "#EXTM3U" {
+				return nil, fmt.Errorf("line 1: playlist must start with #EXTM3U")
 			}
-		} else if strings.HasPrefix(line, "http") || strings.HasPrefix(line, "/") {
-			// This is a stream URL
-			if currentStream.Bandwidth > 0 {
-				if strings.HasPrefix(line, "/") {
-					currentStream.URL = baseURL + strings.TrimPrefix(line, "/")
-				} else {
-					currentStream.URL = line
-				}
-				streams = append(streams, currentStream)
-				logger.Infof("Found stream: %dx%d, %d bps, %s", 
-					currentStream.Width, currentStream.Height, 
-					currentStream.Bandwidth, currentStream.URL)
+			continue
+		}
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			if pending != nil {
+				return nil, fmt.Errorf("line %d: #EXT-X-STREAM-INF on line %d is not followed by a URI", lineNum, pendingLine)
+			}
+			stream, err := parseStreamInf(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: #EXT-X-STREAM-INF: %w", lineNum, err)
+			}
+			pending = stream
+			pendingLine = lineNum
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			rendition, err := parseMedia(strings.TrimPrefix(line, "#EXT-X-MEDIA:"), base)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: #EXT-X-MEDIA: %w", lineNum, err)
+			}
+			renditions = append(renditions, *rendition)
+		case strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF:"):
+			stream, err := parseIFrameStreamInf(strings.TrimPrefix(line, "#EXT-X-I-FRAME-STREAM-INF:"), base)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: #EXT-X-I-FRAME-STREAM-INF: %w", lineNum, err)
+			}
+			iframeStreams = append(iframeStreams, *stream)
+		case strings.HasPrefix(line, "#"):
+			// Other tags and comments are ignored
+			continue
+		default:
+			// A URI line belongs to the preceding EXT-X-STREAM-INF tag
+			if pending == nil {
+				continue
+			}
+			uri, err := resolveURI(base, line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
 			}
+			pending.URL = uri
+			streams = append(streams, *pending)
+			pending = nil
 		}
 	}
-	
+
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading playlist: %w", err)
 	}
-	
+
+	if lineNum == 0 {
+		return nil, fmt.Errorf("playlist is empty")
+	}
+
+	if pending != nil {
+		return nil, fmt.Errorf("line %d: #EXT-X-STREAM-INF is not followed by a URI", pendingLine)
+	}
+
 	if len(streams) == 0 {
 		return nil, fmt.Errorf("no streams found in master playlist")
 	}
-	
-	logger.Infof("Parsed %d streams from master playlist", len(streams))
-	
+
 	return &HLSMasterPlaylist{
-		Streams: streams,
-		BaseURL: baseURL,
+		Streams:       streams,
+		Renditions:    renditions,
+		IFrameStreams: iframeStreams,
+		BaseURL:       base.ResolveReference(&url.URL{Path: "./"}).String(),
 	}, nil
 }
 
+// parseStreamInf parses the attribute list of an EXT-X-STREAM-INF tag
+func parseStreamInf(attrList string) (*HLSStream, error) {
+	attrs, err := ParseAttributeList(attrList)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &HLSStream{}
+
+	bandwidth, err := attrs.Int("BANDWIDTH")
+	if err != nil {
+		return nil, err
+	}
+	stream.Bandwidth = int(bandwidth)
+
+	if attrs.Has("AVERAGE-BANDWIDTH") {
+		averageBandwidth, err := attrs.Int("AVERAGE-BANDWIDTH")
+		if err != nil {
+			return nil, err
+		}
+		stream.AverageBandwidth = int(averageBandwidth)
+	}
+
+	if attrs.Has("RESOLUTION") {
+		stream.Width, stream.Height, err = attrs.Resolution("RESOLUTION")
+		if err != nil {
+			return nil, err
+		}
+		stream.Resolution = fmt.Sprintf("%dx%d", stream.Width, stream.Height)
+	}
+
+	if attrs.Has("CODECS") {
+		stream.Codecs, err = attrs.QuotedString("CODECS")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if attrs.Has("FRAME-RATE") {
+		stream.FrameRate, err = attrs.Float("FRAME-RATE")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, group := range map[string]*string{
+		"AUDIO":     &stream.Audio,
+		"VIDEO":     &stream.Video,
+		"SUBTITLES": &stream.Subtitles,
+	} {
+		if attrs.Has(name) {
+			if *group, err = attrs.QuotedString(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// CLOSED-CAPTIONS is either a quoted group ID or the enumerated value NONE
+	if attrs.Has("CLOSED-CAPTIONS") {
+		if captions, err := attrs.Enum("CLOSED-CAPTIONS"); err == nil {
+			if captions != "NONE" {
+				return nil, fmt.Errorf("attribute CLOSED-CAPTIONS must be a quoted string or NONE")
+			}
+		} else if stream.ClosedCaptions, err = attrs.QuotedString("CLOSED-CAPTIONS"); err != nil {
+			return nil, err
+		}
+	}
+
+	return stream, nil
+}
+
+// parseIFrameStreamInf parses the attribute list of an EXT-X-I-FRAME-STREAM-INF tag
+func parseIFrameStreamInf(attrList string, base *url.URL) (*HLSStream, error) {
+	stream, err := parseStreamInf(attrList)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, _ := ParseAttributeList(attrList)
+	uri, err := attrs.QuotedString("URI")
+	if err != nil {
+		return nil, err
+	}
+	if stream.URL, err = resolveURI(base, uri); err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// parseMedia parses the attribute list of an EXT-X-MEDIA tag
+func parseMedia(attrList string, base *url.URL) (*HLSRendition, error) {
+	attrs, err := ParseAttributeList(attrList)
+	if err != nil {
+		return nil, err
+	}
+
+	rendition := &HLSRendition{}
+
+	if rendition.Type, err = attrs.Enum("TYPE"); err != nil {
+		return nil, err
+	}
+	switch rendition.Type {
+	case RenditionTypeAudio, RenditionTypeVideo, RenditionTypeSubtitles, RenditionTypeClosedCaptions:
+	default:
+		return nil, fmt.Errorf("unknown rendition TYPE %s", rendition.Type)
+	}
+
+	if rendition.GroupID, err = attrs.QuotedString("GROUP-ID"); err != nil {
+		return nil, err
+	}
+	if rendition.Name, err = attrs.QuotedString("NAME"); err != nil {
+		return nil, err
+	}
+
+	for name, value := range map[string]*string{
+		"LANGUAGE":        &rendition.Language,
+		"ASSOC-LANGUAGE":  &rendition.AssocLanguage,
+		"INSTREAM-ID":     &rendition.InstreamID,
+		"CHARACTERISTICS": &rendition.Characteristics,
+		"CHANNELS":        &rendition.Channels,
+	} {
+		if attrs.Has(name) {
+			if *value, err = attrs.QuotedString(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for name, value := range map[string]*bool{
+		"DEFAULT":    &rendition.Default,
+		"AUTOSELECT": &rendition.Autoselect,
+		"FORCED":     &rendition.Forced,
+	} {
+		if attrs.Has(name) {
+			flag, err := attrs.Enum(name)
+			if err != nil {
+				return nil, err
+			}
+			if flag != "YES" && flag != "NO" {
+				return nil, fmt.Errorf("attribute %s must be YES or NO", name)
+			}
+			*value = flag == "YES"
+		}
+	}
+
+	if attrs.Has("URI") {
+		if rendition.Type == RenditionTypeClosedCaptions {
+			return nil, fmt.Errorf("CLOSED-CAPTIONS renditions must not have a URI")
+		}
+		uri, err := attrs.QuotedString("URI")
+		if err != nil {
+			return nil, err
+		}
+		if rendition.URI, err = resolveURI(base, uri); err != nil {
+			return nil, err
+		}
+	}
+
+	if rendition.Type == RenditionTypeClosedCaptions && rendition.InstreamID == "" {
+		return nil, fmt.Errorf("CLOSED-CAPTIONS renditions require INSTREAM-ID")
+	}
+
+	return rendition, nil
+}
+
+// resolveURI resolves a possibly relative URI against the playlist URL
+func resolveURI(base *url.URL, uri string) (string, error) {
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid URI %q: %w", uri, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// RenditionGroup returns the renditions of the given type that belong to groupID
+func (h *HLSMasterPlaylist) RenditionGroup(renditionType, groupID string) []HLSRendition {
+	var group []HLSRendition
+	for _, rendition := range h.Renditions {
+		if rendition.Type == renditionType && rendition.GroupID == groupID {
+			group = append(group, rendition)
+		}
+	}
+	return group
+}
+
+// SelectRendition picks a rendition of the given type from groupID.
+// A matching name takes precedence over a matching language; without a match
+// the DEFAULT=YES rendition is returned, or the first one in the group.
+// An empty groupID searches all renditions of the type.
+func (h *HLSMasterPlaylist) SelectRendition(renditionType, groupID, language, name string) *HLSRendition {
+	var candidates []HLSRendition
+	if groupID != "" {
+		candidates = h.RenditionGroup(renditionType, groupID)
+	} else {
+		for _, rendition := range h.Renditions {
+			if rendition.Type == renditionType {
+				candidates = append(candidates, rendition)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if name != "" {
+		for i := range candidates {
+			if strings.EqualFold(candidates[i].Name, name) {
+				return &candidates[i]
+			}
+		}
+	}
+
+	if language != "" {
+		for i := range candidates {
+			if languageMatches(candidates[i].Language, language) {
+				return &candidates[i]
+			}
+		}
+	}
+
+	for i := range candidates {
+		if candidates[i].Default {
+			return &candidates[i]
+		}
+	}
+
+	return &candidates[0]
+}
+
+// HasDemuxedRenditions reports whether the stream references renditions of the
+// given type that are delivered from their own media playlists
+func (h *HLSMasterPlaylist) HasDemuxedRenditions(stream *HLSStream, renditionType string) bool {
+	var groupID string
+	switch renditionType {
+	case RenditionTypeAudio:
+		groupID = stream.Audio
+	case RenditionTypeVideo:
+		groupID = stream.Video
+	case RenditionTypeSubtitles:
+		groupID = stream.Subtitles
+	}
+	if groupID == "" {
+		return false
+	}
+	for _, rendition := range h.RenditionGroup(renditionType, groupID) {
+		if rendition.URI != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // SelectBestStream selects the best quality stream based on criteria
 func (h *HLSMasterPlaylist) SelectBestStream(criteria string) *HLSStream {
 	if len(h.Streams) == 0 {
 		return nil
 	}
-	
+
 	switch strings.ToLower(criteria) {
 	case "highest":
 		return h.SelectHighestQuality()
@@ -203,19 +484,19 @@ func (h *HLSMasterPlaylist) SelectHighestQuality() *HLSStream {
 	if len(h.Streams) == 0 {
 		return nil
 	}
-	
+
 	// Sort by resolution (width * height), then by bandwidth
 	sort.Slice(h.Streams, func(i, j int) bool {
 		resolutionI := h.Streams[i].Width * h.Streams[i].Height
 		resolutionJ := h.Streams[j].Width * h.Streams[j].Height
-		
+
 		if resolutionI != resolutionJ {
 			return resolutionI > resolutionJ
 		}
-		
+
 		return h.Streams[i].Bandwidth > h.Streams[j].Bandwidth
 	})
-	
+
 	return &h.Streams[0]
 }
 
@@ -224,19 +505,19 @@ func (h *HLSMasterPlaylist) SelectLowestQuality() *HLSStream {
 	if len(h.Streams) == 0 {
 		return nil
 	}
-	
+
 	// Sort by resolution (width * height), then by bandwidth
 	sort.Slice(h.Streams, func(i, j int) bool {
 		resolutionI := h.Streams[i].Width * h.Streams[i].Height
 		resolutionJ := h.Streams[j].Width * h.Streams[j].Height
-		
+
 		if resolutionI != resolutionJ {
 			return resolutionI < resolutionJ
 		}
-		
+
 		return h.Streams[i].Bandwidth < h.Streams[j].Bandwidth
 	})
-	
+
 	return &h.Streams[0]
 }
 
@@ -245,12 +526,12 @@ func (h *HLSMasterPlaylist) SelectByBandwidth() *HLSStream {
 	if len(h.Streams) == 0 {
 		return nil
 	}
-	
+
 	// Sort by bandwidth
 	sort.Slice(h.Streams, func(i, j int) bool {
 		return h.Streams[i].Bandwidth > h.Streams[j].Bandwidth
 	})
-	
+
 	return &h.Streams[0]
 }
 
@@ -268,18 +549,89 @@ func (h *HLSMasterPlaylist) GetStreamByResolution(width, height int) *HLSStream
 func (h *HLSMasterPlaylist) ListStreams() []HLSStream {
 	streams := make([]HLSStream, len(h.Streams))
 	copy(streams, h.Streams)
-	
+
 	// Sort by resolution (width * height), then by bandwidth
 	sort.Slice(streams, func(i, j int) bool {
 		resolutionI := streams[i].Width * streams[i].Height
 		resolutionJ := streams[j].Width * streams[j].Height
-		
+
 		if resolutionI != resolutionJ {
 			return resolutionI > resolutionJ
 		}
-		
+
 		return streams[i].Bandwidth > streams[j].Bandwidth
 	})
-	
+
 	return streams
 }
+
+// Encode writes the playlist as a master playlist. URIs are written as parsed, resolved
+// against the original playlist URL, so the playlist plays from another location.
+func (h *HLSMasterPlaylist) Encode() string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+
+	for _, rendition := range h.Renditions {
+		attrs := []string{
+			"TYPE=" + rendition.Type,
+			fmt.Sprintf(`GROUP-ID="%s"`, rendition.GroupID),
+			fmt.Sprintf(`NAME="%s"`, rendition.Name),
+		}
+		for _, attr := range []struct{ name, value string }{
+			{"LANGUAGE", rendition.Language},
+			{"ASSOC-LANGUAGE", rendition.AssocLanguage},
+			{"INSTREAM-ID", rendition.InstreamID},
+			{"CHARACTERISTICS", rendition.Characteristics},
+			{"CHANNELS", rendition.Channels},
+			{"URI", rendition.URI},
+		} {
+			if attr.value != "" {
+				attrs = append(attrs, fmt.Sprintf(`%s="%s"`, attr.name, attr.value))
+			}
+		}
+		for _, flag := range []struct {
+			name  string
+			value bool
+		}{{"DEFAULT", rendition.Default}, {"AUTOSELECT", rendition.Autoselect}, {"FORCED", rendition.Forced}} {
+			if flag.value {
+				attrs = append(attrs, flag.name+"=YES")
+			}
+		}
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:%s\n", strings.Join(attrs, ","))
+	}
+
+	for _, stream := range h.Streams {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n%s\n", encodeStreamInf(stream), stream.URL)
+	}
+	for _, stream := range h.IFrameStreams {
+		fmt.Fprintf(&b, "#EXT-X-I-FRAME-STREAM-INF:%s,URI=\"%s\"\n", encodeStreamInf(stream), stream.URL)
+	}
+
+	return b.String()
+}
+
+// encodeStreamInf returns the attribute list of an EXT-X-STREAM-INF tag
+func encodeStreamInf(stream HLSStream) string {
+	attrs := []string{fmt.Sprintf("BANDWIDTH=%d", stream.Bandwidth)}
+	if stream.AverageBandwidth > 0 {
+		attrs = append(attrs, fmt.Sprintf("AVERAGE-BANDWIDTH=%d", stream.AverageBandwidth))
+	}
+	if stream.Width > 0 && stream.Height > 0 {
+		attrs = append(attrs, fmt.Sprintf("RESOLUTION=%dx%d", stream.Width, stream.Height))
+	}
+	if stream.FrameRate > 0 {
+		attrs = append(attrs, fmt.Sprintf("FRAME-RATE=%.3f", stream.FrameRate))
+	}
+	for _, attr := range []struct{ name, value string }{
+		{"CODECS", stream.Codecs},
+		{"AUDIO", stream.Audio},
+		{"VIDEO", stream.Video},
+		{"SUBTITLES", stream.Subtitles},
+		{"CLOSED-CAPTIONS", stream.ClosedCaptions},
+	} {
+		if attr.value != "" {
+			attrs = append(attrs, fmt.Sprintf(`%s="%s"`, attr.name, attr.value))
+		}
+	}
+	return strings.Join(attrs, ",")
+}
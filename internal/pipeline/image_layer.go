@@ -0,0 +1,210 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// setupImage sets the image of a new image layer and plays animated images from a
+// probe on its video pad, timed by the frames passing the layer
+func (p *Pipeline) setupImage(layer *overlayLayer, img config.ImageOverlay) {
+	p.setImage(layer, img)
+
+	layer.element.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if buffer := info.GetBuffer(); buffer != nil {
+				if pts := buffer.PresentationTimestamp().AsDuration(); pts != nil {
+					p.advanceImage(layer, *pts)
+				}
+			}
+			return gst.PadProbeOK
+		})
+}
+
+// setImage loads the image of an image layer when it changed and sizes it. The image
+// and animation frames are decoded once and kept in memory, showing a frame only
+// copies its pixels to the element. Still images in formats Go doesn't decode are
+// loaded by the element.
+func (p *Pipeline) setImage(layer *overlayLayer, img config.ImageOverlay) {
+	p.layoutMutex.Lock()
+	current := layer.imageCfg
+	p.layoutMutex.Unlock()
+	if img.Path == current.Path && img.Loop == current.Loop && img.FrameRate == current.FrameRate {
+		// Only the size or alpha changed
+		p.layoutMutex.Lock()
+		layer.imageCfg = img
+		p.resizeImage(layer)
+		p.layoutMutex.Unlock()
+		return
+	}
+
+	anim, err := LoadImageAnimation(img)
+	if err != nil {
+		p.logger.Warnf("Overlay %s animation not loaded, showing it as a still image: %v", layer.name, err)
+		anim = nil
+	}
+	var frames []*image.NRGBA
+	if anim != nil {
+		if frames, err = decodeAnimationFrames(anim); err != nil {
+			p.logger.Warnf("Overlay %s animation not decoded, showing it as a still image: %v", layer.name, err)
+		}
+	}
+	if len(frames) > 0 {
+		p.logger.Infof("Overlay %s plays %d frames in %v", layer.name, len(frames), anim.Duration())
+	} else {
+		anim, frames = nil, nil
+		if still, err := decodeImageFile(img.Path); err == nil {
+			frames = []*image.NRGBA{toNRGBA(still)}
+		} else {
+			// gdkpixbufoverlay reads more formats, it loads the image itself
+			p.logger.Debugf("Overlay %s image loaded by the element: %v", layer.name, err)
+		}
+	}
+	width, height := 0, 0
+	if len(frames) > 0 {
+		width, height = frames[0].Rect.Dx(), frames[0].Rect.Dy()
+	}
+
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	if frames == nil {
+		layer.element.SetProperty("location", img.Path)
+	}
+	layer.imageCfg = img
+	layer.imageAnim, layer.imageSources = anim, frames
+	layer.nativeWidth, layer.nativeHeight = width, height
+	layer.animFrame, layer.animStart = 0, -1
+	// Size and show the new image even when the size is the same
+	layer.imageFrames = nil
+	p.resizeImage(layer)
+}
+
+// resizeImage sizes an image layer for the video reaching it, layoutMutex must be held.
+// The element scales the image at once, pre-scaled frames of better quality replace the
+// native ones when they are ready.
+func (p *Pipeline) resizeImage(layer *overlayLayer) {
+	width, height := ImageSize(layer.imageCfg, layer.nativeWidth, layer.nativeHeight, layer.videoWidth, layer.videoHeight)
+	if width == layer.imageWidth && height == layer.imageHeight && layer.imageFrames != nil {
+		return
+	}
+	layer.imageWidth, layer.imageHeight = width, height
+	// Zero keeps the size of an image that can't be read
+	layer.element.SetProperty("overlay-width", max(width, 0))
+	layer.element.SetProperty("overlay-height", max(height, 0))
+
+	layer.imageGeneration++
+	layer.imageFrames = layer.imageSources
+	if width > 0 && (width != layer.nativeWidth || height != layer.nativeHeight) {
+		go p.prescaleImage(layer, layer.imageGeneration, layer.imageSources, width, height)
+	}
+	p.showImageFrame(layer)
+}
+
+// prescaleImage scales the frames of an image layer to width x height and shows them,
+// unless the layer was resized or its image replaced meanwhile
+func (p *Pipeline) prescaleImage(layer *overlayLayer, generation int, sources []*image.NRGBA, width, height int) {
+	frames := make([]*image.NRGBA, len(sources))
+	for i, source := range sources {
+		frames[i] = ScaleImage(source, width, height)
+	}
+
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	if generation != layer.imageGeneration {
+		return
+	}
+	layer.imageFrames = frames
+	p.showImageFrame(layer)
+	p.logger.Debugf("Overlay %s image pre-scaled to %dx%d", layer.name, width, height)
+}
+
+// showImageFrame shows the current image frame on the element unless a wipe shows its
+// own steps, layoutMutex must be held
+func (p *Pipeline) showImageFrame(layer *overlayLayer) {
+	if layer.wipeFrames != nil && layer.wipeStep < wipeSteps {
+		return
+	}
+	if frame := layer.currentImage(); frame != nil {
+		setOverlayImage(layer.element, frame)
+	}
+}
+
+// currentImage returns the image or the animation frame a layer shows at rest, nil
+// without one, layoutMutex must be held
+func (layer *overlayLayer) currentImage() *image.NRGBA {
+	if layer.animFrame < len(layer.imageFrames) {
+		return layer.imageFrames[layer.animFrame]
+	}
+	return nil
+}
+
+// advanceImage shows the animation frame of an image layer at pts
+func (p *Pipeline) advanceImage(layer *overlayLayer, pts time.Duration) {
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	anim := layer.imageAnim
+	if anim == nil {
+		return
+	}
+	if layer.animStart < 0 {
+		layer.animStart = pts
+	}
+
+	frame := anim.FrameAt(pts - layer.animStart)
+	if frame == layer.animFrame {
+		return
+	}
+	layer.animFrame = frame
+	// A running wipe ends on the current frame
+	p.showImageFrame(layer)
+}
+
+// decodeAnimationFrames returns the frames of an animation, PNG sequence files are
+// decoded
+func decodeAnimationFrames(anim *ImageAnimation) ([]*image.NRGBA, error) {
+	if anim.Files == nil {
+		return anim.Frames, nil
+	}
+	frames := make([]*image.NRGBA, len(anim.Files))
+	for i, file := range anim.Files {
+		img, err := decodeImageFile(file)
+		if err != nil {
+			return nil, err
+		}
+		frames[i] = toNRGBA(img)
+	}
+	return frames, nil
+}
+
+// toNRGBA returns an image as NRGBA with its origin at zero
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	return nrgba
+}
+
+// decodeImageFile decodes an image file
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return img, nil
+}
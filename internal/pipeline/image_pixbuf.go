@@ -0,0 +1,50 @@
+package pipeline
+
+/*
+#cgo pkg-config: gstreamer-1.0
+#include <gst/gst.h>
+
+// set_overlay_pixels sets a copy of RGBA pixels as the pixbuf of a gdkpixbufoverlay.
+// The plugin registers GdkPixbuf, so the pixbuf is made through GObject without the
+// gdk-pixbuf headers.
+static void
+set_overlay_pixels (GstElement * overlay, const guint8 * pixels, gint width,
+    gint height, gint stride)
+{
+  GType type;
+  GBytes *bytes;
+  GObject *pixbuf;
+
+  type = g_type_from_name ("GdkPixbuf");
+  g_return_if_fail (type != 0);
+
+  bytes = g_bytes_new (pixels, (gsize) stride * (height - 1) + width * 4);
+  pixbuf = g_object_new (type, "colorspace", 0, "n-channels", 4, "has-alpha", TRUE,
+      "bits-per-sample", 8, "width", width, "height", height, "rowstride", stride,
+      "pixel-bytes", bytes, NULL);
+  g_bytes_unref (bytes);
+
+  g_object_set (overlay, "pixbuf", pixbuf, NULL);
+  g_object_unref (pixbuf);
+}
+*/
+import "C"
+
+import (
+	"image"
+	"unsafe"
+
+	"github.com/go-gst/go-gst/gst"
+)
+
+// setOverlayImage shows a decoded image on a gdkpixbufoverlay. The pixels are copied
+// and not decoded again, so it is cheap enough for streaming threads.
+func setOverlayImage(overlay *gst.Element, img *image.NRGBA) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if width == 0 || height == 0 {
+		return
+	}
+	pixels := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y):]
+	C.set_overlay_pixels((*C.GstElement)(overlay.Unsafe()), (*C.guint8)(unsafe.Pointer(&pixels[0])),
+		C.gint(width), C.gint(height), C.gint(img.Stride))
+}
@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// ImageSize returns the size an image of imageWidth x imageHeight is drawn at on a video
+// of videoWidth x videoHeight. Sizes relative to the video keep the native size until
+// the video size is known.
+func ImageSize(img config.ImageOverlay, imageWidth, imageHeight, videoWidth, videoHeight int) (width, height int) {
+	if imageWidth <= 0 || imageHeight <= 0 {
+		return imageWidth, imageHeight
+	}
+	w, h := float64(imageWidth), float64(imageHeight)
+
+	factor := 1.0
+	switch {
+	case img.WidthPercent > 0:
+		if videoWidth <= 0 {
+			return imageWidth, imageHeight
+		}
+		factor = float64(videoWidth) * img.WidthPercent / 100 / w
+	case img.Width > 0 && img.Height > 0:
+		factor = math.Min(float64(img.Width)/w, float64(img.Height)/h)
+	case img.Width > 0:
+		factor = float64(img.Width) / w
+	case img.Height > 0:
+		factor = float64(img.Height) / h
+	case img.Scale > 0:
+		factor = img.Scale
+	}
+	return max(int(math.Round(w*factor)), 1), max(int(math.Round(h*factor)), 1)
+}
+
+// ScaleImage resamples an image to width x height with a Catmull-Rom filter. When
+// shrinking the filter is widened, so every source pixel contributes and small logos
+// don't alias. Colors are filtered premultiplied, so transparent pixels don't darken
+// the edges.
+func ScaleImage(img image.Image, width, height int) *image.NRGBA {
+	src := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	pixels := make([]float64, len(src.Pix))
+	for i := 0; i < len(src.Pix); i += 4 {
+		alpha := float64(src.Pix[i+3]) / 255
+		pixels[i] = float64(src.Pix[i]) * alpha
+		pixels[i+1] = float64(src.Pix[i+1]) * alpha
+		pixels[i+2] = float64(src.Pix[i+2]) * alpha
+		pixels[i+3] = float64(src.Pix[i+3])
+	}
+
+	// Rows first, then columns
+	rows := make([]float64, width*srcHeight*4)
+	for x, weights := range resampleWeights(width, srcWidth) {
+		for y := 0; y < srcHeight; y++ {
+			out := (y*width + x) * 4
+			for _, tap := range weights {
+				in := (y*srcWidth + tap.index) * 4
+				for c := 0; c < 4; c++ {
+					rows[out+c] += pixels[in+c] * tap.weight
+				}
+			}
+		}
+	}
+	scaled := make([]float64, width*height*4)
+	for y, weights := range resampleWeights(height, srcHeight) {
+		for x := 0; x < width; x++ {
+			out := (y*width + x) * 4
+			for _, tap := range weights {
+				in := (tap.index*width + x) * 4
+				for c := 0; c < 4; c++ {
+					scaled[out+c] += rows[in+c] * tap.weight
+				}
+			}
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(dst.Pix); i += 4 {
+		dst.Pix[i+3] = clampByte(scaled[i+3])
+		if dst.Pix[i+3] == 0 {
+			continue
+		}
+		for c := 0; c < 3; c++ {
+			dst.Pix[i+c] = clampByte(scaled[i+c] * 255 / scaled[i+3])
+		}
+	}
+	return dst
+}
+
+// resampleTap is the weight of one source pixel in a destination pixel
+type resampleTap struct {
+	index  int
+	weight float64
+}
+
+// resampleWeights returns the source pixels each destination pixel is filtered from,
+// pixels past the edges repeat the edge pixel
+func resampleWeights(dstSize, srcSize int) [][]resampleTap {
+	scale := float64(srcSize) / float64(dstSize)
+	filterScale := math.Max(scale, 1)
+	radius := 2 * filterScale
+
+	weights := make([][]resampleTap, dstSize)
+	for i := range weights {
+		center := (float64(i)+0.5)*scale - 0.5
+		var taps []resampleTap
+		total := 0.0
+		for j := int(math.Ceil(center - radius)); j <= int(math.Floor(center+radius)); j++ {
+			weight := catmullRom((float64(j) - center) / filterScale)
+			if weight == 0 {
+				continue
+			}
+			total += weight
+			index := min(max(j, 0), srcSize-1)
+			if n := len(taps); n > 0 && taps[n-1].index == index {
+				taps[n-1].weight += weight
+			} else {
+				taps = append(taps, resampleTap{index: index, weight: weight})
+			}
+		}
+		for j := range taps {
+			taps[j].weight /= total
+		}
+		weights[i] = taps
+	}
+	return weights
+}
+
+// catmullRom is the Catmull-Rom cubic, zero from a distance of 2
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return (1.5*x-2.5)*x*x + 1
+	case x < 2:
+		return ((-0.5*x+2.5)*x-4)*x + 2
+	default:
+		return 0
+	}
+}
+
+// clampByte rounds a channel value into 0-255
+func clampByte(v float64) uint8 {
+	return uint8(math.Round(math.Min(math.Max(v, 0), 255)))
+}
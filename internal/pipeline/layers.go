@@ -0,0 +1,216 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/go-gst/go-gst/gst/app"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// ErrUnknownLayer is returned for updates of an overlay layer that doesn't exist
+var ErrUnknownLayer = errors.New("unknown overlay layer")
+
+// overlayLayer is the overlay element of one layer, a bin for graphics layers. Layer elements are chained in the
+// video branch in drawing order, so later layers are drawn on top.
+type overlayLayer struct {
+	name    string
+	kind    string // "text", "image", "graphics", "ticker" or "subtitles"
+	element *gst.Element
+	bar     *gst.Element  // Graphics bin drawing the bar of a ticker in front of its element
+	refresh time.Duration // Interval of text template renders or ticker item loads, zero when rendered per frame
+
+	// Text template, guarded by the pipeline textMutex
+	textTemplate *TextTemplate
+	textStyle    TextStyle
+	lastText     string
+	lastTextErr  string
+	textFade     float64 // Share faded out by a transition
+	textCover    float64 // Share covered by a wipe transition
+	coverEdge    string
+	ticker       *tickerState
+	subtitles    *subtitleState
+
+	// Placement, guarded by the pipeline layoutMutex
+	layout      config.PositionConfig
+	videoWidth  int // Resolution of the video reaching the layer
+	videoHeight int
+	imageWidth  int // Size of the overlay image as drawn
+	imageHeight int
+	barHeight   int      // Height of the bar of a ticker
+	textHeight  int      // Height of the text of a ticker, zero until rendered
+	renderer    Renderer // Renderer of a graphics layer
+	schedule    *Schedule
+	enabled     bool    // Shown by configuration
+	visible     bool    // Shown by configuration and schedule
+	onAir       bool    // Inside a schedule window
+	alpha       float64 // Alpha of a visible image
+
+	// Transitions, guarded by the pipeline layoutMutex
+	transitionIn  *Transition
+	transitionOut *Transition
+	animation     *animation // Running transition, nil at rest
+	shown         float64    // Share shown by the last transition step
+	slideX        int        // Offset of a slide from the rest position
+	slideY        int
+	wipeFrames    map[string][]*image.NRGBA // Image wipe steps by edge
+	wipeStep      int                       // Step shown, wipeSteps for the image itself
+
+	// Image and animation, guarded by the pipeline layoutMutex
+	imageCfg        config.ImageOverlay
+	imageAnim       *ImageAnimation // Nil for a still image
+	imageSources    []*image.NRGBA  // Decoded image or animation frames
+	imageFrames     []*image.NRGBA  // Frames shown, the sources or pre-scaled copies
+	imageGeneration int             // Counts resizes, pre-scaled frames of older ones are dropped
+	nativeWidth     int             // Size of the decoded frames
+	nativeHeight    int
+	animStart       time.Duration // Timestamp of the first frame, negative until it arrived
+	animFrame       int
+
+	// Graphics frames, only used by the render goroutine of the layer
+	source        *app.Source
+	graphicsPad   *gst.Pad // Compositor pad the frames are drawn with
+	redraw        chan struct{}
+	lastFrame     []byte
+	frameWidth    int
+	frameHeight   int
+	lastRenderErr string
+}
+
+// createLayers creates the elements of the overlay layers. Disabled layers start
+// hidden, so they can be shown without rebuilding the pipeline. A disabled layer that
+// cannot be built is left out with a warning.
+func (p *Pipeline) createLayers(overlay config.OverlayConfig) error {
+	p.layers = nil
+	for _, layerCfg := range overlay.LayerList() {
+		layer, err := p.createLayer(layerCfg)
+		if err != nil && !layerCfg.Enabled {
+			p.logger.Warnf("Hidden overlay layer %s not built: %v", layerCfg.Name, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("overlay layer %q: %w", layerCfg.Name, err)
+		}
+		if layer != nil {
+			p.layers = append(p.layers, layer)
+		}
+	}
+	return nil
+}
+
+// createLayer creates the overlay element of a layer, nil for types without one
+func (p *Pipeline) createLayer(layerCfg config.LayerConfig) (*overlayLayer, error) {
+	cfg := layerCfg.OverlayConfig
+	layer := &overlayLayer{name: layerCfg.Name, kind: cfg.Type}
+
+	var err error
+	switch cfg.Type {
+	case "text":
+		layer.element, err = gst.NewElement("textoverlay")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create textoverlay: %w", err)
+		}
+		// Configure text overlay, the template is rendered now and while running
+		layer.element.SetProperty("font-desc", fmt.Sprintf("%s %d", cfg.Text.FontFamily, cfg.Text.FontSize))
+		if err := p.setupTextStyle(layer, cfg.Text); err != nil {
+			return nil, err
+		}
+		if err := p.setupTextTemplate(layer, cfg.Text); err != nil {
+			return nil, err
+		}
+		if !cfg.Text.PerFrame {
+			layer.refresh = time.Duration(cfg.Text.RefreshMs) * time.Millisecond
+			if layer.refresh <= 0 {
+				layer.refresh = time.Second
+			}
+		}
+		if err := p.setupPosition(layer, cfg); err != nil {
+			return nil, err
+		}
+		p.logger.Infof("Text overlay %s configured successfully", layer.name)
+	case "image":
+		layer.element, err = gst.NewElement("gdkpixbufoverlay")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gdkpixbufoverlay: %w", err)
+		}
+		p.setupImage(layer, cfg.Image)
+		layer.element.SetProperty("alpha", cfg.Image.Alpha)
+		if err := p.setupPosition(layer, cfg); err != nil {
+			return nil, err
+		}
+		p.logger.Infof("Image overlay %s configured successfully", layer.name)
+	case "graphics":
+		if err := p.createGraphicsLayer(layer, cfg); err != nil {
+			return nil, err
+		}
+		if err := p.setupPosition(layer, cfg); err != nil {
+			return nil, err
+		}
+		p.logger.Infof("Graphics overlay %s configured with renderer %s", layer.name, cfg.Graphics.Renderer)
+	case "ticker":
+		if err := p.createTickerLayer(layer, cfg); err != nil {
+			return nil, err
+		}
+		if err := p.setupPosition(layer, cfg); err != nil {
+			return nil, err
+		}
+		p.logger.Infof("Ticker overlay %s configured with %s items", layer.name, cfg.Ticker.Source)
+	case "subtitles":
+		if err := p.createSubtitlesLayer(layer, cfg); err != nil {
+			return nil, err
+		}
+		if err := p.setupPosition(layer, cfg); err != nil {
+			return nil, err
+		}
+		p.logger.Infof("Subtitles overlay %s configured with %s cues", layer.name, cfg.Subtitles.Source)
+	default:
+		p.logger.Warnf("Overlay %s: type %q is not supported, use \"graphics\" for overlays drawn in Go", layer.name, cfg.Type)
+		return nil, nil
+	}
+
+	layer.schedule, err = NewSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	layer.alpha = cfg.Image.Alpha
+	if err := p.setupTransitions(layer, cfg); err != nil {
+		return nil, err
+	}
+	layer.enabled = cfg.Enabled
+	p.updateVisibility(layer, true)
+	return layer, nil
+}
+
+// layerElements returns the overlay elements in drawing order
+func (p *Pipeline) layerElements() []*gst.Element {
+	elements := make([]*gst.Element, 0, len(p.layers))
+	for _, layer := range p.layers {
+		if layer.bar != nil {
+			elements = append(elements, layer.bar)
+		}
+		elements = append(elements, layer.element)
+	}
+	return elements
+}
+
+// videoPad returns the name of the pad the video enters the layer element by
+func (layer *overlayLayer) videoPad() string {
+	if layer.kind == "text" || layer.kind == "ticker" || layer.kind == "subtitles" {
+		return "video_sink"
+	}
+	return "sink"
+}
+
+// layer returns the layer with the given name, nil if it wasn't built
+func (p *Pipeline) layer(name string) *overlayLayer {
+	for _, layer := range p.layers {
+		if layer.name == name {
+			return layer
+		}
+	}
+	return nil
+}
@@ -5,12 +5,15 @@ import (
 	"strings"
 	"time"
 
+	"video-graphic-overlay-gstreamer/internal/color"
 	"video-graphic-overlay-gstreamer/internal/config"
 )
 
 // OverlayManager handles graphic overlays
 type OverlayManager struct {
-	config *config.OverlayConfig
+	config      *config.OverlayConfig
+	videoWidth  int
+	videoHeight int
 }
 
 // NewOverlayManager creates a new overlay manager
@@ -20,12 +23,34 @@ func NewOverlayManager(cfg *config.OverlayConfig) *OverlayManager {
 	}
 }
 
+// SetVideoSize sets the resolution overlays are positioned on
+func (o *OverlayManager) SetVideoSize(width, height int) {
+	o.videoWidth = width
+	o.videoHeight = height
+}
+
 // GetPipelineString returns the pipeline string for overlay
 func (o *OverlayManager) GetPipelineString() string {
 	if !o.config.Enabled {
 		return ""
 	}
 
+	// Layers are chained, so later layers are drawn on top
+	var layers []string
+	for _, layer := range o.config.LayerList() {
+		if !layer.Enabled {
+			continue
+		}
+		manager := &OverlayManager{config: &layer.OverlayConfig, videoWidth: o.videoWidth, videoHeight: o.videoHeight}
+		if element := manager.getLayerString(); element != "" {
+			layers = append(layers, element)
+		}
+	}
+	return strings.Join(layers, " ! ")
+}
+
+// getLayerString returns the pipeline string of a single overlay
+func (o *OverlayManager) getLayerString() string {
 	switch o.config.Type {
 	case "text":
 		return o.getTextOverlayString()
@@ -44,16 +69,28 @@ func (o *OverlayManager) getTextOverlayString() string {
 	
 	// Calculate position based on anchor
 	xpos, ypos := o.calculatePosition()
+
+	// Unreadable colors fall back to white text without a background
+	style, err := ParseTextStyle(o.config.Text)
+	if err != nil {
+		style = TextStyle{Color: color.Color{R: 255, G: 255, B: 255, A: 255}}
+	}
+	outline := ""
+	if style.Outline != nil {
+		outline = fmt.Sprintf("draw-outline=%t outline-color=0x%08X ", !style.Outline.IsTransparent(), style.Outline.ARGB())
+	}
 	
 	return fmt.Sprintf("textoverlay text=\"%s\" font-desc=\"%s %d\" "+
-		"color=0x%s "+
+		"color=0x%08X "+
+		"%s"+
 		"xpos=%d ypos=%d "+
 		"wrap-mode=word-char "+
 		"line-alignment=left",
-		text,
+		style.Markup(text),
 		o.config.Text.FontFamily,
 		o.config.Text.FontSize,
-		o.parseColor(o.config.Text.Color),
+		style.Color.ARGB(),
+		outline,
 		xpos,
 		ypos)
 }
@@ -65,14 +102,21 @@ func (o *OverlayManager) getImageOverlayString() string {
 	}
 
 	xpos, ypos := o.calculatePosition()
+
+	// Zero keeps the native size
+	width, height := imageSize(o.config.Image.Path)
+	width, height = ImageSize(o.config.Image, width, height, o.videoWidth, o.videoHeight)
 	
 	return fmt.Sprintf("gdkpixbufoverlay location=%s "+
 		"offset-x=%d offset-y=%d "+
+		"overlay-width=%d overlay-height=%d "+
 		"alpha=%f "+
 		"relative-x=0 relative-y=0",
 		o.config.Image.Path,
 		xpos,
 		ypos,
+		width,
+		height,
 		o.config.Image.Alpha)
 }
 
@@ -81,84 +125,28 @@ func (o *OverlayManager) getCairoOverlayString() string {
 	return "cairooverlay"
 }
 
-// processTextTemplate processes text templates with dynamic content
+// processTextTemplate renders the text template with the current time
 func (o *OverlayManager) processTextTemplate(text string) string {
-	// Replace common template variables
-	replacements := map[string]string{
-		"{{.timestamp}}": time.Now().Format("2006-01-02 15:04:05"),
-		"{{.date}}":      time.Now().Format("2006-01-02"),
-		"{{.time}}":      time.Now().Format("15:04:05"),
-		"{{.unix}}":      fmt.Sprintf("%d", time.Now().Unix()),
+	tmpl, err := NewTextTemplate(text, o.config.Text.Timezone)
+	if err != nil {
+		return text
 	}
 
-	result := text
-	for placeholder, value := range replacements {
-		result = strings.ReplaceAll(result, placeholder, value)
+	now := time.Now()
+	result, err := tmpl.Render(TemplateContext{Now: now, Started: now})
+	if err != nil {
+		return text
 	}
-
 	return result
 }
 
-// calculatePosition calculates overlay position based on anchor
+// calculatePosition returns the top-left corner of the overlay. Without a video size
+// the anchor can't be resolved and the offsets count from the top-left corner.
 func (o *OverlayManager) calculatePosition() (int, int) {
-	x := o.config.Position.X
-	y := o.config.Position.Y
-
-	// For now, return absolute positions
-	// In a real implementation, you might want to calculate relative positions
-	// based on video dimensions and anchor point
-	switch o.config.Position.Anchor {
-	case "top-left":
-		return x, y
-	case "top-right":
-		// Would need video width to calculate properly
-		return x, y
-	case "bottom-left":
-		// Would need video height to calculate properly
-		return x, y
-	case "bottom-right":
-		// Would need video width and height to calculate properly
-		return x, y
-	case "center":
-		// Would need video width and height to calculate properly
-		return x, y
-	default:
-		return x, y
+	if o.videoWidth == 0 || o.videoHeight == 0 {
+		return o.config.Position.X, o.config.Position.Y
 	}
-}
-
-// parseColor converts color string to hex format for GStreamer
-func (o *OverlayManager) parseColor(color string) string {
-	// Remove any prefix and convert to uppercase
-	color = strings.TrimPrefix(color, "#")
-	color = strings.TrimPrefix(color, "0x")
-	color = strings.ToUpper(color)
-
-	// Handle named colors
-	namedColors := map[string]string{
-		"WHITE":   "FFFFFF",
-		"BLACK":   "000000",
-		"RED":     "FF0000",
-		"GREEN":   "00FF00",
-		"BLUE":    "0000FF",
-		"YELLOW":  "FFFF00",
-		"CYAN":    "00FFFF",
-		"MAGENTA": "FF00FF",
-		"GRAY":    "808080",
-		"GREY":    "808080",
-	}
-
-	if hex, exists := namedColors[color]; exists {
-		return hex
-	}
-
-	// Validate hex color (should be 6 characters)
-	if len(color) == 6 {
-		return color
-	}
-
-	// Default to white if invalid
-	return "FFFFFF"
+	return ResolvePosition(o.config.Position, o.videoWidth, o.videoHeight, 0, 0)
 }
 
 // TextOverlayBuilder helps build complex text overlays
@@ -0,0 +1,283 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// ErrInvalidOverlayUpdate is returned for overlay updates that don't fit the overlay
+var ErrInvalidOverlayUpdate = errors.New("invalid overlay update")
+
+// OverlayUpdate changes overlay settings of a running pipeline, nil fields are left unchanged
+type OverlayUpdate struct {
+	Visible *bool   `json:"visible,omitempty"`
+	Text    *string `json:"text,omitempty"`  // Text of a text overlay
+	Image   *string `json:"image,omitempty"` // Image path of an image overlay
+	X       *int    `json:"x,omitempty"`
+	Y       *int    `json:"y,omitempty"`
+	Anchor  *string `json:"anchor,omitempty"`
+}
+
+// Apply applies the update to an overlay configuration. The configuration is left
+// unchanged when the update is not valid for it.
+func (u OverlayUpdate) Apply(overlay *config.OverlayConfig) error {
+	if u.Text != nil {
+		if overlay.Type != "text" {
+			return fmt.Errorf("%w: overlay type is %q, text can only be set on a text overlay", ErrInvalidOverlayUpdate, overlay.Type)
+		}
+		if _, err := NewTextTemplate(*u.Text, overlay.Text.Timezone); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidOverlayUpdate, err)
+		}
+	}
+	if u.Image != nil {
+		if overlay.Type != "image" {
+			return fmt.Errorf("%w: overlay type is %q, an image can only be set on an image overlay", ErrInvalidOverlayUpdate, overlay.Type)
+		}
+		if _, err := os.Stat(*u.Image); err != nil {
+			// PNG sequences given as globs or patterns are no file of their own
+			if files, seqErr := sequenceFiles(*u.Image); seqErr != nil || files == nil {
+				return fmt.Errorf("%w: overlay image is not readable: %w", ErrInvalidOverlayUpdate, err)
+			}
+		}
+	}
+	if u.Anchor != nil {
+		position := overlay.Position
+		position.Anchor = *u.Anchor
+		if err := ValidatePosition(position); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidOverlayUpdate, err)
+		}
+	}
+	if u.Visible != nil && *u.Visible && overlay.Type != "text" && overlay.Type != "image" && overlay.Type != "graphics" && overlay.Type != "ticker" && overlay.Type != "subtitles" {
+		return fmt.Errorf("%w: overlay type %q can not be shown", ErrInvalidOverlayUpdate, overlay.Type)
+	}
+
+	if u.Visible != nil {
+		overlay.Enabled = *u.Visible
+	}
+	if u.Text != nil {
+		overlay.Text.Content = *u.Text
+	}
+	if u.Image != nil {
+		overlay.Image.Path = *u.Image
+	}
+	if u.X != nil {
+		overlay.Position.X = *u.X
+	}
+	if u.Y != nil {
+		overlay.Position.Y = *u.Y
+	}
+	if u.Anchor != nil {
+		overlay.Position.Anchor = *u.Anchor
+	}
+	return nil
+}
+
+// ApplyLayer applies the update to the named layer of an overlay configuration. An
+// empty name updates the overlay itself, which only allows showing and hiding all
+// layers when it has layers. Layers are copied, not changed in place.
+func (u OverlayUpdate) ApplyLayer(overlay *config.OverlayConfig, name string) error {
+	if len(overlay.Layers) == 0 {
+		if name != "" && name != config.MainLayer {
+			return fmt.Errorf("%w %q", ErrUnknownLayer, name)
+		}
+		return u.Apply(overlay)
+	}
+
+	if name == "" {
+		if u.Text != nil || u.Image != nil || u.X != nil || u.Y != nil || u.Anchor != nil {
+			return fmt.Errorf("%w: the overlay has layers, update them by name", ErrInvalidOverlayUpdate)
+		}
+		if u.Visible != nil {
+			overlay.Enabled = *u.Visible
+		}
+		return nil
+	}
+
+	for i := range overlay.Layers {
+		if overlay.Layers[i].Name != name {
+			continue
+		}
+		layer := overlay.Layers[i].OverlayConfig
+		if err := u.Apply(&layer); err != nil {
+			return err
+		}
+		layers := append([]config.LayerConfig(nil), overlay.Layers...)
+		layers[i].OverlayConfig = layer
+		overlay.Layers = layers
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrUnknownLayer, name)
+}
+
+// UpdateOverlay changes the overlay of the running pipeline, see UpdateLayer
+func (p *Pipeline) UpdateOverlay(update OverlayUpdate) error {
+	return p.UpdateLayer("", update)
+}
+
+// UpdateLayer changes an overlay layer of the running pipeline, an empty name
+// updates the whole overlay. Changes are set on the live overlay elements and kept
+// for restarts. Disabled layers are built hidden, only showing a layer that could not
+// be built rebuilds the pipeline.
+func (p *Pipeline) UpdateLayer(name string, update OverlayUpdate) error {
+	p.mutex.Lock()
+	overlay := p.config.Overlay
+	if err := update.ApplyLayer(&overlay, name); err != nil {
+		p.mutex.Unlock()
+		return err
+	}
+	p.config.Overlay = overlay
+
+	rebuild := false
+	for _, layerCfg := range overlay.LayerList() {
+		if name != "" && layerCfg.Name != name {
+			continue
+		}
+		if layer := p.layer(layerCfg.Name); layer != nil {
+			p.applyOverlay(layer, layerCfg.OverlayConfig)
+		} else if layerCfg.Enabled && p.running && layerCfg.Type != "cairo" {
+			rebuild = true
+		}
+	}
+	p.mutex.Unlock()
+
+	if rebuild {
+		p.logger.Info("Pipeline was built without the overlay layer, rebuilding it")
+		return p.Restart()
+	}
+	return nil
+}
+
+// Overlay returns the current overlay configuration
+func (p *Pipeline) Overlay() config.OverlayConfig {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.config.Overlay
+}
+
+// applyOverlay sets the configuration on the element of a live layer. A hidden
+// layer stays in the graph so it can be shown without a restart.
+func (p *Pipeline) applyOverlay(layer *overlayLayer, overlay config.OverlayConfig) {
+	switch layer.kind {
+	case "text":
+		if err := p.setTextTemplate(layer, overlay.Text); err != nil {
+			// Apply validated the template already
+			p.logger.Warnf("Overlay %s text not updated: %v", layer.name, err)
+		}
+		p.updateText(layer, 0)
+	case "image":
+		p.setImage(layer, overlay.Image)
+		p.prepareWipe(layer)
+	case "graphics":
+		p.setRenderer(layer, overlay)
+	}
+
+	p.layoutMutex.Lock()
+	layer.enabled = overlay.Enabled
+	layer.alpha = overlay.Image.Alpha
+	p.layoutMutex.Unlock()
+	p.updateVisibility(layer, true)
+
+	p.setPosition(layer, overlay)
+	p.logger.Infof("Overlay %s updated: visible=%t anchor=%s x=%d y=%d", layer.name, overlay.Enabled,
+		overlay.Position.Anchor, overlay.Position.X, overlay.Position.Y)
+}
+
+// SetName sets the channel name overlay text templates show with {{channel}}
+func (p *Pipeline) SetName(name string) {
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	p.name = name
+}
+
+// setupTextTemplate sets up the text of a new text layer, per-frame templates are
+// rendered from a probe on its video pad
+func (p *Pipeline) setupTextTemplate(layer *overlayLayer, text config.TextOverlay) error {
+	if err := p.setTextTemplate(layer, text); err != nil {
+		return err
+	}
+	p.updateText(layer, 0)
+
+	if text.PerFrame {
+		layer.element.GetStaticPad("video_sink").AddProbe(gst.PadProbeTypeBuffer,
+			func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+				var pts time.Duration
+				if buffer := info.GetBuffer(); buffer != nil {
+					if timestamp := buffer.PresentationTimestamp().AsDuration(); timestamp != nil {
+						pts = *timestamp
+					}
+				}
+				p.updateText(layer, pts)
+				return gst.PadProbeOK
+			})
+	}
+	return nil
+}
+
+// setTextTemplate replaces the text template of a layer
+func (p *Pipeline) setTextTemplate(layer *overlayLayer, text config.TextOverlay) error {
+	tmpl, err := NewTextTemplate(text.Content, text.Timezone)
+	if err != nil {
+		return err
+	}
+
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	layer.textTemplate = tmpl
+	layer.lastText = ""
+	layer.lastTextErr = ""
+	return nil
+}
+
+// runTextRefresh re-renders the text template of a layer every refresh interval
+func (p *Pipeline) runTextRefresh(ctx context.Context, layer *overlayLayer) {
+	ticker := time.NewTicker(layer.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.updateText(layer, 0)
+		}
+	}
+}
+
+// updateText renders the text template of a layer and sets the text on its element
+// when it changed
+func (p *Pipeline) updateText(layer *overlayLayer, pts time.Duration) {
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	if layer.textTemplate == nil {
+		return
+	}
+
+	now := time.Now()
+	started := p.startedAt
+	if started.IsZero() {
+		started = now
+	}
+	text, err := layer.textTemplate.Render(TemplateContext{Now: now, Started: started, PTS: pts, Channel: p.name})
+	if err != nil {
+		// Report a failing template once, not for every render
+		if err.Error() != layer.lastTextErr {
+			layer.lastTextErr = err.Error()
+			p.logger.Warnf("Overlay %s text not updated: %v", layer.name, err)
+		}
+		return
+	}
+	layer.lastTextErr = ""
+
+	if text == layer.lastText {
+		return
+	}
+	layer.lastText = text
+	layer.element.SetProperty("text", layer.textMarkup(text))
+}
@@ -3,8 +3,13 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-gst/go-glib/glib"
@@ -14,25 +19,35 @@ import (
 	"video-graphic-overlay-gstreamer/internal/config"
 )
 
+// pipelineCount numbers pipelines, inter channels are global to the process and
+// must not be shared between pipelines
+var pipelineCount atomic.Uint64
+
 // Pipeline represents a GStreamer pipeline for HLS input with graphic overlay and UDP output
 type Pipeline struct {
 	config   *config.Config
-	logger   *logrus.Logger
+	logger   logrus.FieldLogger
 	pipeline *gst.Pipeline
 	bus      *gst.Bus
 	loop     *glib.MainLoop
 	mutex    sync.RWMutex
 	running  bool
+	state    gst.State // Last state reported on the bus
+
+	// Channels connecting playbin3 (and the failover slate) to the processing chain
+	id           uint64
+	videoChannel string
+	audioChannel string
 
 	// Pipeline elements
 	source         *gst.Element // playbin3
+	inputSink      *gst.Element // intervideosink playbin3 plays the video to
 	videoConv      *gst.Element // videoconvert
 	videoScale     *gst.Element // videoscale to match selected stream resolution
 	videoScaleCaps *gst.Element // caps filter for selected stream resolution
 	audioConv      *gst.Element // audioconvert
 	audioResamp    *gst.Element // audioresample
 	audioRate      *gst.Element // audiorate for consistent timing
-	overlay        *gst.Element // text/image overlay (optional)
 	videoEnc       *gst.Element // video encoder
 	audioEnc       *gst.Element // audio encoder
 	videoEncQueue  *gst.Element // queue after video encoder
@@ -42,13 +57,79 @@ type Pipeline struct {
 	mux            *gst.Element // muxer
 	sink           *gst.Element // udpsink
 
+	// Text/image overlays in drawing order (optional)
+	layers []*overlayLayer
+
+	// Closed captions carried from the input into the output (optional)
+	captions *captionState
+
 	// Store selected stream resolution for scaling
 	selectedWidth  int
 	selectedHeight int
+	variant        HLSStream // Variant being played, zero without a master playlist
+
+	// Automatic variant switching ("auto" stream selection)
+	adaptive   *AdaptiveController
+	instantURI bool
+
+	// Alternate audio/subtitle track preferences applied on stream collections
+	streamPrefs streamPreferences
+
+	// Live media playlist inspection
+	mediaPlaylistURL string
+	inspector        *PlaylistInspector
+
+	// Master playlist file holding the variants passing the stream filter, played when
+	// the variant has separate rendition playlists
+	filteredMaster string
+
+	// SCTE-35 cue detection and re-emission
+	cueCallback   func(CueEvent)
+	cueMutex      sync.Mutex
+	lastCueSeqnum uint32
+	cueRepeats    CueRepeats
+	scte35Output  bool
+
+	// Input failover
+	switcher   *InputSwitcher
+	primaryURI string // URI playbin3 plays for the primary input
+	slate      *gst.Pipeline
+
+	// Automatic restarts after errors and stalls
+	recovery *RecoveryManager
+	runCtx   context.Context // context the pipeline was started with, reused by restarts
+
+	// Held while the pipeline restarts, stops or is disposed, so a restart never
+	// overlaps another one or runs after the pipeline stopped for good
+	restartMutex sync.Mutex
+
+	// Cancels background tasks started with the pipeline
+	taskCancel context.CancelFunc
+
+	// Counters for monitoring
+	stats StatsCounters
+
+	// Overlay state is read and changed by pad probes and appsink callbacks in
+	// streaming threads. They take textMutex or layoutMutex, never mutex: Stop holds
+	// mutex while it waits for the streaming threads to finish. When both are needed
+	// layoutMutex is taken first.
+
+	// Guards overlay text and template state, subtitle cues and the ticker
+	textMutex sync.Mutex
+	name      string    // Channel name for templates
+	startedAt time.Time // First start, for uptime
+
+	// Guards overlay placement, image frames and transitions
+	layoutMutex sync.Mutex
+
+	// Closed when the pipeline stopped for good, err holds why
+	done     chan struct{}
+	doneOnce sync.Once
+	err      *PipelineError
 }
 
 // New creates a new pipeline instance
-func New(cfg *config.Config, logger *logrus.Logger) (*Pipeline, error) {
+func New(cfg *config.Config, logger logrus.FieldLogger) (*Pipeline, error) {
 	// Initialize GStreamer
 	gst.Init(nil)
 
@@ -56,6 +137,18 @@ func New(cfg *config.Config, logger *logrus.Logger) (*Pipeline, error) {
 		config: cfg,
 		logger: logger,
 		loop:   glib.NewMainLoop(glib.MainContextDefault(), false),
+		done:   make(chan struct{}),
+		id:     pipelineCount.Add(1),
+		state:  gst.StateNull,
+	}
+	p.videoChannel = fmt.Sprintf("video-channel-%d", p.id)
+	p.audioChannel = fmt.Sprintf("audio-channel-%d", p.id)
+
+	if cfg.Pipeline.AutoRestart {
+		p.recovery = NewRecoveryManager(p, cfg.Pipeline.MaxRestarts,
+			time.Duration(cfg.Pipeline.RestartDelay)*time.Second,
+			time.Duration(cfg.Pipeline.MaxRestartDelay)*time.Second,
+			time.Duration(cfg.Pipeline.StallTimeout)*time.Second)
 	}
 
 	if err := p.buildPipeline(); err != nil {
@@ -71,7 +164,7 @@ func New(cfg *config.Config, logger *logrus.Logger) (*Pipeline, error) {
 // buildPipeline constructs the GStreamer pipeline programmatically
 func (p *Pipeline) buildPipeline() error {
 	// Create pipeline
-	pipeline, err := gst.NewPipeline("video-overlay-pipeline")
+	pipeline, err := gst.NewPipeline(fmt.Sprintf("video-overlay-pipeline-%d", p.id))
 	if err != nil {
 		return fmt.Errorf("failed to create pipeline: %w", err)
 	}
@@ -90,9 +183,41 @@ func (p *Pipeline) buildPipeline() error {
 	// Get bus for message handling
 	p.bus = p.pipeline.GetPipelineBus()
 
+	p.watchOutput()
+	p.watchStats()
+
 	return nil
 }
 
+// watchOutput counts bytes reaching the sink and reports them to the health checker
+func (p *Pipeline) watchOutput() {
+	recovery := p.recovery
+	stats := &p.stats
+	p.sink.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeBufferList,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			_, bytes := probeSize(info)
+			stats.bytesSent.Add(bytes)
+			if recovery != nil {
+				recovery.UpdateActivity()
+			}
+			return gst.PadProbeOK
+		})
+}
+
+// resetBuildState clears what the previous build derived from the configuration
+func (p *Pipeline) resetBuildState() {
+	p.selectedWidth = 0
+	p.selectedHeight = 0
+	p.variant = HLSStream{}
+	p.stats.ResetBuild()
+	p.adaptive = nil
+	p.instantURI = false
+	p.scte35Output = false
+	p.switcher = nil
+	p.primaryURI = ""
+	p.inspector = nil
+}
+
 // createElements creates all GStreamer elements and adds them to the pipeline
 func (p *Pipeline) createElements() error {
 	var err error
@@ -120,8 +245,12 @@ func (p *Pipeline) createElements() error {
 		return fmt.Errorf("failed to create video scale caps filter: %w", err)
 	}
 
-	// Video scaling caps will be set after stream selection
-	p.logger.Info("Video processing will scale to match selected stream resolution")
+	// Scale to the resolution chosen during stream selection
+	if p.selectedWidth > 0 && p.selectedHeight > 0 {
+		p.setOutputResolution(p.selectedWidth, p.selectedHeight)
+	} else {
+		p.logger.Info("No stream resolution selected, video keeps its input resolution")
+	}
 
 	// Create audio processing elements
 	p.audioConv, err = gst.NewElement("audioconvert")
@@ -141,34 +270,12 @@ func (p *Pipeline) createElements() error {
 		return fmt.Errorf("failed to create audiorate: %w", err)
 	}
 
-	// Create overlay element if enabled
-	if cfg.Overlay.Enabled {
-		switch cfg.Overlay.Type {
-		case "text":
-			p.overlay, err = gst.NewElement("textoverlay")
-			if err != nil {
-				return fmt.Errorf("failed to create textoverlay: %w", err)
-			}
-			// Configure text overlay
-			p.overlay.SetProperty("text", cfg.Overlay.Text.Content)
-			p.overlay.SetProperty("font-desc", fmt.Sprintf("%s %d", cfg.Overlay.Text.FontFamily, cfg.Overlay.Text.FontSize))
-			p.overlay.SetProperty("color", parseColor(cfg.Overlay.Text.Color))
-			p.overlay.SetProperty("halignment", "left")
-			p.overlay.SetProperty("valignment", "top")
-			p.overlay.SetProperty("xpad", cfg.Overlay.Position.X)
-			p.overlay.SetProperty("ypad", cfg.Overlay.Position.Y)
-			p.logger.Info("Text overlay configured successfully")
-		case "image":
-			p.overlay, err = gst.NewElement("gdkpixbufoverlay")
-			if err != nil {
-				return fmt.Errorf("failed to create gdkpixbufoverlay: %w", err)
-			}
-			p.overlay.SetProperty("location", cfg.Overlay.Image.Path)
-			p.overlay.SetProperty("alpha", cfg.Overlay.Image.Alpha)
-			p.overlay.SetProperty("offset-x", cfg.Overlay.Position.X)
-			p.overlay.SetProperty("offset-y", cfg.Overlay.Position.Y)
-			p.logger.Info("Image overlay configured successfully")
-		}
+	// Create overlay layers, disabled ones start hidden
+	if err := p.createLayers(cfg.Overlay); err != nil {
+		return err
+	}
+	if err := p.setupSubtitles(); err != nil {
+		return err
 	}
 
 	// Create encoding elements
@@ -236,6 +343,16 @@ func (p *Pipeline) createElements() error {
 		p.mux.SetProperty("min-upstream-latency", uint64(0))
 		// Ensure both video and audio are included in the program
 		p.mux.SetProperty("prog-map", "program_map,video_0=0,audio_0=0")
+
+		// Carry detected ad markers to downstream ad insertion
+		if playlistCues, streamCues := p.cueSources(); (playlistCues || streamCues) && cfg.Output.SCTE35PID > 0 {
+			if err := p.mux.SetProperty("scte-35-pid", uint(cfg.Output.SCTE35PID)); err != nil {
+				p.logger.Warnf("Muxer does not support SCTE-35 output, cues are not re-emitted: %v", err)
+			} else {
+				p.scte35Output = true
+				p.logger.Infof("Re-emitting SCTE-35 cues on PID %d", cfg.Output.SCTE35PID)
+			}
+		}
 	}
 
 	// Create sink
@@ -256,9 +373,7 @@ func (p *Pipeline) createElements() error {
 		p.videoEnc, p.audioEnc, p.videoEncQueue, p.audioEncQueue, p.mux, p.sink,
 	}
 
-	if p.overlay != nil {
-		elements = append(elements, p.overlay)
-	}
+	elements = append(elements, p.layerElements()...)
 
 	for _, element := range elements {
 		if element != nil {
@@ -275,8 +390,18 @@ func (p *Pipeline) createElements() error {
 func (p *Pipeline) createPlaybin3Source(cfg *config.Config) error {
 	var err error
 
+	p.streamPrefs = streamPreferences{
+		audioLanguage:    cfg.Input.AudioLanguage,
+		audioName:        cfg.Input.AudioName,
+		subtitleLanguage: cfg.Input.SubtitleLanguage,
+		subtitleName:     cfg.Input.SubtitleName,
+		burnIn:           renditionSubtitles(cfg.Overlay),
+	}
+
 	// Parse master playlist if enabled
 	finalURL := cfg.Input.HLSUrl
+	p.mediaPlaylistURL = cfg.Input.HLSUrl
+	connectionSpeed := uint64(cfg.Input.BufferSize / 1024)
 	if cfg.Input.ParseMasterPlaylist {
 		playlist, err := ParseHLSMasterPlaylist(cfg.Input.HLSUrl, p.logger)
 		if err != nil {
@@ -288,24 +413,53 @@ func (p *Pipeline) createPlaybin3Source(cfg *config.Config) error {
 				selection = "highest"
 			}
 
-			bestStream := playlist.SelectBestStream(selection)
+			filter := streamFilter(cfg)
+			var bestStream *HLSStream
+			if strings.ToLower(selection) == "auto" {
+				bestStream, err = p.setupAdaptive(playlist, cfg, filter)
+			} else {
+				bestStream, err = playlist.SelectBestStreamFiltered(selection, filter)
+			}
+			if err != nil {
+				// Falling back to the master playlist could let playbin3 pick a filtered variant
+				return fmt.Errorf("failed to select HLS stream: %w", err)
+			}
 			if bestStream != nil {
 				finalURL = bestStream.URL
-				// Store selected stream resolution for video scaling
-				p.selectedWidth = bestStream.Width
-				p.selectedHeight = bestStream.Height
+				p.mediaPlaylistURL = bestStream.URL
+				p.variant = *bestStream
+				// Store selected stream resolution for video scaling, auto mode keeps
+				// the output at the largest variant it may switch to
+				if p.adaptive == nil {
+					p.selectedWidth = bestStream.Width
+					p.selectedHeight = bestStream.Height
+				}
 
-				p.logger.Infof("Selected HLS stream: %dx%d, %d bps (%s) - will scale output to match",
+				p.logger.Infof("Selected HLS stream: %dx%d, %d bps (%s) - will scale output to %dx%d",
 					bestStream.Width, bestStream.Height,
-					bestStream.Bandwidth, selection)
-
-				// Set video scaling caps to match selected stream resolution
-				if p.videoScaleCaps != nil {
-					videoCapsStr := fmt.Sprintf("video/x-raw,width=%d,height=%d", bestStream.Width, bestStream.Height)
-					videoScaleCaps := gst.NewCapsFromString(videoCapsStr)
-					if videoScaleCaps != nil {
-						p.videoScaleCaps.SetProperty("caps", videoScaleCaps)
-						p.logger.Infof("Set video scaling to output %dx%d", bestStream.Width, bestStream.Height)
+					bestStream.Bandwidth, selection, p.selectedWidth, p.selectedHeight)
+
+				p.selectRenditions(playlist, bestStream)
+
+				// Demuxed renditions live in their own media playlists, so playbin3 needs a
+				// master playlist to see them. It gets one holding only the variants passing
+				// the filter. Cap the connection speed so the variant stays put.
+				if playlist.HasDemuxedRenditions(bestStream, RenditionTypeAudio) ||
+					(p.streamPrefs.hasSubtitles() && playlist.HasDemuxedRenditions(bestStream, RenditionTypeSubtitles)) {
+					finalURL, err = p.writeFilteredMaster(playlist, filter)
+					if err != nil {
+						return fmt.Errorf("failed to prepare master playlist for rendition playback: %w", err)
+					}
+					connectionSpeed = uint64(bestStream.Bandwidth / 1000)
+					p.logger.Infof("Variant uses separate rendition playlists, playing filtered master playlist limited to %d kbps",
+						connectionSpeed)
+					if p.adaptive != nil {
+						// Switching URIs would drop the renditions, leave adaptation to playbin3.
+						// The filtered master only holds allowed variants, so playbin3 picks among
+						// them by measured throughput.
+						p.logger.Info("Automatic variant switching delegated to playbin3 for the master playlist")
+						p.adaptive = nil
+						connectionSpeed = 0
 					}
 				}
 			} else {
@@ -323,40 +477,600 @@ func (p *Pipeline) createPlaybin3Source(cfg *config.Config) error {
 	// Configure playbin3
 	p.source.SetProperty("uri", finalURL)
 
-	// Set flags to enable video and audio, disable text/subtitles
+	// Read SCTE-35 sections from the demuxer playbin3 creates for the transport stream
+	if _, streamCues := p.cueSources(); streamCues {
+		if _, err := p.source.Connect("element-setup", p.setupElement); err != nil {
+			p.logger.Warnf("Failed to watch playbin3 elements, SCTE-35 sections are not read: %v", err)
+		}
+	}
+
+	// Apply uri changes immediately so variants can be switched while playing (GStreamer 1.22+)
+	if err := p.source.SetProperty("instant-uri", true); err == nil {
+		p.instantURI = true
+	}
+
+	// Set flags to enable video and audio, disable text/subtitles unless setupSubtitles
+	// burns them in
 	// GST_PLAY_FLAG_VIDEO (1) + GST_PLAY_FLAG_AUDIO (2) + GST_PLAY_FLAG_BUFFERING (16) = 19
 	// Removed native flags to improve compatibility with adaptive streams
 	p.source.SetProperty("flags", 19)
 
 	// Configure buffering for better streaming performance with increased latency tolerance
-	p.source.SetProperty("buffer-duration", int64(5000000000))                  // 5 seconds buffer duration
-	p.source.SetProperty("buffer-size", cfg.Input.BufferSize*2)                 // Double the buffer size
-	p.source.SetProperty("connection-speed", uint64(cfg.Input.BufferSize/1024)) // Connection speed in kbps
+	p.source.SetProperty("buffer-duration", int64(5000000000))  // 5 seconds buffer duration
+	p.source.SetProperty("buffer-size", cfg.Input.BufferSize*2) // Double the buffer size
+	p.source.SetProperty("connection-speed", connectionSpeed)   // Connection speed in kbps
 
 	// Create intervideosink and interaudiosink for external processing
 	videoSink, err := gst.NewElement("intervideosink")
 	if err != nil {
 		return fmt.Errorf("failed to create intervideosink: %w", err)
 	}
-	videoSink.SetProperty("channel", "video-channel")
+	videoSink.SetProperty("channel", p.videoChannel)
 	videoSink.SetProperty("max-lateness", int64(3000000000)) // 3 seconds max lateness
 
 	audioSink, err := gst.NewElement("interaudiosink")
 	if err != nil {
 		return fmt.Errorf("failed to create interaudiosink: %w", err)
 	}
-	audioSink.SetProperty("channel", "audio-channel")
+	audioSink.SetProperty("channel", p.audioChannel)
 	audioSink.SetProperty("max-lateness", int64(3000000000)) // 3 seconds max lateness
 
-	// Set the external sinks on playbin3
-	p.source.SetProperty("video-sink", videoSink)
+	// Set the external sinks on playbin3, captions are taken off the video first
+	p.source.SetProperty("video-sink", p.setupCaptions(cfg, videoSink))
 	p.source.SetProperty("audio-sink", audioSink)
+	p.inputSink = videoSink
+
+	p.primaryURI = finalURL
+	if err := p.setupFailover(cfg, videoSink); err != nil {
+		return err
+	}
 
 	p.logger.Info("Using playbin3 with external sinks for HLS streaming and processing")
 
 	return nil
 }
 
+// setupFailover prepares switching to backup inputs and the slate
+func (p *Pipeline) setupFailover(cfg *config.Config, videoSink *gst.Element) error {
+	if len(cfg.Input.BackupURLs) == 0 && cfg.Input.Slate == "" {
+		return nil
+	}
+
+	inputs := append([]string{cfg.Input.HLSUrl}, cfg.Input.BackupURLs...)
+	p.switcher = NewInputSwitcher(inputs, cfg.Input.Slate != "",
+		time.Duration(cfg.Input.FailoverTimeout)*time.Second,
+		time.Duration(cfg.Input.FailbackDelay)*time.Second)
+
+	if cfg.Input.Slate != "" {
+		if _, err := os.Stat(cfg.Input.Slate); err != nil {
+			return fmt.Errorf("failed to access slate: %w", err)
+		}
+		slate, err := gst.NewPipelineFromString(slateDescription(cfg.Input.Slate, p.videoChannel, p.audioChannel))
+		if err != nil {
+			return fmt.Errorf("failed to create slate pipeline: %w", err)
+		}
+		source, err := slate.GetElementByName(slateSourceName)
+		if err != nil {
+			slate.Unref()
+			return fmt.Errorf("failed to find slate source: %w", err)
+		}
+		source.SetProperty("location", cfg.Input.Slate)
+		p.slate = slate
+	}
+
+	// Video reaching the inter channel shows the active input is alive
+	videoSink.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer,
+		func(*gst.Pad, *gst.PadProbeInfo) gst.PadProbeReturn {
+			p.switcher.Activity(time.Now())
+			return gst.PadProbeOK
+		})
+
+	p.logger.Infof("Input failover enabled with %d backup inputs, slate %q",
+		len(cfg.Input.BackupURLs), cfg.Input.Slate)
+
+	return nil
+}
+
+// selectRenditions resolves the configured audio and subtitle preferences against the
+// renditions of the selected variant, so stream selection can match by NAME and LANGUAGE
+func (p *Pipeline) selectRenditions(playlist *HLSMasterPlaylist, stream *HLSStream) {
+	if stream.Audio != "" {
+		rendition := playlist.SelectRendition(RenditionTypeAudio, stream.Audio,
+			p.streamPrefs.audioLanguage, p.streamPrefs.audioName)
+		if rendition != nil {
+			p.logger.Infof("Selected audio rendition %q (language %q, group %q)",
+				rendition.Name, rendition.Language, rendition.GroupID)
+			if p.streamPrefs.hasAudio() {
+				p.streamPrefs.audioName = rendition.Name
+				p.streamPrefs.audioLanguage = rendition.Language
+			}
+		}
+	}
+
+	if stream.Subtitles != "" && p.streamPrefs.hasSubtitles() {
+		rendition := playlist.SelectRendition(RenditionTypeSubtitles, stream.Subtitles,
+			p.streamPrefs.subtitleLanguage, p.streamPrefs.subtitleName)
+		if rendition != nil {
+			p.logger.Infof("Selected subtitle rendition %q (language %q, group %q)",
+				rendition.Name, rendition.Language, rendition.GroupID)
+			p.streamPrefs.subtitleName = rendition.Name
+			p.streamPrefs.subtitleLanguage = rendition.Language
+		}
+	}
+}
+
+// selectStreams sends a select-streams event to playbin3 for the preferred tracks
+func (p *Pipeline) selectStreams(collection *gst.StreamCollection) {
+	if !p.streamPrefs.hasAudio() && !p.streamPrefs.hasSubtitles() {
+		// Let playbin3 keep its default selection
+		return
+	}
+
+	streams := p.streamPrefs.selectStreams(collection)
+	if len(streams) == 0 {
+		return
+	}
+
+	for _, stream := range streams {
+		p.logger.Infof("Requesting stream %s", describeStream(stream))
+	}
+
+	if !p.source.SendEvent(gst.NewSelectStreamsEvent(streams)) {
+		p.logger.Warn("playbin3 rejected the select-streams event")
+	}
+}
+
+// streamFilter builds the variant filter from the input configuration
+func streamFilter(cfg *config.Config) StreamFilter {
+	return StreamFilter{
+		MinBitrate:   cfg.Input.MinBitrate,
+		MaxBitrate:   cfg.Input.MaxBitrate,
+		MaxWidth:     cfg.Input.MaxWidth,
+		MaxHeight:    cfg.Input.MaxHeight,
+		MaxFrameRate: cfg.Input.MaxFrameRate,
+		Codecs:       cfg.Input.AllowedCodecs,
+	}
+}
+
+// setupAdaptive creates the adaptive controller for "auto" stream selection and
+// returns the variant to start with
+func (p *Pipeline) setupAdaptive(playlist *HLSMasterPlaylist, cfg *config.Config, filter StreamFilter) (*HLSStream, error) {
+	variants, err := playlist.FilterStreams(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	holdTime := time.Duration(cfg.Input.AdaptiveHoldTime) * time.Second
+	p.adaptive = NewAdaptiveController(variants, holdTime, cfg.Input.AdaptiveSafetyFactor)
+
+	// Keep the output at the largest resolution so switches don't renegotiate downstream
+	for _, variant := range variants {
+		if variant.Width*variant.Height > p.selectedWidth*p.selectedHeight {
+			p.selectedWidth = variant.Width
+			p.selectedHeight = variant.Height
+		}
+	}
+
+	p.logger.Infof("Automatic variant switching between %d variants (%d-%d bps)",
+		len(variants), variants[0].Bandwidth, variants[len(variants)-1].Bandwidth)
+
+	// Start low and let measured throughput move us up
+	current := p.adaptive.Current()
+	return &current, nil
+}
+
+// writeFilteredMaster writes the variants of a master playlist passing the filter to a
+// temporary master playlist and returns its URI
+func (p *Pipeline) writeFilteredMaster(playlist *HLSMasterPlaylist, filter StreamFilter) (string, error) {
+	filtered, err := playlist.Filtered(filter)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp("", "overlay-master-*.m3u8")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	p.filteredMaster = file.Name()
+	if _, err := file.WriteString(filtered.Encode()); err != nil {
+		return "", err
+	}
+
+	if rejected := len(playlist.Streams) - len(filtered.Streams); rejected > 0 {
+		p.logger.Infof("Filtered master playlist %s leaves out %d of %d variants",
+			file.Name(), rejected, len(playlist.Streams))
+	}
+	return (&url.URL{Scheme: "file", Path: file.Name()}).String(), nil
+}
+
+// setOutputResolution restricts the scaled video to the given resolution
+func (p *Pipeline) setOutputResolution(width, height int) {
+	caps := gst.NewCapsFromString(fmt.Sprintf(
+		"video/x-raw,width=%d,height=%d,pixel-aspect-ratio=1/1", width, height))
+	if caps == nil {
+		p.logger.Warnf("Failed to create video scale caps for %dx%d", width, height)
+		return
+	}
+	p.videoScaleCaps.SetProperty("caps", caps)
+	p.logger.Infof("Video output scaled to %dx%d", width, height)
+}
+
+// setSourceURI points playbin3 at a new URI while the pipeline is playing
+func (p *Pipeline) setSourceURI(uri string) error {
+	if p.instantURI {
+		return p.source.SetProperty("uri", uri)
+	}
+
+	// Without instant-uri the new URI only applies after the source is restarted
+	return p.restartSource(uri)
+}
+
+// restartSource restarts playbin3 on uri, which also recovers it from errors
+func (p *Pipeline) restartSource(uri string) error {
+	if err := p.source.SetState(gst.StateReady); err != nil {
+		return fmt.Errorf("failed to set playbin3 to READY: %w", err)
+	}
+	if err := p.source.SetProperty("uri", uri); err != nil {
+		return fmt.Errorf("failed to set playbin3 uri: %w", err)
+	}
+	if !p.source.SyncStateWithParent() {
+		return fmt.Errorf("failed to sync playbin3 state with pipeline")
+	}
+	return nil
+}
+
+// runAdaptive periodically lets the adaptive controller pick a variant
+func (p *Pipeline) runAdaptive(ctx context.Context) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if p.switcher != nil && p.switcher.Active() != 0 {
+				// Variants belong to the primary input
+				continue
+			}
+			if stream, ok := p.adaptive.Decide(now); ok {
+				p.switchVariant(stream)
+			}
+		}
+	}
+}
+
+// switchVariant switches playback to another variant of the master playlist
+func (p *Pipeline) switchVariant(stream HLSStream) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.running || p.source == nil {
+		return
+	}
+
+	p.logger.Infof("Switching to variant %dx%d, %d bps (throughput %.0f bps)",
+		stream.Width, stream.Height, stream.Bandwidth, p.adaptive.Throughput())
+
+	if err := p.setSourceURI(stream.URL); err != nil {
+		p.logger.Errorf("Failed to switch variant: %v", err)
+		return
+	}
+
+	p.mediaPlaylistURL = stream.URL
+	p.primaryURI = stream.URL
+	p.variant = stream
+	if p.inspector != nil {
+		p.inspector.SetURL(stream.URL)
+	}
+
+	if stream.Width != p.selectedWidth || stream.Height != p.selectedHeight {
+		p.logger.Debugf("Variant resolution %dx%d differs, output stays at %dx%d",
+			stream.Width, stream.Height, p.selectedWidth, p.selectedHeight)
+	}
+}
+
+// runFailover watches the active input and switches between inputs and the slate
+func (p *Pipeline) runFailover(ctx context.Context) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	var lastHealthCheck time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if index, ok := p.switcher.CheckStall(now); ok {
+				p.switchInput(index, "no video received")
+				continue
+			}
+
+			// Health check the inputs we would rather be on
+			if now.Sub(lastHealthCheck) < failoverHealthInterval {
+				continue
+			}
+			lastHealthCheck = now
+			for _, index := range p.switcher.Standby() {
+				uri := p.config.Input.HLSUrl
+				if index > 0 {
+					uri = p.config.Input.BackupURLs[index-1]
+				}
+				err := checkPlaylist(client, uri)
+				if err != nil {
+					p.logger.Debugf("Health check of %s failed: %v", p.switcher.Name(index), err)
+				}
+				p.switcher.ReportHealth(index, err == nil, time.Now())
+			}
+			if index, ok := p.switcher.Failback(time.Now()); ok {
+				p.switchInput(index, "higher priority input is healthy again")
+			}
+		}
+	}
+}
+
+// failInput reports an error on the active input
+func (p *Pipeline) failInput(reason string) {
+	if index, ok := p.switcher.Failed(time.Now()); ok {
+		p.switchInput(index, reason)
+	}
+}
+
+// switchInput feeds the output from another input or the slate. The processing chain
+// keeps reading the inter channels, so the output stream continues unchanged.
+func (p *Pipeline) switchInput(index int, reason string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.running || p.source == nil {
+		return
+	}
+
+	p.logger.Warnf("Switching to %s: %s", p.switcher.Name(index), reason)
+
+	if index > len(p.config.Input.BackupURLs) {
+		// Stop the failed input so it doesn't write into the channels alongside the slate
+		if err := p.source.SetState(gst.StateReady); err != nil {
+			p.logger.Warnf("Failed to stop input: %v", err)
+		}
+		if err := p.slate.SetState(gst.StatePlaying); err != nil {
+			p.logger.Errorf("Failed to start slate: %v", err)
+		}
+		return
+	}
+
+	if p.slate != nil {
+		if err := p.slate.SetState(gst.StateNull); err != nil {
+			p.logger.Warnf("Failed to stop slate: %v", err)
+		}
+	}
+
+	uri := p.primaryURI
+	if index > 0 {
+		uri = p.config.Input.BackupURLs[index-1]
+	}
+	if err := p.restartSource(uri); err != nil {
+		p.logger.Errorf("Failed to start %s: %v", p.switcher.Name(index), err)
+	}
+}
+
+// watchSlate loops video slates and logs slate errors
+func (p *Pipeline) watchSlate(ctx context.Context) {
+	bus := p.slate.GetPipelineBus()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		msg := bus.TimedPop(gst.ClockTime(100 * time.Millisecond))
+		if msg == nil {
+			continue
+		}
+
+		switch msg.Type() {
+		case gst.MessageEOS:
+			if !p.slate.SeekSimple(0, gst.FormatTime, gst.SeekFlagFlush|gst.SeekFlagKeyUnit) {
+				p.logger.Warn("Failed to loop slate")
+			}
+		case gst.MessageError:
+			p.logger.Errorf("Slate error: %s", msg.ParseError().Error())
+		}
+	}
+}
+
+// isInputMessage reports whether a bus message was posted from within playbin3
+func (p *Pipeline) isInputMessage(msg *gst.Message) bool {
+	if msg.Source() == p.source.GetName() {
+		return true
+	}
+	element, err := gst.ToGstBin(p.source).GetElementByNameRecursive(msg.Source())
+	return err == nil && element != nil
+}
+
+// handleStreamingStatistics feeds fragment download statistics from the adaptive demuxer
+// into the adaptive controller
+func (p *Pipeline) handleStreamingStatistics(structure *gst.Structure) {
+	size, err := structure.GetValue("fragment-size")
+	if err != nil {
+		return
+	}
+	downloadTime, err := structure.GetValue("fragment-download-time")
+	if err != nil {
+		return
+	}
+
+	bytes, ok := toUint64(size)
+	if !ok {
+		return
+	}
+	nanoseconds, ok := toUint64(downloadTime)
+	if !ok {
+		return
+	}
+
+	p.adaptive.AddSample(bytes, time.Duration(nanoseconds))
+}
+
+// toUint64 converts numeric structure values to uint64
+func toUint64(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return v, true
+	case int64:
+		return uint64(v), v >= 0
+	case uint:
+		return uint64(v), true
+	case int:
+		return uint64(v), v >= 0
+	case uint32:
+		return uint64(v), true
+	case int32:
+		return uint64(v), v >= 0
+	default:
+		return 0, false
+	}
+}
+
+// SetCueCallback sets a callback for detected SCTE-35 cues. It is called from
+// streaming threads and must not block.
+func (p *Pipeline) SetCueCallback(callback func(CueEvent)) {
+	p.cueCallback = callback
+}
+
+// cueSources reports whether ad markers are read from the playlist and from the stream
+func (p *Pipeline) cueSources() (playlist, stream bool) {
+	switch strings.ToLower(p.config.Input.CueSource) {
+	case "playlist":
+		return true, false
+	case "stream":
+		return false, true
+	case "both":
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// setupElement configures elements created inside playbin3
+func (p *Pipeline) setupElement(_ *gst.Element, element *gst.Element) {
+	factory := element.GetFactory()
+	if factory == nil || factory.GetName() != "tsdemux" {
+		return
+	}
+
+	element.SetProperty("send-scte35-events", true)
+	element.Connect("pad-added", func(_ *gst.Element, pad *gst.Pad) {
+		pad.AddProbe(gst.PadProbeTypeEventDownstream, p.probeSCTE35)
+	})
+	p.logger.Info("Reading SCTE-35 sections from the transport stream")
+}
+
+// probeSCTE35 picks SCTE-35 section events off tsdemux source pads
+func (p *Pipeline) probeSCTE35(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+	event := info.GetEvent()
+	if event == nil || event.Type() != gst.EventTypeCustomDownstream {
+		return gst.PadProbeOK
+	}
+
+	data, ok := scte35SectionData(event)
+	if !ok {
+		return gst.PadProbeOK
+	}
+
+	// tsdemux pushes the same event on every source pad
+	p.cueMutex.Lock()
+	duplicate := event.Seqnum() == p.lastCueSeqnum
+	p.lastCueSeqnum = event.Seqnum()
+	p.cueMutex.Unlock()
+	if duplicate {
+		return gst.PadProbeOK
+	}
+
+	section, err := ParseSpliceInfoSection(data)
+	if err != nil {
+		p.logger.Warnf("Invalid SCTE-35 section in transport stream: %v", err)
+		return gst.PadProbeOK
+	}
+
+	if cue, ok := section.Cue(); ok {
+		cue.Source = CueSourceStream
+		cue.Timestamp = time.Now()
+		if p.repeatedCue(cue) {
+			return gst.PadProbeOK
+		}
+		p.notifyCue(cue)
+	}
+
+	// Forward the section as is, mpegtsmux maps its running time onto the output
+	if p.scte35Output && !p.mux.SendEvent(event) {
+		p.logger.Warn("Muxer rejected SCTE-35 section")
+	}
+
+	return gst.PadProbeOK
+}
+
+// handleCue reports a playlist cue and re-emits it into the output
+func (p *Pipeline) handleCue(cue CueEvent) {
+	if p.repeatedCue(cue) {
+		return
+	}
+	p.notifyCue(cue)
+	if !p.scte35Output {
+		return
+	}
+
+	// Playlist cues carry no stream time. Playback trails the end of the playlist by
+	// the three target durations the demuxer starts live streams at, so the splice is
+	// timed for when playback reaches the segment of the cue.
+	spliceTime := gst.ClockTimeNone
+	delay := liveHoldBackTargets*p.inspector.Window().TargetDuration - cue.EdgeOffset
+	if now, ok := p.runningTime(); ok && delay > 0 {
+		spliceTime = gst.ClockTime(now + delay)
+		p.logger.Debugf("Splicing %v in %s", cue, delay)
+	}
+	if !sendSpliceInsert(p.mux, uint16(p.config.Output.SCTE35PID), cue, spliceTime) {
+		p.logger.Warnf("Muxer rejected SCTE-35 section for %v", cue)
+	}
+}
+
+// repeatedCue reports whether a cue was seen from the other cue source already
+func (p *Pipeline) repeatedCue(cue CueEvent) bool {
+	p.cueMutex.Lock()
+	defer p.cueMutex.Unlock()
+	if p.cueRepeats.Repeated(cue) {
+		p.logger.Debugf("SCTE-35 cue %v already seen from the other source", cue)
+		return true
+	}
+	return false
+}
+
+// runningTime returns the running time of the pipeline, false while it has no clock
+func (p *Pipeline) runningTime() (time.Duration, bool) {
+	clock := p.pipeline.GetClock()
+	if clock == nil {
+		return 0, false
+	}
+	now, base := clock.GetTime().AsDuration(), p.pipeline.GetBaseTime().AsDuration()
+	if now == nil || base == nil || *now < *base {
+		return 0, false
+	}
+	return *now - *base, true
+}
+
+// notifyCue logs a cue and forwards it to the cue callback
+func (p *Pipeline) notifyCue(cue CueEvent) {
+	p.logger.Infof("SCTE-35 cue: %v", cue)
+
+	if p.cueCallback != nil {
+		p.cueCallback(cue)
+	}
+}
+
 // linkElements links all GStreamer elements in the pipeline
 func (p *Pipeline) linkElements() error {
 	return p.linkPlaybin3Elements()
@@ -369,14 +1083,14 @@ func (p *Pipeline) linkPlaybin3Elements() error {
 	if err != nil {
 		return fmt.Errorf("failed to create intervideosrc: %w", err)
 	}
-	videoSrc.SetProperty("channel", "video-channel")
+	videoSrc.SetProperty("channel", p.videoChannel)
 	videoSrc.SetProperty("timeout", uint64(3000000000)) // 3 seconds timeout
 
 	audioSrc, err := gst.NewElement("interaudiosrc")
 	if err != nil {
 		return fmt.Errorf("failed to create interaudiosrc: %w", err)
 	}
-	audioSrc.SetProperty("channel", "audio-channel")
+	audioSrc.SetProperty("channel", p.audioChannel)
 	audioSrc.SetProperty("timeout", uint64(3000000000)) // 3 seconds timeout
 
 	// Add inter sources to pipeline
@@ -399,8 +1113,13 @@ func (p *Pipeline) linkPlaybin3Elements() error {
 
 	// Link video processing elements (scale to match selected stream resolution)
 	elements := []*gst.Element{p.videoConv, p.videoScale, p.videoScaleCaps}
-	if p.overlay != nil {
-		elements = append(elements, p.overlay)
+	elements = append(elements, p.layerElements()...)
+	if p.captions != nil {
+		// Captions go back on the video after the overlays, just before encoding, once
+		// the input turns out to have them
+		p.captions.mutex.Lock()
+		p.captions.pipeline, p.captions.upstream = p.pipeline, elements[len(elements)-1]
+		p.captions.mutex.Unlock()
 	}
 	elements = append(elements, p.videoEnc, p.videoEncQueue)
 
@@ -559,37 +1278,41 @@ func (p *Pipeline) createMuxer(format string) (*gst.Element, error) {
 	}
 }
 
-// parseColor converts color string to uint32 (simplified implementation)
-func parseColor(colorStr string) uint32 {
-	// Simple color mapping - in a real implementation you'd parse hex/rgb values
-	switch colorStr {
-	case "white":
-		return 0xFFFFFFFF
-	case "black":
-		return 0xFF000000
-	case "red":
-		return 0xFFFF0000
-	case "green":
-		return 0xFF00FF00
-	case "blue":
-		return 0xFF0000FF
-	case "yellow":
-		return 0xFFFFFF00
-	default:
-		return 0xFFFFFFFF // Default to white
+// Start starts the pipeline
+func (p *Pipeline) Start(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := p.start(ctx); err != nil {
+		return err
+	}
+
+	if p.recovery != nil {
+		p.recovery.Start(ctx)
 	}
+	return nil
 }
 
-// Start starts the pipeline
-func (p *Pipeline) Start(ctx context.Context) error {
+// start sets the pipeline playing and starts its background tasks
+func (p *Pipeline) start(ctx context.Context) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	if p.running {
 		return fmt.Errorf("pipeline is already running")
 	}
+	if p.pipeline == nil {
+		return fmt.Errorf("pipeline has been disposed")
+	}
 
 	p.logger.Info("Starting pipeline...")
+	p.runCtx = ctx
+	p.textMutex.Lock()
+	if p.startedAt.IsZero() {
+		p.startedAt = time.Now()
+	}
+	p.textMutex.Unlock()
 
 	// Set pipeline to playing state
 	p.pipeline.SetState(gst.StatePlaying)
@@ -599,6 +1322,46 @@ func (p *Pipeline) Start(ctx context.Context) error {
 	// Start message handling in a separate goroutine
 	go p.handleMessages(ctx)
 
+	// Start background tasks bound to this run of the pipeline
+	var taskCtx context.Context
+	taskCtx, p.taskCancel = context.WithCancel(ctx)
+
+	if playlistCues, _ := p.cueSources(); p.config.Input.InspectPlaylist || playlistCues {
+		p.inspector = NewPlaylistInspector(p.mediaPlaylistURL, p.logger)
+		if playlistCues {
+			p.inspector.SetCueCallback(p.handleCue)
+		}
+		p.inspector.Start(taskCtx)
+	}
+
+	if p.adaptive != nil {
+		go p.runAdaptive(taskCtx)
+	}
+
+	scheduled := false
+	for _, layer := range p.layers {
+		scheduled = scheduled || layer.schedule.Scheduled()
+		if layer.source != nil {
+			go p.runGraphics(taskCtx, layer)
+		}
+		switch {
+		case layer.kind == "ticker":
+			go p.runTicker(taskCtx, layer)
+		case layer.kind == "text" && layer.refresh > 0:
+			go p.runTextRefresh(taskCtx, layer)
+		}
+	}
+	if scheduled {
+		go p.runSchedules(taskCtx, p.layers)
+	}
+
+	if p.switcher != nil {
+		go p.runFailover(taskCtx)
+		if p.slate != nil {
+			go p.watchSlate(taskCtx)
+		}
+	}
+
 	// Run main loop in a separate goroutine
 	go func() {
 		p.loop.Run()
@@ -608,8 +1371,106 @@ func (p *Pipeline) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop stops the pipeline
+// Stop stops the pipeline, it can't be restarted afterwards
 func (p *Pipeline) Stop() error {
+	if p.recovery != nil {
+		p.recovery.Stop()
+	}
+
+	p.restartMutex.Lock()
+	defer p.restartMutex.Unlock()
+	defer p.finish(nil)
+	return p.stop()
+}
+
+// Done returns a channel that is closed when the pipeline has stopped for good,
+// either by Stop or Dispose or by a failure it could not recover from
+func (p *Pipeline) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the failure that stopped the pipeline, or nil while it is running
+// and after Stop. The error is a *PipelineError.
+func (p *Pipeline) Err() error {
+	select {
+	case <-p.done:
+		if p.err != nil {
+			return p.err
+		}
+	default:
+	}
+	return nil
+}
+
+// Wait blocks until the pipeline has stopped for good and returns Err
+func (p *Pipeline) Wait() error {
+	<-p.done
+	return p.Err()
+}
+
+// fail reports a failure the pipeline can't recover from
+func (p *Pipeline) fail(err *PipelineError) {
+	p.logger.Errorf("Pipeline failed: %v", err)
+	p.finish(err)
+}
+
+// finish closes Done, only the first call takes effect
+func (p *Pipeline) finish(err *PipelineError) {
+	p.doneOnce.Do(func() {
+		p.err = err
+		close(p.done)
+	})
+}
+
+// Restart tears the pipeline down and rebuilds the element graph from the configuration.
+// Stop has released every GStreamer object, so restarting the old graph is not possible.
+// Restarts are serialized, and refused once the pipeline stopped for good.
+func (p *Pipeline) Restart() error {
+	p.restartMutex.Lock()
+	defer p.restartMutex.Unlock()
+	select {
+	case <-p.done:
+		return fmt.Errorf("pipeline has been stopped")
+	default:
+	}
+
+	p.mutex.RLock()
+	ctx := p.runCtx
+	p.mutex.RUnlock()
+	if ctx == nil {
+		return fmt.Errorf("pipeline has not been started")
+	}
+
+	p.logger.Info("Restarting pipeline...")
+	if err := p.stop(); err != nil {
+		return fmt.Errorf("failed to stop pipeline: %w", err)
+	}
+
+	p.mutex.Lock()
+	if p.pipeline != nil {
+		// stop does nothing for a pipeline that isn't running
+		p.cleanup()
+	}
+	p.resetBuildState()
+	err := p.buildPipeline()
+	if err != nil {
+		// Don't leave a half built graph behind for the next attempt
+		p.cleanup()
+	}
+	p.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to rebuild pipeline: %w", err)
+	}
+
+	if err := p.start(ctx); err != nil {
+		return err
+	}
+	p.stats.restarts.Add(1)
+	return nil
+}
+
+// stop stops the pipeline and releases its GStreamer objects
+func (p *Pipeline) stop() error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -622,6 +1483,11 @@ func (p *Pipeline) Stop() error {
 	// Mark as not running first to stop message processing
 	p.running = false
 
+	if p.taskCancel != nil {
+		p.taskCancel()
+		p.taskCancel = nil
+	}
+
 	// Set pipeline to null state
 	if p.pipeline != nil {
 		if err := p.pipeline.SetState(gst.StateNull); err != nil {
@@ -632,6 +1498,12 @@ func (p *Pipeline) Stop() error {
 		}
 	}
 
+	if p.slate != nil {
+		if err := p.slate.SetState(gst.StateNull); err != nil {
+			p.logger.Warnf("Failed to set slate to NULL state: %v", err)
+		}
+	}
+
 	// Quit main loop
 	if p.loop != nil {
 		p.loop.Quit()
@@ -642,12 +1514,23 @@ func (p *Pipeline) Stop() error {
 
 	// Perform cleanup
 	p.cleanup()
+	p.state = gst.StateNull
 
 	p.logger.Info("Pipeline stopped and cleaned up")
 
 	return nil
 }
 
+// PlaylistWindow returns the live window of the inspected media playlist
+func (p *Pipeline) PlaylistWindow() (LiveWindow, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.inspector == nil {
+		return LiveWindow{}, false
+	}
+	return p.inspector.Window(), true
+}
+
 // cleanup properly disposes of GStreamer objects to prevent memory leaks
 func (p *Pipeline) cleanup() {
 	p.logger.Info("Cleaning up GStreamer objects...")
@@ -659,13 +1542,20 @@ func (p *Pipeline) cleanup() {
 	// Clear element references (they're owned by the pipeline)
 	// Don't unref them individually as the pipeline owns them
 	p.source = nil
+	p.inputSink = nil
 	p.videoConv = nil
 	p.videoScale = nil
 	p.videoScaleCaps = nil
 	p.audioConv = nil
 	p.audioResamp = nil
 	p.audioRate = nil
-	p.overlay = nil
+	p.releaseLayerImages()
+	p.layers = nil
+	if p.filteredMaster != "" {
+		os.Remove(p.filteredMaster)
+		p.filteredMaster = ""
+	}
+	p.captions = nil
 	p.videoEnc = nil
 	p.audioEnc = nil
 	p.videoEncQueue = nil
@@ -675,6 +1565,11 @@ func (p *Pipeline) cleanup() {
 	p.mux = nil
 	p.sink = nil
 
+	if p.slate != nil {
+		p.slate.Unref()
+		p.slate = nil
+	}
+
 	// Finally, unref the pipeline (this will free all contained elements and the bus)
 	// Only unref if we still have a reference
 	if p.pipeline != nil {
@@ -727,13 +1622,29 @@ func (p *Pipeline) handleMessages(ctx context.Context) {
 				switch msg.Type() {
 				case gst.MessageEOS:
 					p.logger.Info("End of stream received")
+					eos := NewPipelineError(ErrorTypeInput, msg.Source(), "end of stream", "")
+					if p.recovery != nil {
+						p.recovery.HandleError(eos)
+					} else {
+						p.fail(eos)
+					}
 					return
 				case gst.MessageError:
 					err := msg.ParseError()
-					p.logger.Errorf("Pipeline error: %s", err.Error())
+					pipelineErr := p.pipelineError(msg, err)
+					p.stats.AddError(pipelineErr.Type)
+					p.logger.Errorf("Pipeline error: %v", pipelineErr)
 					if debug := err.DebugString(); debug != "" {
 						p.logger.Errorf("Debug: %s", debug)
 					}
+					if p.switcher != nil && p.isInputMessage(msg) {
+						// Failover handles input errors without restarting
+						go p.failInput(err.Error())
+					} else if p.recovery != nil {
+						p.recovery.HandleError(pipelineErr)
+					} else {
+						p.fail(pipelineErr)
+					}
 					return
 				case gst.MessageWarning:
 					err := msg.ParseWarning()
@@ -750,17 +1661,50 @@ func (p *Pipeline) handleMessages(ctx context.Context) {
 				case gst.MessageStateChanged:
 					if msg.Source() == p.pipeline.GetName() {
 						oldState, newState := msg.ParseStateChanged()
+						p.mutex.Lock()
+						p.state = newState
+						p.mutex.Unlock()
 						p.logger.Debugf("Pipeline state changed from %s to %s",
 							oldState.String(), newState.String())
 					}
+				case gst.MessageQoS:
+					p.handleQoS(msg)
+				case gst.MessageBuffering:
+					if p.adaptive != nil {
+						p.adaptive.SetBufferLevel(msg.ParseBuffering())
+					}
+				case gst.MessageElement:
+					if structure := msg.GetStructure(); structure != nil &&
+						structure.Name() == "adaptive-streaming-statistics" && p.adaptive != nil {
+						p.handleStreamingStatistics(structure)
+					}
+				case gst.MessageStreamCollection:
+					collection := msg.ParseStreamCollection()
+					p.logger.Infof("Stream collection received with %d streams", collection.GetSize())
+					p.selectStreams(collection)
 				case gst.MessageStreamsSelected:
 					p.logger.Info("Streams selected message received")
+					for i := uint(0); i < msg.StreamsSelectedSize(); i++ {
+						if stream := msg.StreamsSelectedGetStream(i); stream != nil {
+							p.logger.Infof("Playing stream %s", describeStream(stream))
+						}
+					}
 				}
 			}()
 		}
 	}
 }
 
+// pipelineError classifies an error message by its GError domain and source
+func (p *Pipeline) pipelineError(msg *gst.Message, err *gst.GError) *PipelineError {
+	domain, code := errorDomain(msg)
+	pipelineErr := NewPipelineError(ClassifyError(domain, code, p.isInputMessage(msg)),
+		msg.Source(), err.Error(), err.DebugString())
+	pipelineErr.Domain = domain
+	pipelineErr.Code = code
+	return pipelineErr
+}
+
 // IsRunning returns whether the pipeline is currently running
 func (p *Pipeline) IsRunning() bool {
 	p.mutex.RLock()
@@ -768,9 +1712,22 @@ func (p *Pipeline) IsRunning() bool {
 	return p.running
 }
 
+// State returns the pipeline state last reported on the bus
+func (p *Pipeline) State() gst.State {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.state
+}
+
 // Dispose properly cleans up all GStreamer resources
 // This should be called when the pipeline is no longer needed
 func (p *Pipeline) Dispose() {
+	if p.recovery != nil {
+		p.recovery.Stop()
+	}
+
+	p.restartMutex.Lock()
+	defer p.restartMutex.Unlock()
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -784,6 +1741,10 @@ func (p *Pipeline) Dispose() {
 		if p.loop != nil {
 			p.loop.Quit()
 		}
+		if p.taskCancel != nil {
+			p.taskCancel()
+			p.taskCancel = nil
+		}
 		p.running = false
 	}
 
@@ -793,6 +1754,8 @@ func (p *Pipeline) Dispose() {
 	// Clear the finalizer since we're cleaning up manually
 	runtime.SetFinalizer(p, nil)
 
+	p.finish(nil)
+
 	p.logger.Info("Pipeline disposed successfully")
 }
 
@@ -0,0 +1,278 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strings"
+
+	// Decoders for the size of image overlays
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// Safe area margins per edge as a share of the picture, following EBU R 95
+// (action safe 93%, title safe 90% of width and height)
+const (
+	actionSafeMargin = 0.035
+	titleSafeMargin  = 0.05
+)
+
+// Horizontal and vertical alignments of an anchor
+const (
+	alignStart  = "start" // Left or top
+	alignCenter = "center"
+	alignEnd    = "end" // Right or bottom
+)
+
+// anchorAlignment splits an anchor into its horizontal and vertical alignment, an
+// empty anchor is top-left
+func anchorAlignment(anchor string) (horizontal, vertical string, err error) {
+	switch anchor {
+	case "", "top-left":
+		return alignStart, alignStart, nil
+	case "top-center":
+		return alignCenter, alignStart, nil
+	case "top-right":
+		return alignEnd, alignStart, nil
+	case "center-left":
+		return alignStart, alignCenter, nil
+	case "center":
+		return alignCenter, alignCenter, nil
+	case "center-right":
+		return alignEnd, alignCenter, nil
+	case "bottom-left":
+		return alignStart, alignEnd, nil
+	case "bottom-center":
+		return alignCenter, alignEnd, nil
+	case "bottom-right":
+		return alignEnd, alignEnd, nil
+	default:
+		return "", "", fmt.Errorf("unknown overlay anchor %q, expected one of %s", anchor, anchorNames)
+	}
+}
+
+// ValidatePosition checks the anchor, units and safe area of an overlay position
+func ValidatePosition(position config.PositionConfig) error {
+	if _, _, err := anchorAlignment(position.Anchor); err != nil {
+		return err
+	}
+	switch position.Units {
+	case "", "pixels", "percent":
+	default:
+		return fmt.Errorf("unknown overlay position units %q", position.Units)
+	}
+	switch position.SafeArea {
+	case "", "action", "title":
+	default:
+		return fmt.Errorf("unknown overlay safe area %q", position.SafeArea)
+	}
+	return nil
+}
+
+// positionOffsets returns X and Y in pixels for a picture of the given size. Offsets
+// from an edge include the safe area margin, offsets from the center don't.
+func positionOffsets(position config.PositionConfig, width, height int) (dx, dy int) {
+	dx, dy = position.X, position.Y
+	if position.Units == "percent" {
+		dx = position.X * width / 100
+		dy = position.Y * height / 100
+	}
+
+	margin := 0.0
+	switch position.SafeArea {
+	case "action":
+		margin = actionSafeMargin
+	case "title":
+		margin = titleSafeMargin
+	}
+	horizontal, vertical, _ := anchorAlignment(position.Anchor)
+	if horizontal != alignCenter {
+		dx += int(margin * float64(width))
+	}
+	if vertical != alignCenter {
+		dy += int(margin * float64(height))
+	}
+	return dx, dy
+}
+
+// ResolvePosition returns the top-left corner of an overlay of overlayWidth x overlayHeight
+// on a picture of width x height. X and Y move the overlay away from the edges it is
+// anchored to, or right and down from the center.
+func ResolvePosition(position config.PositionConfig, width, height, overlayWidth, overlayHeight int) (x, y int) {
+	horizontal, vertical, _ := anchorAlignment(position.Anchor)
+	dx, dy := positionOffsets(position, width, height)
+	return alignedStart(horizontal, dx, width, overlayWidth), alignedStart(vertical, dy, height, overlayHeight)
+}
+
+// alignedStart returns where an overlay starts along one axis
+func alignedStart(align string, offset, size, overlaySize int) int {
+	switch align {
+	case alignCenter:
+		return (size-overlaySize)/2 + offset
+	case alignEnd:
+		return size - overlaySize - offset
+	default:
+		return offset
+	}
+}
+
+// imageSize returns the size of an image file, zero when it can't be decoded
+func imageSize(path string) (width, height int) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+// setupPosition places the element of a new layer and re-places it whenever the
+// video caps reaching it change
+func (p *Pipeline) setupPosition(layer *overlayLayer, overlay config.OverlayConfig) error {
+	if err := ValidatePosition(overlay.Position); err != nil {
+		return err
+	}
+
+	p.layoutMutex.Lock()
+	layer.layout = overlay.Position
+	layer.videoWidth, layer.videoHeight = p.selectedWidth, p.selectedHeight
+	if layer.kind == "image" {
+		p.resizeImage(layer)
+	}
+	p.placeOverlay(layer)
+	p.layoutMutex.Unlock()
+
+	layer.element.GetStaticPad(layer.videoPad()).AddProbe(gst.PadProbeTypeEventDownstream,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if event := info.GetEvent(); event != nil && event.Type() == gst.EventTypeCaps {
+				p.handleVideoCaps(layer, event.ParseCaps())
+			}
+			return gst.PadProbeOK
+		})
+	return nil
+}
+
+// handleVideoCaps re-places a layer when the video resolution changes
+func (p *Pipeline) handleVideoCaps(layer *overlayLayer, caps *gst.Caps) {
+	if caps == nil || caps.GetSize() == 0 {
+		return
+	}
+	structure := caps.GetStructureAt(0)
+	width, err := structure.GetValue("width")
+	if err != nil {
+		return
+	}
+	height, err := structure.GetValue("height")
+	if err != nil {
+		return
+	}
+	w, ok := toUint64(width)
+	if !ok {
+		return
+	}
+	h, ok := toUint64(height)
+	if !ok {
+		return
+	}
+
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	if int(w) == layer.videoWidth && int(h) == layer.videoHeight {
+		return
+	}
+	layer.videoWidth, layer.videoHeight = int(w), int(h)
+	p.logger.Infof("Overlay %s video resolution is %dx%d", layer.name, w, h)
+	if layer.kind == "image" {
+		p.resizeImage(layer)
+	}
+	p.placeOverlay(layer)
+}
+
+// setPosition moves the element of a live layer
+func (p *Pipeline) setPosition(layer *overlayLayer, overlay config.OverlayConfig) {
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	layer.layout = overlay.Position
+	p.placeOverlay(layer)
+}
+
+// placeOverlay sets the position properties of a layer element, layoutMutex must be
+// held
+func (p *Pipeline) placeOverlay(layer *overlayLayer) {
+	element := layer.element
+	dx, dy := positionOffsets(layer.layout, layer.videoWidth, layer.videoHeight)
+
+	switch layer.kind {
+	case "text", "subtitles":
+		// textoverlay aligns the text itself, it only needs the distance from the edges
+		horizontal, vertical, _ := anchorAlignment(layer.layout.Anchor)
+		element.SetProperty("halignment", textAlignment(horizontal, "left", "right"))
+		element.SetProperty("valignment", textAlignment(vertical, "top", "bottom"))
+		// Slides move the text by deltax and deltay
+		if horizontal == alignCenter {
+			element.SetProperty("xpad", 0)
+			element.SetProperty("deltax", dx+layer.slideX)
+		} else {
+			element.SetProperty("xpad", dx)
+			element.SetProperty("deltax", layer.slideX)
+		}
+		if vertical == alignCenter {
+			element.SetProperty("ypad", 0)
+			element.SetProperty("deltay", dy+layer.slideY)
+		} else {
+			element.SetProperty("ypad", dy)
+			element.SetProperty("deltay", layer.slideY)
+		}
+	case "image":
+		x, y := dx, dy
+		if layer.videoWidth > 0 && layer.videoHeight > 0 && layer.imageWidth > 0 && layer.imageHeight > 0 {
+			x, y = ResolvePosition(layer.layout, layer.videoWidth, layer.videoHeight, layer.imageWidth, layer.imageHeight)
+		} else if anchor := layer.layout.Anchor; anchor != "" && anchor != "top-left" {
+			p.logger.Debugf("Video or image size unknown, image overlay %s placed top-left until caps arrive", layer.name)
+		}
+		// Negative offsets would count from the right and bottom edges, only slides
+		// place images outside the video
+		element.SetProperty("offset-x", max(x, 0)+layer.slideX)
+		element.SetProperty("offset-y", max(y, 0)+layer.slideY)
+	case "graphics":
+		// Renderers place their graphics on frames of the video size
+		layer.requestRedraw()
+	case "ticker":
+		// The text scrolls along the middle of the bar
+		bar := tickerBarRect(layer.layout, layer.barHeight, layer.videoWidth, layer.videoHeight)
+		element.SetProperty("ypad", max(bar.Min.Y+(layer.barHeight-layer.textHeight)/2, 0))
+		if layer.bar != nil {
+			layer.requestRedraw()
+		}
+	}
+}
+
+// textAlignment maps an alignment to the textoverlay enum nick
+func textAlignment(align, start, end string) string {
+	switch align {
+	case alignCenter:
+		return "center"
+	case alignEnd:
+		return end
+	default:
+		return start
+	}
+}
+
+// anchorNames lists the supported anchors, for messages
+var anchorNames = strings.Join([]string{
+	"top-left", "top-center", "top-right",
+	"center-left", "center", "center-right",
+	"bottom-left", "bottom-center", "bottom-right",
+}, ", ")
@@ -0,0 +1,303 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// How often schedules are checked
+const scheduleInterval = time.Second
+
+// Forms of schedule windows
+const (
+	windowOnce     = "once"     // Absolute wall-clock times
+	windowDaily    = "daily"    // Times of day, repeated on every or selected weekdays
+	windowRelative = "relative" // Durations after the pipeline started
+)
+
+// Schedule tells when an overlay is shown
+type Schedule struct {
+	location *time.Location
+	windows  []scheduleWindow
+}
+
+// scheduleWindow is one time span of a schedule. Depending on the form, from and until
+// are absolute times or offsets from midnight or from the pipeline start.
+type scheduleWindow struct {
+	form        string
+	from, until time.Time
+	fromOffset  time.Duration
+	untilOffset time.Duration
+	openEnd     bool
+	days        map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// NewSchedule parses the schedule of an overlay
+func NewSchedule(cfg config.ScheduleConfig) (*Schedule, error) {
+	schedule := &Schedule{location: time.Local}
+	if cfg.Timezone != "" {
+		location, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule time zone %q: %w", cfg.Timezone, err)
+		}
+		schedule.location = location
+	}
+
+	for i, windowCfg := range cfg.Windows {
+		window, err := schedule.parseWindow(windowCfg)
+		if err != nil {
+			return nil, fmt.Errorf("schedule window %d: %w", i+1, err)
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	return schedule, nil
+}
+
+// parseWindow parses a window, the form is taken from its first end
+func (s *Schedule) parseWindow(cfg config.ScheduleWindow) (scheduleWindow, error) {
+	if cfg.From == "" && cfg.Until == "" {
+		return scheduleWindow{}, fmt.Errorf("needs from or until")
+	}
+	window := scheduleWindow{openEnd: cfg.Until == ""}
+
+	first := cfg.From
+	if first == "" {
+		first = cfg.Until
+	}
+	var err error
+	window.form, _, err = s.parseTime(first)
+	if err != nil {
+		return scheduleWindow{}, err
+	}
+
+	for _, end := range []struct {
+		value  string
+		time   *time.Time
+		offset *time.Duration
+	}{
+		{cfg.From, &window.from, &window.fromOffset},
+		{cfg.Until, &window.until, &window.untilOffset},
+	} {
+		if end.value == "" {
+			continue
+		}
+		form, value, err := s.parseTime(end.value)
+		if err != nil {
+			return scheduleWindow{}, err
+		}
+		if form != window.form {
+			return scheduleWindow{}, fmt.Errorf("from and until must both be %s times, got %q", window.form, end.value)
+		}
+		switch value := value.(type) {
+		case time.Time:
+			*end.time = value
+		case time.Duration:
+			*end.offset = value
+		}
+	}
+
+	if window.form == windowDaily {
+		if cfg.From == "" {
+			return scheduleWindow{}, fmt.Errorf("daily windows need from")
+		}
+		if window.openEnd {
+			window.untilOffset = 24 * time.Hour
+		}
+	} else if len(cfg.Days) > 0 {
+		return scheduleWindow{}, fmt.Errorf("days only apply to daily windows")
+	}
+
+	if len(cfg.Days) > 0 {
+		window.days = make(map[time.Weekday]bool)
+		for _, day := range cfg.Days {
+			weekday, ok := parseWeekday(day)
+			if !ok {
+				return scheduleWindow{}, fmt.Errorf("unknown weekday %q", day)
+			}
+			window.days[weekday] = true
+		}
+	}
+	return window, nil
+}
+
+// parseWeekday parses a weekday given as "mon" or "monday"
+func parseWeekday(day string) (time.Weekday, bool) {
+	day = strings.ToLower(day)
+	if weekday, ok := weekdays[day]; ok {
+		return weekday, true
+	}
+	for _, weekday := range weekdays {
+		if day == strings.ToLower(weekday.String()) {
+			return weekday, true
+		}
+	}
+	return 0, false
+}
+
+// parseTime parses one end of a window and tells its form
+func (s *Schedule) parseTime(value string) (string, interface{}, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return windowOnce, t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, s.location); err == nil {
+		return windowOnce, t, nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return windowDaily, time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+				time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return windowRelative, d, nil
+	}
+	return "", nil, fmt.Errorf("invalid time %q, expected a date and time, a time of day or a duration", value)
+}
+
+// Scheduled tells whether the schedule has windows
+func (s *Schedule) Scheduled() bool {
+	return s != nil && len(s.windows) > 0
+}
+
+// Active tells whether the overlay is shown at now for a pipeline started at started
+func (s *Schedule) Active(now, started time.Time) bool {
+	if !s.Scheduled() {
+		return true
+	}
+	for _, window := range s.windows {
+		if window.active(now.In(s.location), started) {
+			return true
+		}
+	}
+	return false
+}
+
+// active tells whether the window is open at now
+func (w scheduleWindow) active(now, started time.Time) bool {
+	switch w.form {
+	case windowOnce:
+		return (w.from.IsZero() || !now.Before(w.from)) && (w.openEnd || now.Before(w.until))
+	case windowRelative:
+		elapsed := now.Sub(started)
+		return elapsed >= w.fromOffset && (w.openEnd || elapsed < w.untilOffset)
+	default:
+		// A window ending before it starts runs past midnight, so it may have started
+		// the day before. Times are wall clock times, so a window keeps its hours on
+		// days with a daylight saving change.
+		endDays := 0
+		if w.untilOffset <= w.fromOffset {
+			endDays = 1
+		}
+		for _, daysAgo := range []int{0, 1} {
+			day := now.AddDate(0, 0, -daysAgo)
+			start := wallClock(day, 0, w.fromOffset)
+			if w.days != nil && !w.days[start.Weekday()] {
+				continue
+			}
+			if !now.Before(start) && now.Before(wallClock(day, endDays, w.untilOffset)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// wallClock returns the time of day offset on the day days after day, in its location
+func wallClock(day time.Time, days int, offset time.Duration) time.Time {
+	hour, minute, second := int(offset/time.Hour), int(offset/time.Minute%60), int(offset/time.Second%60)
+	return time.Date(day.Year(), day.Month(), day.Day()+days, hour, minute, second, 0, day.Location())
+}
+
+// runSchedules shows and hides scheduled layers until ctx is cancelled
+func (p *Pipeline) runSchedules(ctx context.Context, layers []*overlayLayer) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, layer := range layers {
+				p.updateVisibility(layer, false)
+			}
+		}
+	}
+}
+
+// updateVisibility shows or hides a layer by its enabled flag and schedule. Unless
+// forced, the element is only changed when the visibility changed.
+func (p *Pipeline) updateVisibility(layer *overlayLayer, force bool) {
+	p.textMutex.Lock()
+	started := p.startedAt
+	p.textMutex.Unlock()
+	now := time.Now()
+	if started.IsZero() {
+		started = now
+	}
+
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	active := layer.schedule.Active(now, started)
+	visible := layer.enabled && active
+	if visible == layer.visible && active == layer.onAir && !force {
+		return
+	}
+	if layer.schedule.Scheduled() && active != layer.onAir {
+		if active {
+			p.logger.Infof("Overlay %s schedule window opened", layer.name)
+		} else {
+			p.logger.Infof("Overlay %s schedule window closed", layer.name)
+		}
+	}
+	changed := visible != layer.visible
+	layer.visible = visible
+	layer.onAir = active
+
+	if changed && p.startTransition(layer, visible) {
+		return
+	}
+	if layer.animation != nil {
+		// The running transition ends in the right state
+		return
+	}
+	p.showLayer(layer, visible)
+}
+
+// showLayer shows or hides the element of a layer at once, layoutMutex must be held
+func (p *Pipeline) showLayer(layer *overlayLayer, visible bool) {
+	switch layer.kind {
+	case "text", "subtitles":
+		layer.element.SetProperty("silent", !visible)
+	case "image":
+		alpha := 0.0
+		if visible {
+			alpha = layer.alpha
+		}
+		layer.element.SetProperty("alpha", alpha)
+	case "graphics":
+		alpha := 0.0
+		if visible {
+			alpha = 1
+		}
+		layer.graphicsPad.SetProperty("alpha", alpha)
+	case "ticker":
+		layer.element.SetProperty("silent", !visible)
+		if layer.graphicsPad != nil {
+			alpha := 0.0
+			if visible {
+				alpha = 1
+			}
+			layer.graphicsPad.SetProperty("alpha", alpha)
+		}
+	}
+}
@@ -0,0 +1,624 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SCTE-35 splice command types
+const (
+	SpliceCommandNull      = 0x00
+	SpliceCommandSchedule  = 0x04
+	SpliceCommandInsert    = 0x05
+	SpliceCommandTime      = 0x06
+	SpliceCommandBandwidth = 0x07
+	SpliceCommandPrivate   = 0xFF
+)
+
+const (
+	scte35TableID = 0xFC
+	// cueiIdentifier is the "CUEI" identifier of SCTE-35 splice descriptors
+	cueiIdentifier = 0x43554549
+	// segmentationDescriptorTag identifies a segmentation_descriptor
+	segmentationDescriptorTag = 0x02
+	// ptsWrap is the modulus of 33 bit presentation timestamps
+	ptsWrap = 1 << 33
+)
+
+// CueType represents the kind of ad marker
+type CueType int
+
+const (
+	CueOut CueType = iota
+	CueIn
+	CueCancel
+)
+
+// String returns a string representation of the cue type
+func (t CueType) String() string {
+	switch t {
+	case CueOut:
+		return "CUE-OUT"
+	case CueIn:
+		return "CUE-IN"
+	case CueCancel:
+		return "CANCEL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// cueRepeatWindow is how long a cue hides the same event read from the other source
+const cueRepeatWindow = time.Minute
+
+// CueSource tells where a cue was detected
+type CueSource int
+
+const (
+	CueSourcePlaylist CueSource = iota
+	CueSourceStream
+)
+
+// String returns a string representation of the cue source
+func (s CueSource) String() string {
+	switch s {
+	case CueSourcePlaylist:
+		return "playlist"
+	case CueSourceStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+// CueEvent is an ad marker detected in the media playlist or in the transport stream
+type CueEvent struct {
+	Type      CueType
+	Source    CueSource
+	EventID   uint32
+	Duration  time.Duration // break duration, zero when unknown
+	Immediate bool
+	// PTS is the splice time in 90 kHz units with pts_adjustment applied, valid if HasPTS
+	PTS    uint64
+	HasPTS bool
+	// SequenceNumber of the media segment carrying a playlist cue
+	SequenceNumber int64
+	// EdgeOffset is how far the start of that segment was from the end of the playlist
+	// when the cue was found
+	EdgeOffset time.Duration
+	// Section is the splice_info_section the cue was decoded from, nil for CUE-OUT/CUE-IN tags
+	Section   *SpliceInfoSection
+	Timestamp time.Time
+}
+
+// String returns a human readable description of the cue
+func (c CueEvent) String() string {
+	s := fmt.Sprintf("%s event %d from %s", c.Type, c.EventID, c.Source)
+	if c.Duration > 0 {
+		s += fmt.Sprintf(", duration %s", c.Duration)
+	}
+	if c.HasPTS {
+		s += fmt.Sprintf(", pts %d", c.PTS)
+	} else if c.Immediate {
+		s += ", immediate"
+	}
+	return s
+}
+
+// CueRepeats drops the cues of an event already seen from the other source, when ad
+// markers are read from both the playlist and the stream. Cues of EXT-X-CUE-OUT and
+// EXT-X-CUE-IN tags have no event ID and match a cue of the same type.
+type CueRepeats struct {
+	recent []CueEvent
+}
+
+// Repeated reports whether a cue repeats one seen from the other source within a
+// minute, and remembers it otherwise
+func (r *CueRepeats) Repeated(cue CueEvent) bool {
+	kept := r.recent[:0]
+	for _, seen := range r.recent {
+		if cue.Timestamp.Sub(seen.Timestamp) <= cueRepeatWindow {
+			kept = append(kept, seen)
+		}
+	}
+	r.recent = kept
+
+	for i, seen := range r.recent {
+		if seen.Source != cue.Source && seen.Type == cue.Type &&
+			(seen.EventID == cue.EventID || seen.Section == nil || cue.Section == nil) {
+			// Each cue is repeated once, by the other source
+			r.recent = append(r.recent[:i], r.recent[i+1:]...)
+			return true
+		}
+	}
+	r.recent = append(r.recent, cue)
+	return false
+}
+
+// SpliceInfoSection is a decoded SCTE-35 splice_info_section
+type SpliceInfoSection struct {
+	ProtocolVersion uint8
+	Encrypted       bool
+	PTSAdjustment   uint64
+	Tier            uint16
+	CommandType     uint8
+	// SpliceInsert is set for splice_insert commands
+	SpliceInsert *SpliceInsert
+	// TimeSignal is set for time_signal commands
+	TimeSignal *SpliceTime
+	// Segmentation descriptors from the descriptor loop
+	Segmentations []SegmentationDescriptor
+}
+
+// SpliceTime is a splice_time() structure
+type SpliceTime struct {
+	Specified bool
+	PTS       uint64
+}
+
+// SpliceInsert is a splice_insert command
+type SpliceInsert struct {
+	EventID         uint32
+	Cancel          bool
+	OutOfNetwork    bool
+	ProgramSplice   bool
+	Immediate       bool
+	SpliceTime      SpliceTime
+	HasDuration     bool
+	AutoReturn      bool
+	Duration        uint64 // 90 kHz
+	UniqueProgramID uint16
+	AvailNum        uint8
+	AvailsExpected  uint8
+}
+
+// SegmentationDescriptor is a segmentation_descriptor from the splice descriptor loop
+type SegmentationDescriptor struct {
+	EventID          uint32
+	Cancel           bool
+	HasDuration      bool
+	Duration         uint64 // 90 kHz
+	UPIDType         uint8
+	UPID             []byte
+	TypeID           uint8
+	SegmentNum       uint8
+	SegmentsExpected uint8
+}
+
+// segmentationCueTypes maps segmentation_type_id values that start or end a break to cue types
+var segmentationCueTypes = map[uint8]CueType{
+	0x22: CueOut, 0x23: CueIn, // Break
+	0x30: CueOut, 0x31: CueIn, // Provider advertisement
+	0x32: CueOut, 0x33: CueIn, // Distributor advertisement
+	0x34: CueOut, 0x35: CueIn, // Provider placement opportunity
+	0x36: CueOut, 0x37: CueIn, // Distributor placement opportunity
+	0x44: CueOut, 0x45: CueIn, // Provider ad block
+	0x46: CueOut, 0x47: CueIn, // Distributor ad block
+}
+
+// ParseSpliceInfoSection decodes a binary SCTE-35 splice_info_section and verifies its CRC
+func ParseSpliceInfoSection(data []byte) (*SpliceInfoSection, error) {
+	if len(data) < 3 {
+		return nil, fmt.Errorf("section too short: %d bytes", len(data))
+	}
+	if data[0] != scte35TableID {
+		return nil, fmt.Errorf("unexpected table_id 0x%02X", data[0])
+	}
+
+	sectionLength := int(data[1]&0x0F)<<8 | int(data[2])
+	if len(data) < 3+sectionLength {
+		return nil, fmt.Errorf("section_length %d exceeds %d available bytes", sectionLength, len(data)-3)
+	}
+	data = data[:3+sectionLength]
+	if sectionLength < 17 {
+		return nil, fmt.Errorf("section_length %d too short", sectionLength)
+	}
+
+	if crc := crc32MPEG(data[:len(data)-4]); crc != be32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("CRC mismatch: computed 0x%08X, section has 0x%08X", crc, be32(data[len(data)-4:]))
+	}
+
+	section := &SpliceInfoSection{
+		ProtocolVersion: data[3],
+		Encrypted:       data[4]&0x80 != 0,
+		PTSAdjustment:   uint64(data[4]&0x01)<<32 | uint64(be32(data[5:9])),
+		Tier:            uint16(data[10])<<4 | uint16(data[11]>>4),
+	}
+	if section.Encrypted {
+		return nil, errors.New("encrypted splice_info_section is not supported")
+	}
+
+	commandLength := int(data[11]&0x0F)<<8 | int(data[12])
+	section.CommandType = data[13]
+
+	r := &bitReader{data: data[:len(data)-4], pos: 14}
+	commandStart := r.pos
+
+	var err error
+	switch section.CommandType {
+	case SpliceCommandInsert:
+		section.SpliceInsert, err = parseSpliceInsert(r)
+	case SpliceCommandTime:
+		var spliceTime SpliceTime
+		spliceTime, err = parseSpliceTime(r)
+		section.TimeSignal = &spliceTime
+	}
+	if err != nil {
+		return nil, fmt.Errorf("splice command 0x%02X: %w", section.CommandType, err)
+	}
+
+	// The legacy value 0xFFF means the command length is not given
+	if commandLength != 0xFFF {
+		r.pos = commandStart + commandLength
+	}
+
+	descriptorLoopLength, err := r.uint(16)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor_loop_length: %w", err)
+	}
+	loopEnd := r.pos + int(descriptorLoopLength)
+	if loopEnd > len(r.data) {
+		return nil, fmt.Errorf("descriptor loop exceeds section")
+	}
+
+	for r.pos < loopEnd {
+		tag, _ := r.uint(8)
+		length, err := r.uint(8)
+		if err != nil {
+			return nil, fmt.Errorf("splice descriptor: %w", err)
+		}
+		end := r.pos + int(length)
+		if end > loopEnd {
+			return nil, fmt.Errorf("splice descriptor 0x%02X exceeds descriptor loop", tag)
+		}
+
+		if tag == segmentationDescriptorTag {
+			descriptor := &bitReader{data: r.data[:end], pos: r.pos}
+			segmentation, err := parseSegmentationDescriptor(descriptor)
+			if err != nil {
+				return nil, fmt.Errorf("segmentation_descriptor: %w", err)
+			}
+			if segmentation != nil {
+				section.Segmentations = append(section.Segmentations, *segmentation)
+			}
+		}
+		r.pos = end
+	}
+
+	return section, nil
+}
+
+// parseSpliceTime reads a splice_time() structure
+func parseSpliceTime(r *bitReader) (SpliceTime, error) {
+	specified, err := r.flag()
+	if err != nil {
+		return SpliceTime{}, err
+	}
+	if !specified {
+		r.skip(7)
+		return SpliceTime{}, r.err()
+	}
+	r.skip(6)
+	pts, err := r.uint(33)
+	return SpliceTime{Specified: true, PTS: pts}, err
+}
+
+// parseSpliceInsert reads a splice_insert command
+func parseSpliceInsert(r *bitReader) (*SpliceInsert, error) {
+	insert := &SpliceInsert{}
+	eventID, _ := r.uint(32)
+	insert.EventID = uint32(eventID)
+	insert.Cancel, _ = r.flag()
+	r.skip(7)
+	if insert.Cancel {
+		return insert, r.err()
+	}
+
+	insert.OutOfNetwork, _ = r.flag()
+	insert.ProgramSplice, _ = r.flag()
+	insert.HasDuration, _ = r.flag()
+	insert.Immediate, _ = r.flag()
+	r.skip(4)
+	if err := r.err(); err != nil {
+		return nil, err
+	}
+
+	if insert.ProgramSplice && !insert.Immediate {
+		spliceTime, err := parseSpliceTime(r)
+		if err != nil {
+			return nil, err
+		}
+		insert.SpliceTime = spliceTime
+	}
+	if !insert.ProgramSplice {
+		// Component splices are reported with the time of the first component
+		count, _ := r.uint(8)
+		for i := 0; i < int(count); i++ {
+			r.skip(8)
+			if !insert.Immediate {
+				spliceTime, err := parseSpliceTime(r)
+				if err != nil {
+					return nil, err
+				}
+				if i == 0 {
+					insert.SpliceTime = spliceTime
+				}
+			}
+		}
+	}
+
+	if insert.HasDuration {
+		insert.AutoReturn, _ = r.flag()
+		r.skip(6)
+		insert.Duration, _ = r.uint(33)
+	}
+
+	uniqueProgramID, _ := r.uint(16)
+	insert.UniqueProgramID = uint16(uniqueProgramID)
+	availNum, _ := r.uint(8)
+	availsExpected, _ := r.uint(8)
+	insert.AvailNum, insert.AvailsExpected = uint8(availNum), uint8(availsExpected)
+
+	return insert, r.err()
+}
+
+// parseSegmentationDescriptor reads a segmentation_descriptor after its tag and length,
+// returning nil for descriptors of other identifiers
+func parseSegmentationDescriptor(r *bitReader) (*SegmentationDescriptor, error) {
+	identifier, err := r.uint(32)
+	if err != nil {
+		return nil, err
+	}
+	if identifier != cueiIdentifier {
+		return nil, nil
+	}
+
+	descriptor := &SegmentationDescriptor{}
+	eventID, _ := r.uint(32)
+	descriptor.EventID = uint32(eventID)
+	descriptor.Cancel, _ = r.flag()
+	r.skip(7)
+	if descriptor.Cancel {
+		return descriptor, r.err()
+	}
+
+	programSegmentation, _ := r.flag()
+	descriptor.HasDuration, _ = r.flag()
+	r.skip(6)
+
+	if !programSegmentation {
+		count, _ := r.uint(8)
+		// component_tag, reserved and pts_offset
+		r.skip(int(count) * 48)
+	}
+
+	if descriptor.HasDuration {
+		descriptor.Duration, _ = r.uint(40)
+	}
+
+	upidType, _ := r.uint(8)
+	upidLength, _ := r.uint(8)
+	descriptor.UPIDType = uint8(upidType)
+	descriptor.UPID, _ = r.bytes(int(upidLength))
+
+	typeID, _ := r.uint(8)
+	segmentNum, _ := r.uint(8)
+	segmentsExpected, _ := r.uint(8)
+	descriptor.TypeID = uint8(typeID)
+	descriptor.SegmentNum, descriptor.SegmentsExpected = uint8(segmentNum), uint8(segmentsExpected)
+
+	return descriptor, r.err()
+}
+
+// Cue converts the section into a cue event. It returns false for commands that
+// don't start or end a break, such as splice_null or unrelated time_signals.
+func (s *SpliceInfoSection) Cue() (CueEvent, bool) {
+	cue := CueEvent{Section: s}
+
+	switch {
+	case s.SpliceInsert != nil:
+		insert := s.SpliceInsert
+		cue.EventID = insert.EventID
+		switch {
+		case insert.Cancel:
+			cue.Type = CueCancel
+		case insert.OutOfNetwork:
+			cue.Type = CueOut
+		default:
+			cue.Type = CueIn
+		}
+		if insert.HasDuration {
+			cue.Duration = ticksToDuration(insert.Duration)
+		}
+		cue.Immediate = insert.Immediate
+		s.setPTS(&cue, insert.SpliceTime)
+		return cue, true
+	case s.TimeSignal != nil:
+		for _, segmentation := range s.Segmentations {
+			cueType, ok := segmentationCueTypes[segmentation.TypeID]
+			if segmentation.Cancel {
+				cueType, ok = CueCancel, true
+			}
+			if !ok {
+				continue
+			}
+			cue.Type = cueType
+			cue.EventID = segmentation.EventID
+			if segmentation.HasDuration {
+				cue.Duration = ticksToDuration(segmentation.Duration)
+			}
+			s.setPTS(&cue, *s.TimeSignal)
+			cue.Immediate = !cue.HasPTS
+			return cue, true
+		}
+	}
+
+	return CueEvent{}, false
+}
+
+// setPTS stores the adjusted splice time on a cue
+func (s *SpliceInfoSection) setPTS(cue *CueEvent, spliceTime SpliceTime) {
+	if spliceTime.Specified {
+		cue.PTS = (spliceTime.PTS + s.PTSAdjustment) % ptsWrap
+		cue.HasPTS = true
+	}
+}
+
+// Cues returns the cues signalled by the ad markers of a segment. EXT-X-DATERANGE
+// tags take precedence over EXT-X-CUE-OUT/EXT-X-CUE-IN, which many packagers write
+// alongside them. Undecodable SCTE-35 attributes are reported in the error while
+// the cue is still derived from the tag, as are marker tags the parser skipped.
+func (s HLSSegment) Cues() ([]CueEvent, error) {
+	var cues []CueEvent
+	errs := append([]error(nil), s.InvalidMarkers...)
+
+	// fromSection decodes a SCTE35 attribute, falling back to the direction implied by the attribute name
+	fromSection := func(dateRange HLSDateRange, data []byte, fallback CueType, hasFallback bool) {
+		var cue CueEvent
+		decoded := false
+		if section, err := ParseSpliceInfoSection(data); err != nil {
+			errs = append(errs, fmt.Errorf("daterange %q: %w", dateRange.ID, err))
+		} else {
+			cue, decoded = section.Cue()
+		}
+		if !decoded {
+			if !hasFallback {
+				return
+			}
+			cue = CueEvent{Type: fallback}
+		}
+		if cue.Type == CueOut && cue.Duration == 0 {
+			cue.Duration = secondsToDuration(dateRange.Duration)
+			if cue.Duration == 0 {
+				cue.Duration = secondsToDuration(dateRange.PlannedDuration)
+			}
+		}
+		cues = append(cues, cue)
+	}
+
+	for _, dateRange := range s.DateRanges {
+		if dateRange.SCTE35Out != nil {
+			fromSection(dateRange, dateRange.SCTE35Out, CueOut, true)
+		}
+		if dateRange.SCTE35In != nil {
+			fromSection(dateRange, dateRange.SCTE35In, CueIn, true)
+		}
+		if dateRange.SCTE35Cmd != nil {
+			// A bare command has no implied direction
+			fromSection(dateRange, dateRange.SCTE35Cmd, 0, false)
+		}
+	}
+
+	if len(cues) == 0 {
+		if s.CueOut {
+			cues = append(cues, CueEvent{
+				Type:      CueOut,
+				EventID:   uint32(s.SequenceNumber),
+				Duration:  secondsToDuration(s.CueOutDuration),
+				Immediate: true,
+			})
+		}
+		if s.CueIn {
+			cues = append(cues, CueEvent{
+				Type:      CueIn,
+				EventID:   uint32(s.SequenceNumber),
+				Immediate: true,
+			})
+		}
+	}
+
+	for i := range cues {
+		cues[i].Source = CueSourcePlaylist
+		cues[i].SequenceNumber = s.SequenceNumber
+	}
+
+	return cues, errors.Join(errs...)
+}
+
+// ticksToDuration converts 90 kHz ticks to a duration
+func ticksToDuration(ticks uint64) time.Duration {
+	return time.Duration(ticks) * time.Second / 90000
+}
+
+// secondsToDuration converts fractional seconds to a duration
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// crc32MPEG computes the CRC-32/MPEG-2 checksum used by MPEG-TS sections
+func crc32MPEG(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// be32 reads a big-endian uint32
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// bitReader reads big-endian bit fields, remembering the first overrun
+type bitReader struct {
+	data    []byte
+	pos     int // byte position
+	bit     int // bits consumed of data[pos]
+	overrun bool
+}
+
+// uint reads n bits, up to 64
+func (r *bitReader) uint(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data) {
+			r.overrun = true
+			return 0, r.err()
+		}
+		v = v<<1 | uint64(r.data[r.pos]>>(7-r.bit)&1)
+		r.bit++
+		if r.bit == 8 {
+			r.bit = 0
+			r.pos++
+		}
+	}
+	return v, nil
+}
+
+// flag reads a single bit
+func (r *bitReader) flag() (bool, error) {
+	v, err := r.uint(1)
+	return v == 1, err
+}
+
+// skip skips n bits
+func (r *bitReader) skip(n int) {
+	_, _ = r.uint(n)
+}
+
+// bytes reads n whole bytes
+func (r *bitReader) bytes(n int) ([]byte, error) {
+	if r.bit != 0 || r.pos+n > len(r.data) {
+		r.overrun = true
+		return nil, r.err()
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// err returns an error if a read ran past the data
+func (r *bitReader) err() error {
+	if r.overrun {
+		return errors.New("unexpected end of section")
+	}
+	return nil
+}
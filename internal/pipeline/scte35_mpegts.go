@@ -0,0 +1,125 @@
+package pipeline
+
+/*
+#cgo pkg-config: gstreamer-1.0 gstreamer-mpegts-1.0
+#include <gst/gst.h>
+#include <gst/mpegts/mpegts.h>
+
+// send_splice_insert sends a splice_insert section to mpegtsmux. splice_time and
+// duration are running times, GST_CLOCK_TIME_NONE splices immediately and a zero
+// duration omits the break duration.
+static gboolean
+send_splice_insert (GstElement * mux, guint16 pid, guint32 event_id,
+    gboolean out, GstClockTime splice_time, GstClockTime duration)
+{
+  GstMpegtsSCTESIT *sit;
+  GstMpegtsSection *section;
+  gboolean ret;
+
+  if (out)
+    sit = gst_mpegts_scte_splice_out_new (event_id, splice_time, duration);
+  else
+    sit = gst_mpegts_scte_splice_in_new (event_id, splice_time);
+
+  section = gst_mpegts_section_from_scte_sit (sit, pid);
+  ret = gst_mpegts_section_send_event (section, mux);
+  gst_mpegts_section_unref (section);
+
+  return ret;
+}
+
+// send_splice_cancel sends a splice_insert section cancelling an event to mpegtsmux
+static gboolean
+send_splice_cancel (GstElement * mux, guint16 pid, guint32 event_id)
+{
+  GstMpegtsSection *section;
+  gboolean ret;
+
+  section = gst_mpegts_section_from_scte_sit (gst_mpegts_scte_cancel_new (event_id), pid);
+  ret = gst_mpegts_section_send_event (section, mux);
+  gst_mpegts_section_unref (section);
+
+  return ret;
+}
+
+// scte35_section_data returns a copy of the splice_info_section carried by an
+// mpegts section event, or NULL for other events and section types
+static guint8 *
+scte35_section_data (GstEvent * event, gsize * size)
+{
+  GstMpegtsSection *section;
+  guint8 *data = NULL;
+  guint8 *packet;
+
+  section = gst_event_parse_mpegts_section (event);
+  if (section == NULL)
+    return NULL;
+
+  if (GST_MPEGTS_SECTION_TYPE (section) == GST_MPEGTS_SECTION_SCTE_SIT) {
+    packet = gst_mpegts_section_packetize (section, size);
+    if (packet != NULL)
+      data = g_memdup2 (packet, *size);
+  }
+  gst_mpegts_section_unref (section);
+
+  return data;
+}
+*/
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/go-gst/go-gst/gst"
+)
+
+var mpegtsInit sync.Once
+
+// initMpegts registers the mpegts section types, it must run before any other mpegts call
+func initMpegts() {
+	mpegtsInit.Do(func() {
+		C.gst_mpegts_initialize()
+	})
+}
+
+// sendSpliceInsert re-emits a cue into mpegtsmux as a splice_insert section splicing at
+// a running time, or immediately at gst.ClockTimeNone. A cancel cancels the event.
+func sendSpliceInsert(mux *gst.Element, pid uint16, cue CueEvent, spliceTime gst.ClockTime) bool {
+	initMpegts()
+
+	if cue.Type == CueCancel {
+		return C.send_splice_cancel((*C.GstElement)(mux.Unsafe()), C.guint16(pid), C.guint32(cue.EventID)) != 0
+	}
+
+	// A zero duration leaves the break duration out of the section
+	duration := C.GstClockTime(0)
+	if cue.Duration > 0 {
+		duration = C.GstClockTime(cue.Duration.Nanoseconds())
+	}
+
+	return C.send_splice_insert((*C.GstElement)(mux.Unsafe()), C.guint16(pid), C.guint32(cue.EventID),
+		gboolean(cue.Type == CueOut), C.GstClockTime(spliceTime), duration) != 0
+}
+
+// scte35SectionData returns the splice_info_section carried by a tsdemux section event
+func scte35SectionData(event *gst.Event) ([]byte, bool) {
+	initMpegts()
+
+	var size C.gsize
+	data := C.scte35_section_data((*C.GstEvent)(unsafe.Pointer(event.Instance())), &size)
+	if data == nil {
+		return nil, false
+	}
+	defer C.g_free(C.gpointer(data))
+
+	return C.GoBytes(unsafe.Pointer(data), C.int(size)), true
+}
+
+// gboolean converts a Go bool to a C gboolean
+func gboolean(b bool) C.gboolean {
+	if b {
+		return C.TRUE
+	}
+	return C.FALSE
+}
@@ -0,0 +1,212 @@
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+)
+
+// bitrateWindow is the period the encoder output bitrate is measured over
+const bitrateWindow = 5 * time.Second
+
+// Stats is a snapshot of the pipeline counters. Counters keep counting across
+// restarts of the same pipeline.
+type Stats struct {
+	FramesIn       uint64  // Video frames entering the processing chain
+	FramesOut      uint64  // Video frames leaving the encoder
+	FramesDropped  uint64  // Frames elements dropped, as reported by QoS messages
+	BytesSent      uint64  // Bytes handed to udpsink
+	EncoderBytes   uint64  // Bytes produced by the video encoder
+	EncoderBitrate float64 // Video encoder output in bits per second over the last measurement window
+	Restarts       uint64  // Times the pipeline was rebuilt and restarted
+	Errors         map[ErrorType]uint64
+
+	VideoQueue QueueLevel // Queue after the video encoder
+	AudioQueue QueueLevel // Queue after the audio encoder
+
+	// Variant of the master playlist being played, zero without a master playlist
+	VariantBandwidth int
+	VariantWidth     int
+	VariantHeight    int
+}
+
+// QueueLevel is the fill level of a queue element
+type QueueLevel struct {
+	Buffers uint64
+	Bytes   uint64
+	Time    time.Duration
+}
+
+// StatsCounters holds the counters behind Stats, the zero value is ready to use
+type StatsCounters struct {
+	framesIn     atomic.Uint64
+	framesOut    atomic.Uint64
+	bytesSent    atomic.Uint64
+	encoderBytes atomic.Uint64
+	restarts     atomic.Uint64
+
+	mutex         sync.Mutex
+	framesDropped uint64
+	qosDropped    map[string]uint64 // Drops last reported per element
+	errors        map[ErrorType]uint64
+	bitrate       float64
+	windowStart   time.Time
+	windowBytes   uint64
+}
+
+// AddEncoded counts encoder output and updates the bitrate once a window is complete
+func (s *StatsCounters) AddEncoded(bytes uint64, now time.Time) {
+	s.encoderBytes.Add(bytes)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+	s.windowBytes += bytes
+	if elapsed := now.Sub(s.windowStart); elapsed >= bitrateWindow {
+		s.bitrate = float64(s.windowBytes*8) / elapsed.Seconds()
+		s.windowStart = now
+		s.windowBytes = 0
+	}
+}
+
+// AddDropped records the drop count a QoS message reported for an element. QoS
+// messages carry the total since the element started, so only the increase counts.
+func (s *StatsCounters) AddDropped(element string, dropped uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.qosDropped == nil {
+		s.qosDropped = make(map[string]uint64)
+	}
+	if last := s.qosDropped[element]; dropped >= last {
+		s.framesDropped += dropped - last
+	} else {
+		// The element was recreated by a restart
+		s.framesDropped += dropped
+	}
+	s.qosDropped[element] = dropped
+}
+
+// AddError counts a bus error
+func (s *StatsCounters) AddError(errorType ErrorType) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.errors == nil {
+		s.errors = make(map[ErrorType]uint64)
+	}
+	s.errors[errorType]++
+}
+
+// ResetBuild forgets state tied to the elements of the previous build
+func (s *StatsCounters) ResetBuild() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.qosDropped = nil
+	s.windowStart = time.Time{}
+	s.windowBytes = 0
+	s.bitrate = 0
+}
+
+// Snapshot fills the counters of stats
+func (s *StatsCounters) Snapshot(stats *Stats, now time.Time) {
+	stats.FramesIn = s.framesIn.Load()
+	stats.FramesOut = s.framesOut.Load()
+	stats.BytesSent = s.bytesSent.Load()
+	stats.EncoderBytes = s.encoderBytes.Load()
+	stats.Restarts = s.restarts.Load()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats.FramesDropped = s.framesDropped
+	stats.Errors = make(map[ErrorType]uint64, len(s.errors))
+	for errorType, count := range s.errors {
+		stats.Errors[errorType] = count
+	}
+	// An encoder that stopped producing has no bitrate
+	if !s.windowStart.IsZero() && now.Sub(s.windowStart) < 2*bitrateWindow {
+		stats.EncoderBitrate = s.bitrate
+	}
+}
+
+// Stats returns the current pipeline counters, queue levels and variant
+func (p *Pipeline) Stats() Stats {
+	var stats Stats
+	p.stats.Snapshot(&stats, time.Now())
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	stats.VariantBandwidth = p.variant.Bandwidth
+	stats.VariantWidth = p.variant.Width
+	stats.VariantHeight = p.variant.Height
+	if p.running {
+		stats.VideoQueue = queueLevel(p.videoEncQueue)
+		stats.AudioQueue = queueLevel(p.audioEncQueue)
+	}
+	return stats
+}
+
+// watchStats counts frames entering the processing chain and leaving the encoder
+func (p *Pipeline) watchStats() {
+	stats := &p.stats
+	p.videoConv.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer,
+		func(*gst.Pad, *gst.PadProbeInfo) gst.PadProbeReturn {
+			stats.framesIn.Add(1)
+			return gst.PadProbeOK
+		})
+
+	p.videoEnc.GetStaticPad("src").AddProbe(gst.PadProbeTypeBuffer|gst.PadProbeTypeBufferList,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			buffers, bytes := probeSize(info)
+			stats.framesOut.Add(buffers)
+			stats.AddEncoded(bytes, time.Now())
+			return gst.PadProbeOK
+		})
+}
+
+// handleQoS counts frames dropped by the element that posted a QoS message
+func (p *Pipeline) handleQoS(msg *gst.Message) {
+	structure := msg.GetStructure()
+	if structure == nil {
+		return
+	}
+	value, err := structure.GetValue("dropped")
+	if err != nil {
+		return
+	}
+	if dropped, ok := toUint64(value); ok {
+		p.stats.AddDropped(msg.Source(), dropped)
+	}
+}
+
+// probeSize returns the number of buffers and bytes passing a probe
+func probeSize(info *gst.PadProbeInfo) (buffers, bytes uint64) {
+	if buffer := info.GetBuffer(); buffer != nil {
+		return 1, uint64(buffer.GetSize())
+	}
+	if list := info.GetBufferList(); list != nil {
+		return uint64(list.Length()), uint64(list.CalculateSize())
+	}
+	return 0, 0
+}
+
+// queueLevel reads the fill level of a queue element
+func queueLevel(queue *gst.Element) QueueLevel {
+	var level QueueLevel
+	if queue == nil {
+		return level
+	}
+	if value, err := queue.GetProperty("current-level-buffers"); err == nil {
+		level.Buffers, _ = toUint64(value)
+	}
+	if value, err := queue.GetProperty("current-level-bytes"); err == nil {
+		level.Bytes, _ = toUint64(value)
+	}
+	if value, err := queue.GetProperty("current-level-time"); err == nil {
+		nanoseconds, _ := toUint64(value)
+		level.Time = time.Duration(nanoseconds)
+	}
+	return level
+}
@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"strings"
+
+	"github.com/go-gst/go-gst/gst"
+)
+
+// streamPreferences describes which alternate audio and subtitle tracks playbin3 should play
+type streamPreferences struct {
+	audioLanguage    string
+	audioName        string
+	subtitleLanguage string
+	subtitleName     string
+	burnIn           bool // A subtitles overlay shows the subtitle track
+}
+
+// hasAudio reports whether an audio track preference is set
+func (s streamPreferences) hasAudio() bool {
+	return s.audioLanguage != "" || s.audioName != ""
+}
+
+// hasSubtitles reports whether a subtitle track preference is set or a subtitle track
+// is burnt in
+func (s streamPreferences) hasSubtitles() bool {
+	return s.subtitleLanguage != "" || s.subtitleName != "" || s.burnIn
+}
+
+// selectStreams picks one video, one audio and optionally one subtitle stream
+// from the collection, honouring the configured preferences
+func (s streamPreferences) selectStreams(collection *gst.StreamCollection) []*gst.Stream {
+	var video, audio, text []*gst.Stream
+	for i := uint(0); i < collection.GetSize(); i++ {
+		stream := collection.GetStreamAt(i)
+		if stream == nil {
+			continue
+		}
+		streamType := stream.StreamType()
+		switch {
+		case streamType&gst.StreamTypeVideo != 0:
+			video = append(video, stream)
+		case streamType&gst.StreamTypeAudio != 0:
+			audio = append(audio, stream)
+		case streamType&gst.StreamTypeText != 0:
+			text = append(text, stream)
+		}
+	}
+
+	var selected []*gst.Stream
+	if stream := pickStream(video, "", ""); stream != nil {
+		selected = append(selected, stream)
+	}
+	if stream := pickStream(audio, s.audioName, s.audioLanguage); stream != nil {
+		selected = append(selected, stream)
+	}
+	if s.hasSubtitles() {
+		if stream := pickStream(text, s.subtitleName, s.subtitleLanguage); stream != nil {
+			selected = append(selected, stream)
+		}
+	}
+
+	return selected
+}
+
+// pickStream returns the stream matching name or language, falling back to the
+// stream flagged for default selection and then the first stream
+func pickStream(streams []*gst.Stream, name, language string) *gst.Stream {
+	if len(streams) == 0 {
+		return nil
+	}
+
+	if name != "" {
+		for _, stream := range streams {
+			if title, _ := streamTag(stream, gst.TagTitle); strings.EqualFold(title, name) {
+				return stream
+			}
+		}
+	}
+
+	if language != "" {
+		for _, stream := range streams {
+			code, _ := streamTag(stream, gst.TagLanguageCode)
+			languageName, _ := streamTag(stream, gst.TagLanguageName)
+			if languageMatches(code, language) || strings.EqualFold(languageName, language) {
+				return stream
+			}
+		}
+	}
+
+	for _, stream := range streams {
+		if stream.StreamFlags()&gst.StreamFlagSelect != 0 {
+			return stream
+		}
+	}
+
+	return streams[0]
+}
+
+// streamTag returns a string tag of the stream
+func streamTag(stream *gst.Stream, tag gst.Tag) (string, bool) {
+	tags := stream.Tags()
+	if tags == nil {
+		return "", false
+	}
+	return tags.GetString(tag)
+}
+
+// describeStream returns a short human readable description of a stream
+func describeStream(stream *gst.Stream) string {
+	description := stream.StreamType().String()
+	if title, ok := streamTag(stream, gst.TagTitle); ok {
+		description += " \"" + title + "\""
+	}
+	if code, ok := streamTag(stream, gst.TagLanguageCode); ok {
+		description += " [" + code + "]"
+	}
+	return description + " (" + stream.StreamID() + ")"
+}
+
+// iso639Alpha2 maps common ISO 639-2 language codes to their ISO 639-1 equivalent
+var iso639Alpha2 = map[string]string{
+	"ara": "ar", "chi": "zh", "zho": "zh", "dan": "da", "dut": "nl", "nld": "nl",
+	"eng": "en", "fin": "fi", "fra": "fr", "fre": "fr", "ger": "de", "deu": "de",
+	"gre": "el", "ell": "el", "heb": "he", "hin": "hi", "ita": "it", "jpn": "ja",
+	"kor": "ko", "nor": "no", "pol": "pl", "por": "pt", "rus": "ru", "spa": "es",
+	"swe": "sv", "tur": "tr", "ukr": "uk",
+}
+
+// languageMatches compares two language tags by their primary subtag,
+// treating two and three letter ISO 639 codes as equivalent
+func languageMatches(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return normalizeLanguage(a) == normalizeLanguage(b)
+}
+
+// normalizeLanguage reduces a language tag such as "en-US" or "eng" to "en"
+func normalizeLanguage(tag string) string {
+	primary := strings.ToLower(strings.SplitN(strings.ReplaceAll(tag, "_", "-"), "-", 2)[0])
+	if alpha2, ok := iso639Alpha2[primary]; ok {
+		return alpha2
+	}
+	return primary
+}
@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/go-gst/go-gst/gst/app"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// Rendition cues without a duration are shown this long
+const defaultCueDuration = 4 * time.Second
+
+// subtitleState is the cues of a subtitle layer, guarded by the pipeline textMutex
+type subtitleState struct {
+	track  *SubtitleTrack
+	file   bool          // Cues of a file count from the first video frame
+	offset time.Duration // Shows cues later, or earlier when negative
+	origin time.Duration // Timestamp of the first video frame, negative until it arrived
+}
+
+// createSubtitlesLayer builds a subtitles layer: a textoverlay showing the cues of a
+// file or of the subtitle rendition of the input
+func (p *Pipeline) createSubtitlesLayer(layer *overlayLayer, overlay config.OverlayConfig) error {
+	subtitles := overlay.Subtitles
+	state := &subtitleState{
+		track:  NewSubtitleTrack(nil),
+		offset: time.Duration(subtitles.OffsetMs) * time.Millisecond,
+		origin: -1,
+	}
+	switch subtitles.Source {
+	case "rendition":
+	case "file":
+		if subtitles.Path == "" {
+			return fmt.Errorf("subtitles file source needs a path")
+		}
+		cues, err := LoadSubtitles(subtitles.Path)
+		if err != nil {
+			return err
+		}
+		if len(cues) == 0 {
+			p.logger.Warnf("Overlay %s: subtitles file %s has no cues", layer.name, subtitles.Path)
+		}
+		state.track = NewSubtitleTrack(cues)
+		state.file = true
+	default:
+		return fmt.Errorf("unknown subtitles source %q, use \"rendition\" or \"file\"", subtitles.Source)
+	}
+
+	var err error
+	layer.element, err = gst.NewElement("textoverlay")
+	if err != nil {
+		return fmt.Errorf("failed to create textoverlay: %w", err)
+	}
+	layer.element.SetProperty("font-desc", fmt.Sprintf("%s %d", overlay.Text.FontFamily, overlay.Text.FontSize))
+	// Lines wrap at the video width and are centered on each other, like captions
+	layer.element.SetProperty("line-alignment", "center")
+	if err := p.setupTextStyle(layer, overlay.Text); err != nil {
+		return err
+	}
+
+	p.textMutex.Lock()
+	layer.subtitles = state
+	p.textMutex.Unlock()
+	return nil
+}
+
+// renditionSubtitles reports whether a layer burns in the subtitle rendition. Hidden
+// layers count as well, the rendition is played so they can be shown at any time.
+func renditionSubtitles(overlay config.OverlayConfig) bool {
+	for _, layer := range overlay.LayerList() {
+		if layer.Type == "subtitles" && layer.Subtitles.Source == "rendition" {
+			return true
+		}
+	}
+	return false
+}
+
+// setupSubtitles feeds the subtitle layers from the input. Cues are shown by the
+// timestamps of the video leaving playbin3, rendition cues arrive on its text sink
+// timed like the video.
+func (p *Pipeline) setupSubtitles() error {
+	var layers, renditions []*overlayLayer
+	for _, layer := range p.layers {
+		if layer.subtitles == nil {
+			continue
+		}
+		layers = append(layers, layer)
+		if !layer.subtitles.file {
+			renditions = append(renditions, layer)
+		}
+	}
+	if len(layers) == 0 {
+		return nil
+	}
+
+	if len(renditions) > 0 {
+		sink, err := app.NewAppSink()
+		if err != nil {
+			return fmt.Errorf("failed to create subtitle appsink: %w", err)
+		}
+		sink.SetCaps(gst.NewCapsFromString("text/x-raw"))
+		// Subtitle streams are sparse, cues are kept until the video reaches them
+		sink.SetProperty("sync", false)
+		sink.SetProperty("async", false)
+		sink.SetCallbacks(&app.SinkCallbacks{
+			NewSampleFunc: func(sink *app.Sink) gst.FlowReturn {
+				sample := sink.PullSample()
+				if sample == nil {
+					return gst.FlowEOS
+				}
+				if buffer := sample.GetBuffer(); buffer != nil {
+					p.addSubtitleCue(renditions, buffer)
+				}
+				return gst.FlowOK
+			},
+		})
+
+		// Text goes to the text sink, playbin3 draws no subtitles of its own
+		// GST_PLAY_FLAG_VIDEO (1) + GST_PLAY_FLAG_AUDIO (2) + GST_PLAY_FLAG_TEXT (4) + GST_PLAY_FLAG_BUFFERING (16) = 23
+		p.source.SetProperty("flags", 23)
+		p.source.SetProperty("text-sink", sink.Element)
+		p.logger.Info("Subtitle rendition enabled for burn-in")
+	}
+
+	p.inputSink.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if buffer := info.GetBuffer(); buffer != nil {
+				if pts := buffer.PresentationTimestamp().AsDuration(); pts != nil {
+					p.showSubtitles(layers, *pts)
+				}
+			}
+			return gst.PadProbeOK
+		})
+	return nil
+}
+
+// addSubtitleCue adds a decoded subtitle buffer to the rendition layers
+func (p *Pipeline) addSubtitleCue(layers []*overlayLayer, buffer *gst.Buffer) {
+	start := buffer.PresentationTimestamp().AsDuration()
+	if start == nil {
+		return
+	}
+	text := SubtitleText(string(buffer.Bytes()))
+	if text == "" {
+		return
+	}
+	duration := defaultCueDuration
+	if d := buffer.Duration().AsDuration(); d != nil && *d > 0 {
+		duration = *d
+	}
+	cue := SubtitleCue{Start: *start, End: *start + duration, Text: text}
+
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	for _, layer := range layers {
+		// Cues arrive ahead of the video, those long past are dropped
+		layer.subtitles.track.Prune(cue.Start - time.Minute)
+		layer.subtitles.track.Add(cue)
+	}
+}
+
+// showSubtitles sets the cues shown at the input video frame at pts on the subtitle
+// layers
+func (p *Pipeline) showSubtitles(layers []*overlayLayer, pts time.Duration) {
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	for _, layer := range layers {
+		s := layer.subtitles
+		at := pts
+		if s.file {
+			if s.origin < 0 {
+				s.origin = pts
+			}
+			at -= s.origin
+		}
+
+		text := s.track.TextAt(at - s.offset)
+		if text == layer.lastText {
+			continue
+		}
+		layer.lastText = text
+		layer.element.SetProperty("text", layer.textStyle.Markup(text))
+	}
+}
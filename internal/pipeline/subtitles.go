@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubtitleCue is a subtitle shown from Start until End
+type SubtitleCue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // Plain text, lines separated by newlines
+}
+
+// LoadSubtitles reads the cues of an SRT or WebVTT file
+func LoadSubtitles(path string) ([]SubtitleCue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cues, err := ParseSubtitles(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cues, nil
+}
+
+// ParseSubtitles parses an SRT or WebVTT document into cues ordered by start. Blocks
+// without a timing line, like the WebVTT header, NOTE, STYLE and REGION blocks and SRT
+// cue numbers, are skipped. Cue settings are ignored, the overlay places the text.
+func ParseSubtitles(data string) ([]SubtitleCue, error) {
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+
+	var cues []SubtitleCue
+	for _, block := range strings.Split(data, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		if first := strings.TrimSpace(lines[0]); first == "NOTE" || strings.HasPrefix(first, "NOTE ") ||
+			first == "STYLE" || first == "REGION" {
+			continue
+		}
+
+		timing := -1
+		for i, line := range lines {
+			if strings.Contains(line, "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+
+		start, end, err := parseCueTiming(lines[timing])
+		if err != nil {
+			return nil, fmt.Errorf("cue %d: %w", len(cues)+1, err)
+		}
+		text := SubtitleText(strings.Join(lines[timing+1:], "\n"))
+		if text == "" || end <= start {
+			continue
+		}
+		cues = append(cues, SubtitleCue{Start: start, End: end, Text: text})
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+	return cues, nil
+}
+
+// parseCueTiming parses a "start --> end" line, settings after the end are ignored
+func parseCueTiming(line string) (start, end time.Duration, err error) {
+	parts := strings.SplitN(line, "-->", 2)
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("missing end time in %q", line)
+	}
+	if start, err = parseCueTime(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseCueTime(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseCueTime parses a cue time: "hh:mm:ss,mmm" in SRT, "hh:mm:ss.mmm" or "mm:ss.mmm"
+// in WebVTT
+func parseCueTime(value string) (time.Duration, error) {
+	parts := strings.Split(strings.Replace(value, ",", ".", 1), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid cue time %q", value)
+	}
+
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 || seconds >= 60 {
+		return 0, fmt.Errorf("invalid cue time %q", value)
+	}
+	total := time.Duration(seconds * float64(time.Second))
+	for i, unit := range []time.Duration{time.Minute, time.Hour}[:len(parts)-1] {
+		n, err := strconv.Atoi(parts[len(parts)-2-i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid cue time %q", value)
+		}
+		total += time.Duration(n) * unit
+	}
+	return total.Round(time.Millisecond), nil
+}
+
+var cueTag = regexp.MustCompile(`<[^>]*>`)
+
+// SubtitleText returns cue text as plain text. Tags like <i>, <c.yellow> and <v Name>
+// of WebVTT and SRT, and the Pango markup of decoded subtitle streams, are dropped and
+// entities are resolved. Blank lines are removed.
+func SubtitleText(text string) string {
+	lines := strings.Split(cueTag.ReplaceAllString(text, ""), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(html.UnescapeString(line)); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// SubtitleTrack holds the cues of a subtitle layer ordered by start
+type SubtitleTrack struct {
+	cues []SubtitleCue
+}
+
+// NewSubtitleTrack returns a track of cues
+func NewSubtitleTrack(cues []SubtitleCue) *SubtitleTrack {
+	t := &SubtitleTrack{}
+	for _, cue := range cues {
+		t.Add(cue)
+	}
+	return t
+}
+
+// Add adds a cue in start order. A cue the track already holds is added once, as
+// HLS repeats cues that span segments in each of them.
+func (t *SubtitleTrack) Add(cue SubtitleCue) {
+	i := sort.Search(len(t.cues), func(i int) bool { return t.cues[i].Start > cue.Start })
+	for j := i - 1; j >= 0 && t.cues[j].Start == cue.Start; j-- {
+		if t.cues[j] == cue {
+			return
+		}
+	}
+	t.cues = append(t.cues, SubtitleCue{})
+	copy(t.cues[i+1:], t.cues[i:])
+	t.cues[i] = cue
+}
+
+// Prune drops the cues that ended before a time
+func (t *SubtitleTrack) Prune(before time.Duration) {
+	kept := t.cues[:0]
+	for _, cue := range t.cues {
+		if cue.End >= before {
+			kept = append(kept, cue)
+		}
+	}
+	t.cues = kept
+}
+
+// Len returns the number of cues
+func (t *SubtitleTrack) Len() int {
+	return len(t.cues)
+}
+
+// TextAt returns the text shown at a time, the lines of overlapping cues in start
+// order, empty between cues
+func (t *SubtitleTrack) TextAt(at time.Duration) string {
+	var lines []string
+	for _, cue := range t.cues {
+		if cue.Start > at {
+			break
+		}
+		if at < cue.End && (len(lines) == 0 || lines[len(lines)-1] != cue.Text) {
+			lines = append(lines, cue.Text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
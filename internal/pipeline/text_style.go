@@ -0,0 +1,169 @@
+package pipeline
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+
+	"video-graphic-overlay-gstreamer/internal/color"
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// TextStyle holds the parsed colors of a text overlay
+type TextStyle struct {
+	Color      color.Color
+	Outline    *color.Color // nil keeps the textoverlay default outline
+	Background color.Color  // Transparent for no background box
+	Padding    int          // Pixels between the text and the edges of the background box
+}
+
+// ParseTextStyle parses the colors of a text overlay
+func ParseTextStyle(text config.TextOverlay) (TextStyle, error) {
+	style := TextStyle{Color: color.Color{R: 255, G: 255, B: 255, A: 255}, Padding: text.BackgroundPadding}
+
+	if text.Color != "" {
+		c, err := color.Parse(text.Color)
+		if err != nil {
+			return TextStyle{}, fmt.Errorf("invalid overlay text color: %w", err)
+		}
+		style.Color = c
+	}
+	if text.Outline != "" {
+		c, err := color.Parse(text.Outline)
+		if err != nil {
+			return TextStyle{}, fmt.Errorf("invalid overlay outline color: %w", err)
+		}
+		style.Outline = &c
+	}
+	if text.Background != "" {
+		c, err := color.Parse(text.Background)
+		if err != nil {
+			return TextStyle{}, fmt.Errorf("invalid overlay background color: %w", err)
+		}
+		style.Background = c
+	}
+	if style.Padding < 0 {
+		return TextStyle{}, fmt.Errorf("overlay background padding must not be negative, got %d", style.Padding)
+	}
+	return style, nil
+}
+
+// Markup returns plain text as Pango markup, drawn on the background box when there is
+// one. Every line gets its own box, padded left and right.
+func (s TextStyle) Markup(text string) string {
+	if s.Background.IsTransparent() {
+		return html.EscapeString(text)
+	}
+	return s.RevealMarkup(text, 1, "")
+}
+
+// RevealMarkup returns plain text as Pango markup with only a share of it shown, uncovered
+// from the left, right, top or bottom edge by characters or lines. Covered characters
+// keep their place, so the shown ones don't move.
+func (s TextStyle) RevealMarkup(text string, reveal float64, edge string) string {
+	box := !s.Background.IsTransparent()
+
+	// textoverlay renders at 72 dpi, so a point of letter spacing is a pixel
+	pad := " "
+	if s.Padding > 0 {
+		pad = fmt.Sprintf("<span letter_spacing='%d'> </span>", s.Padding*1024)
+	}
+	alpha := max(int(math.Round(s.Background.Opacity()*100)), 1)
+
+	lines := strings.Split(text, "\n")
+	shownLines := int(math.Round(reveal * float64(len(lines))))
+	for i, line := range lines {
+		runes := []rune(line)
+		start, end := 0, len(runes) // Shown characters
+		lineShown := reveal >= 1
+		switch edge {
+		case "top":
+			lineShown = i < shownLines
+		case "bottom":
+			lineShown = i >= len(lines)-shownLines
+		case "right":
+			start = len(runes) - int(math.Round(reveal*float64(len(runes))))
+			lineShown = start < end || lineShown
+		default:
+			end = int(math.Round(reveal * float64(len(runes))))
+			lineShown = start < end || lineShown
+		}
+		if !lineShown {
+			start, end = 0, 0
+		}
+
+		var b strings.Builder
+		if box {
+			fmt.Fprintf(&b, "<span background='#%s' bgalpha='%d%%'>", s.Background.Hex(), alpha)
+			b.WriteString(covered(pad, !lineShown || start > 0))
+		}
+		b.WriteString(covered(html.EscapeString(string(runes[:start])), true))
+		b.WriteString(html.EscapeString(string(runes[start:end])))
+		b.WriteString(covered(html.EscapeString(string(runes[end:])), true))
+		if box {
+			b.WriteString(covered(pad, !lineShown || end < len(runes)))
+			b.WriteString("</span>")
+		}
+		lines[i] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// covered returns markup drawn all but invisible when hidden, so it still takes its place
+func covered(markup string, hidden bool) string {
+	if !hidden || markup == "" {
+		return markup
+	}
+	return "<span fgalpha='1' bgalpha='1'>" + markup + "</span>"
+}
+
+// Faded returns the style with its colors at a share of their opacity
+func (s TextStyle) Faded(opacity float64) TextStyle {
+	if opacity >= 1 {
+		return s
+	}
+	fade := func(c color.Color) color.Color {
+		c.A = uint8(math.Round(float64(c.A) * max(opacity, 0)))
+		return c
+	}
+	s.Color = fade(s.Color)
+	// The default outline is opaque black
+	outline := color.Color{A: 255}
+	if s.Outline != nil {
+		outline = *s.Outline
+	}
+	outline = fade(outline)
+	s.Outline = &outline
+	if !s.Background.IsTransparent() {
+		// A fully faded box is drawn at the least alpha markup allows
+		s.Background = fade(s.Background)
+		s.Background.A = max(s.Background.A, 1)
+	}
+	return s
+}
+
+// setupTextStyle sets the colors of a new textoverlay element, the background box is
+// drawn by updateText
+func (p *Pipeline) setupTextStyle(layer *overlayLayer, text config.TextOverlay) error {
+	style, err := ParseTextStyle(text)
+	if err != nil {
+		return err
+	}
+
+	layer.element.SetProperty("color", style.Color.ARGB())
+	if style.Outline != nil {
+		layer.element.SetProperty("draw-outline", !style.Outline.IsTransparent())
+		layer.element.SetProperty("outline-color", style.Outline.ARGB())
+	}
+	if !style.Background.IsTransparent() {
+		// A shadow under the box only blurs its edges
+		layer.element.SetProperty("draw-shadow", false)
+	}
+
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	layer.textStyle = style
+	layer.lastText = ""
+	return nil
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// TemplateContext holds what overlay text templates are rendered with
+type TemplateContext struct {
+	Now     time.Time
+	Started time.Time     // When the pipeline was started, for uptime
+	PTS     time.Duration // Presentation timestamp of the frame, zero outside per-frame rendering
+	Channel string
+}
+
+// TextTemplate renders overlay text with Go text/template. Besides the data fields
+// {{.timestamp}}, {{.date}}, {{.time}} and {{.unix}} templates can call:
+//
+//	now                current time in the configured time zone
+//	in "UTC" t         t in another time zone
+//	format "15:04" t   t formatted with a Go time layout
+//	uptime             time since the pipeline was started
+//	pts                presentation timestamp of the frame
+//	channel            name of the channel
+type TextTemplate struct {
+	source   string
+	location *time.Location
+	tmpl     *template.Template
+
+	// Context of the render in progress, read by the template functions
+	mutex sync.Mutex
+	ctx   TemplateContext
+}
+
+// NewTextTemplate parses an overlay text template. Times are shown in timezone, an
+// IANA name such as "Europe/Berlin", or in local time when it is empty.
+func NewTextTemplate(text, timezone string) (*TextTemplate, error) {
+	location := time.Local
+	if timezone != "" {
+		var err error
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid overlay time zone %q: %w", timezone, err)
+		}
+	}
+
+	t := &TextTemplate{source: text, location: location}
+	tmpl, err := template.New("overlay").Option("missingkey=error").Funcs(template.FuncMap{
+		"now":     func() time.Time { return t.ctx.Now.In(t.location) },
+		"in":      inLocation,
+		"format":  func(layout string, tm time.Time) string { return tm.Format(layout) },
+		"uptime":  func() time.Duration { return t.ctx.Now.Sub(t.ctx.Started).Round(time.Second) },
+		"pts":     func() time.Duration { return t.ctx.PTS },
+		"channel": func() string { return t.ctx.Channel },
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid overlay text template: %w", err)
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// Dynamic tells whether the text changes between renders
+func (t *TextTemplate) Dynamic() bool {
+	return strings.Contains(t.source, "{{")
+}
+
+// Render renders the template
+func (t *TextTemplate) Render(ctx TemplateContext) (string, error) {
+	if !t.Dynamic() {
+		return t.source, nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.ctx = ctx
+
+	now := ctx.Now.In(t.location)
+	data := map[string]interface{}{
+		"timestamp": now.Format("2006-01-02 15:04:05"),
+		"date":      now.Format("2006-01-02"),
+		"time":      now.Format("15:04:05"),
+		"unix":      now.Unix(),
+	}
+
+	var text strings.Builder
+	if err := t.tmpl.Execute(&text, data); err != nil {
+		return "", fmt.Errorf("failed to render overlay text: %w", err)
+	}
+	return text.String(), nil
+}
+
+// inLocation converts tm to the named time zone
+func inLocation(name string, tm time.Time) (time.Time, error) {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return tm, err
+	}
+	return tm.In(location), nil
+}
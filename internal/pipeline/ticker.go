@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"video-graphic-overlay-gstreamer/internal/color"
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// tickerState is the scrolling of a ticker layer, guarded by the pipeline textMutex
+type tickerState struct {
+	source    TickerSource
+	speed     float64 // Pixels per second
+	separator string
+	fontSize  int
+	next      string        // Text of the next pass, from the latest items
+	text      string        // Text of the running pass
+	start     time.Duration // Timestamp of the first frame of the running pass
+	scrolling bool
+	deltaX    int
+}
+
+// createTickerLayer builds a ticker layer: a textoverlay scrolling the items over a
+// bar drawn by a graphics bin in front of it
+func (p *Pipeline) createTickerLayer(layer *overlayLayer, overlay config.OverlayConfig) error {
+	ticker := overlay.Ticker
+	if ticker.Speed <= 0 {
+		return fmt.Errorf("ticker speed must be positive, got %d", ticker.Speed)
+	}
+	if ticker.BarHeight < 0 {
+		return fmt.Errorf("ticker bar height must not be negative, got %d", ticker.BarHeight)
+	}
+	source, err := NewTickerSource(ticker)
+	if err != nil {
+		return err
+	}
+	layer.refresh = time.Duration(ticker.RefreshMs) * time.Millisecond
+	if layer.refresh <= 0 {
+		layer.refresh = time.Minute
+	}
+	layer.barHeight = ticker.BarHeight
+
+	bar := color.Transparent
+	if ticker.BarColor != "" {
+		if bar, err = color.Parse(ticker.BarColor); err != nil {
+			return fmt.Errorf("invalid ticker bar color: %w", err)
+		}
+	}
+	if !bar.IsTransparent() && ticker.BarHeight > 0 {
+		layer.renderer = &tickerBar{position: overlay.Position, height: ticker.BarHeight, color: bar}
+		if layer.bar, err = p.createGraphicsBin(layer); err != nil {
+			return err
+		}
+	}
+
+	layer.element, err = gst.NewElement("textoverlay")
+	if err != nil {
+		return fmt.Errorf("failed to create textoverlay: %w", err)
+	}
+	layer.element.SetProperty("font-desc", fmt.Sprintf("%s %d", overlay.Text.FontFamily, overlay.Text.FontSize))
+	// A pass is one line however long, scrolled by deltax from the left edge
+	layer.element.SetProperty("wrap-mode", "none")
+	layer.element.SetProperty("halignment", "left")
+	layer.element.SetProperty("valignment", "top")
+	layer.element.SetProperty("xpad", 0)
+	if err := p.setupTextStyle(layer, overlay.Text); err != nil {
+		return err
+	}
+
+	p.textMutex.Lock()
+	layer.ticker = &tickerState{
+		source:    source,
+		speed:     float64(ticker.Speed),
+		separator: ticker.Separator,
+		fontSize:  overlay.Text.FontSize,
+	}
+	p.textMutex.Unlock()
+
+	layer.element.GetStaticPad("video_sink").AddProbe(gst.PadProbeTypeBuffer,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if buffer := info.GetBuffer(); buffer != nil {
+				if pts := buffer.PresentationTimestamp().AsDuration(); pts != nil {
+					p.scrollTicker(layer, *pts)
+				}
+			}
+			return gst.PadProbeOK
+		})
+	return nil
+}
+
+// runTicker loads the items of a ticker layer until ctx is cancelled
+func (p *Pipeline) runTicker(ctx context.Context, layer *overlayLayer) {
+	ticker := time.NewTicker(layer.refresh)
+	defer ticker.Stop()
+
+	for {
+		items, err := layer.ticker.source.Items(ctx)
+		p.textMutex.Lock()
+		if err != nil {
+			// Report a failing source once and keep scrolling the last items
+			if err.Error() != layer.lastTextErr && ctx.Err() == nil {
+				layer.lastTextErr = err.Error()
+				p.logger.Warnf("Ticker %s items not loaded: %v", layer.name, err)
+			}
+		} else {
+			layer.lastTextErr = ""
+			layer.ticker.next = TickerText(items, layer.ticker.separator)
+		}
+		p.textMutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrollTicker moves the text of a ticker layer to the frame at pts. A pass starts at
+// the right edge and ends when the text has left at the left edge, the next one then
+// shows the latest items.
+func (p *Pipeline) scrollTicker(layer *overlayLayer, pts time.Duration) {
+	p.layoutMutex.Lock()
+	width := layer.videoWidth
+	if height, ok := textOverlaySize(layer.element, "text-height"); ok && height != layer.textHeight {
+		layer.textHeight = height
+		p.placeOverlay(layer)
+	}
+	p.layoutMutex.Unlock()
+	if width <= 0 {
+		return
+	}
+
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	t := layer.ticker
+	x := width
+	if t.scrolling {
+		x = width - int(t.speed*(pts-t.start).Seconds())
+		textWidth, ok := textOverlaySize(layer.element, "text-width")
+		if !ok {
+			// Before GStreamer 1.20 the rendered width is unknown, allow for wide glyphs
+			textWidth = len([]rune(t.text)) * t.fontSize
+		}
+		t.scrolling = x >= -textWidth
+	}
+
+	if !t.scrolling {
+		if t.next == "" {
+			return
+		}
+		t.text, t.start, t.scrolling, x = t.next, pts, true, width
+		layer.lastText = t.text
+		// Feed and file items are plain text, textMarkup escapes them
+		layer.element.SetProperty("text", layer.textMarkup(t.text))
+	}
+	if x != t.deltaX {
+		t.deltaX = x
+		layer.element.SetProperty("deltax", x)
+	}
+}
+
+// textOverlaySize reads a size textoverlay reports for the rendered text
+func textOverlaySize(element *gst.Element, name string) (int, bool) {
+	value, err := element.GetProperty(name)
+	if err != nil {
+		return 0, false
+	}
+	size, ok := toUint64(value)
+	if !ok || size == 0 {
+		return 0, false
+	}
+	return int(size), true
+}
+
+// tickerBarRect returns where the bar of a ticker is drawn on a picture of width x
+// height. The bar spans the width, the anchor and Y place it vertically.
+func tickerBarRect(position config.PositionConfig, barHeight, width, height int) image.Rectangle {
+	position.X = 0
+	_, y := ResolvePosition(position, width, height, width, barHeight)
+	return image.Rect(0, y, width, y+barHeight)
+}
+
+// tickerBar draws the bar behind a ticker
+type tickerBar struct {
+	position config.PositionConfig
+	height   int
+	color    color.Color
+}
+
+// Render draws the bar at its position
+func (b *tickerBar) Render(frame *image.NRGBA, _ TemplateContext) error {
+	r := tickerBarRect(b.position, b.height, frame.Bounds().Dx(), frame.Bounds().Dy())
+	draw.Draw(frame, r, image.NewUniform(b.color), image.Point{}, draw.Src)
+	return nil
+}
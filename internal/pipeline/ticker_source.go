@@ -0,0 +1,213 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// Time allowed for a ticker feed request
+const tickerFeedTimeout = 10 * time.Second
+
+// TickerSource provides the items a ticker overlay scrolls. Items are loaded when the
+// pipeline starts and every ticker.refresh_ms, the ticker picks up changes when it
+// starts its next pass.
+type TickerSource interface {
+	Items(ctx context.Context) ([]string, error)
+}
+
+// TickerSourceFactory creates the item source of a ticker overlay
+type TickerSourceFactory func(ticker config.TickerOverlay) (TickerSource, error)
+
+var (
+	tickerSourcesMutex sync.RWMutex
+	tickerSources      = map[string]TickerSourceFactory{
+		"static": newStaticTickerSource,
+		"file":   newFileTickerSource,
+		"http":   newHTTPTickerSource,
+	}
+)
+
+// RegisterTickerSource makes an item source available to ticker overlays as
+// ticker.source. Registering a name again replaces the source for pipelines created
+// afterwards.
+func RegisterTickerSource(name string, factory TickerSourceFactory) {
+	tickerSourcesMutex.Lock()
+	defer tickerSourcesMutex.Unlock()
+	tickerSources[name] = factory
+}
+
+// NewTickerSource creates the item source a ticker overlay names
+func NewTickerSource(ticker config.TickerOverlay) (TickerSource, error) {
+	name := ticker.Source
+	if name == "" {
+		name = "static"
+	}
+
+	tickerSourcesMutex.RLock()
+	factory, ok := tickerSources[name]
+	names := make([]string, 0, len(tickerSources))
+	for name := range tickerSources {
+		names = append(names, name)
+	}
+	tickerSourcesMutex.RUnlock()
+
+	if !ok {
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown ticker source %q, registered are %s", name, strings.Join(names, ", "))
+	}
+	return factory(ticker)
+}
+
+// TickerText joins the non-empty items of a ticker into the text of one pass
+func TickerText(items []string, separator string) string {
+	shown := make([]string, 0, len(items))
+	for _, item := range items {
+		// A pass is a single line
+		item = strings.Join(strings.Fields(item), " ")
+		if item != "" {
+			shown = append(shown, item)
+		}
+	}
+	return strings.Join(shown, separator)
+}
+
+// staticTickerSource scrolls the items listed in the configuration
+type staticTickerSource struct {
+	items []string
+}
+
+func newStaticTickerSource(ticker config.TickerOverlay) (TickerSource, error) {
+	if len(ticker.Items) == 0 {
+		return nil, fmt.Errorf("static ticker needs items")
+	}
+	return &staticTickerSource{items: append([]string(nil), ticker.Items...)}, nil
+}
+
+// Items returns the configured items
+func (s *staticTickerSource) Items(context.Context) ([]string, error) {
+	return s.items, nil
+}
+
+// fileTickerSource reads items from a local file, one per line. Empty lines and lines
+// starting with # are skipped.
+type fileTickerSource struct {
+	path string
+}
+
+func newFileTickerSource(ticker config.TickerOverlay) (TickerSource, error) {
+	if ticker.Path == "" {
+		return nil, fmt.Errorf("file ticker needs a path")
+	}
+	return &fileTickerSource{path: ticker.Path}, nil
+}
+
+// Items reads the file
+func (s *fileTickerSource) Items(context.Context) ([]string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			items = append(items, line)
+		}
+	}
+	return items, scanner.Err()
+}
+
+// httpTickerSource fetches items from a JSON feed, see ParseTickerFeed
+type httpTickerSource struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPTickerSource(ticker config.TickerOverlay) (TickerSource, error) {
+	if ticker.URL == "" {
+		return nil, fmt.Errorf("http ticker needs a url")
+	}
+	return &httpTickerSource{url: ticker.URL, client: &http.Client{Timeout: tickerFeedTimeout}}, nil
+}
+
+// Items fetches the feed
+func (s *httpTickerSource) Items(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ticker feed returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTickerFeed(data)
+}
+
+// ParseTickerFeed parses the items of a JSON ticker feed. The feed is a list of strings
+// or of objects with a "text" or "title", either alone or as the "items" of an object.
+func ParseTickerFeed(data []byte) ([]string, error) {
+	var wrapped struct {
+		Items json.RawMessage `json:"items"`
+	}
+	list := json.RawMessage(data)
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("invalid ticker feed: %w", err)
+		}
+		if wrapped.Items == nil {
+			return nil, fmt.Errorf("invalid ticker feed: object without items")
+		}
+		list = wrapped.Items
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(list, &entries); err != nil {
+		return nil, fmt.Errorf("invalid ticker feed: %w", err)
+	}
+
+	items := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		var text string
+		if err := json.Unmarshal(entry, &text); err == nil {
+			items = append(items, text)
+			continue
+		}
+		var object struct {
+			Text  string `json:"text"`
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(entry, &object); err != nil {
+			return nil, fmt.Errorf("invalid ticker feed item %d: %w", i+1, err)
+		}
+		if object.Text == "" {
+			object.Text = object.Title
+		}
+		items = append(items, object.Text)
+	}
+	return items, nil
+}
@@ -0,0 +1,371 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"video-graphic-overlay-gstreamer/internal/color"
+	"video-graphic-overlay-gstreamer/internal/config"
+)
+
+// Transition kinds
+const (
+	transitionFade  = "fade"  // Ramps the alpha
+	transitionSlide = "slide" // Moves in from or out to an edge of the video
+	transitionWipe  = "wipe"  // Uncovers or covers the overlay starting at an edge
+)
+
+// Default transition settings
+const (
+	defaultTransitionDuration = 500 * time.Millisecond
+	defaultTransitionEasing   = "ease-in-out"
+	defaultTransitionEdge     = "left"
+)
+
+// Images are wiped in this many steps, each a pre-rendered image
+const wipeSteps = 16
+
+var easings = map[string]func(float64) float64{
+	"linear":   func(t float64) float64 { return t },
+	"ease-in":  func(t float64) float64 { return t * t * t },
+	"ease-out": func(t float64) float64 { return 1 - math.Pow(1-t, 3) },
+	"ease-in-out": func(t float64) float64 {
+		if t < 0.5 {
+			return 4 * t * t * t
+		}
+		return 1 - math.Pow(-2*t+2, 3)/2
+	},
+}
+
+// Transition is a parsed in or out transition of an overlay
+type Transition struct {
+	Kind     string
+	Duration time.Duration
+	Edge     string
+	ease     func(float64) float64
+}
+
+// NewTransition parses a transition, nil when it has no type
+func NewTransition(cfg config.TransitionConfig) (*Transition, error) {
+	if cfg.Type == "" {
+		return nil, nil
+	}
+	switch cfg.Type {
+	case transitionFade, transitionSlide, transitionWipe:
+	default:
+		return nil, fmt.Errorf("unknown transition type %q, expected fade, slide or wipe", cfg.Type)
+	}
+
+	t := &Transition{Kind: cfg.Type, Duration: defaultTransitionDuration, Edge: defaultTransitionEdge}
+	if cfg.DurationMs < 0 {
+		return nil, fmt.Errorf("transition duration must not be negative, got %dms", cfg.DurationMs)
+	} else if cfg.DurationMs > 0 {
+		t.Duration = time.Duration(cfg.DurationMs) * time.Millisecond
+	}
+
+	easing := cfg.Easing
+	if easing == "" {
+		easing = defaultTransitionEasing
+	}
+	var ok bool
+	if t.ease, ok = easings[easing]; !ok {
+		return nil, fmt.Errorf("unknown transition easing %q, expected linear, ease-in, ease-out or ease-in-out", cfg.Easing)
+	}
+
+	switch cfg.Edge {
+	case "":
+	case "left", "right", "top", "bottom":
+		t.Edge = cfg.Edge
+	default:
+		return nil, fmt.Errorf("unknown transition edge %q, expected left, right, top or bottom", cfg.Edge)
+	}
+	return t, nil
+}
+
+// Progress returns the eased progress between 0 and 1 after elapsed running time
+func (t *Transition) Progress(elapsed time.Duration) float64 {
+	if elapsed >= t.Duration {
+		return 1
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return t.ease(float64(elapsed) / float64(t.Duration))
+}
+
+// animation is a transition running on a layer. It moves the shown share of the layer
+// from one value to another, timed by the buffers passing the layer element.
+type animation struct {
+	transition *Transition
+	from, to   float64
+	start      time.Duration // Timestamp of the first frame, negative until it arrived
+}
+
+// setupTransitions parses the transitions of a new layer and animates them from a probe
+// on its video pad
+func (p *Pipeline) setupTransitions(layer *overlayLayer, overlay config.OverlayConfig) error {
+	in, err := NewTransition(overlay.Transitions.In)
+	if err != nil {
+		return fmt.Errorf("in transition: %w", err)
+	}
+	out, err := NewTransition(overlay.Transitions.Out)
+	if err != nil {
+		return fmt.Errorf("out transition: %w", err)
+	}
+	if in == nil && out == nil {
+		return nil
+	}
+	if layer.kind != "text" && layer.kind != "image" {
+		p.logger.Warnf("Overlay %s: transitions only apply to text and image overlays, ignored", layer.name)
+		return nil
+	}
+
+	p.layoutMutex.Lock()
+	layer.transitionIn, layer.transitionOut = in, out
+	layer.shown = 1
+	p.layoutMutex.Unlock()
+
+	if layer.kind == "image" {
+		for _, t := range []*Transition{in, out} {
+			if t != nil && t.Kind == transitionSlide {
+				// Slides start and end outside the video, offsets then count from the
+				// top-left corner in both directions
+				layer.element.SetProperty("positioning-mode", "pixels-absolute")
+			}
+		}
+		p.prepareWipe(layer)
+	}
+
+	layer.element.GetStaticPad(layer.videoPad()).AddProbe(gst.PadProbeTypeBuffer,
+		func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if buffer := info.GetBuffer(); buffer != nil {
+				if pts := buffer.PresentationTimestamp().AsDuration(); pts != nil {
+					p.advanceTransition(layer, *pts)
+				}
+			}
+			return gst.PadProbeOK
+		})
+	return nil
+}
+
+// startTransition starts the in or out transition of a layer from where a running one
+// got to, layoutMutex must be held. It returns false when there is no such transition
+// and the layer is shown or hidden at once.
+func (p *Pipeline) startTransition(layer *overlayLayer, show bool) bool {
+	t, to := layer.transitionOut, 0.0
+	if show {
+		t, to = layer.transitionIn, 1.0
+	}
+
+	from := 1 - to
+	if running := layer.animation; running != nil {
+		from = layer.shown
+		if t == nil || running.transition.Kind != t.Kind {
+			p.setEffect(layer, running.transition, 1)
+		}
+		layer.animation = nil
+	}
+	if t == nil {
+		return false
+	}
+
+	if show {
+		p.showLayer(layer, true)
+	}
+	layer.animation = &animation{transition: t, from: from, to: to, start: -1}
+	p.setEffect(layer, t, from)
+	return true
+}
+
+// advanceTransition moves the running transition of a layer to the frame at pts
+func (p *Pipeline) advanceTransition(layer *overlayLayer, pts time.Duration) {
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	a := layer.animation
+	if a == nil {
+		return
+	}
+	if a.start < 0 {
+		a.start = pts
+	}
+
+	progress := a.transition.Progress(pts - a.start)
+	p.setEffect(layer, a.transition, a.from+(a.to-a.from)*progress)
+	if progress < 1 {
+		return
+	}
+
+	// Leave the layer at rest, hidden by the usual means after an out transition
+	layer.animation = nil
+	p.setEffect(layer, a.transition, 1)
+	if a.to == 0 {
+		p.showLayer(layer, false)
+	}
+}
+
+// setEffect draws a layer with the share shown of a transition, 1 being the layer at
+// rest. layoutMutex must be held.
+func (p *Pipeline) setEffect(layer *overlayLayer, t *Transition, shown float64) {
+	layer.shown = shown
+	switch t.Kind {
+	case transitionFade:
+		if layer.kind == "text" {
+			p.setTextEffect(layer, 1-shown, 0, "")
+		} else {
+			layer.element.SetProperty("alpha", layer.alpha*shown)
+		}
+	case transitionSlide:
+		layer.slideX, layer.slideY = 0, 0
+		switch t.Edge {
+		case "left":
+			layer.slideX = -int(math.Round((1 - shown) * float64(layer.videoWidth)))
+		case "right":
+			layer.slideX = int(math.Round((1 - shown) * float64(layer.videoWidth)))
+		case "top":
+			layer.slideY = -int(math.Round((1 - shown) * float64(layer.videoHeight)))
+		case "bottom":
+			layer.slideY = int(math.Round((1 - shown) * float64(layer.videoHeight)))
+		}
+		p.placeOverlay(layer)
+	case transitionWipe:
+		if layer.kind == "text" {
+			p.setTextEffect(layer, 0, 1-shown, t.Edge)
+		} else {
+			p.setWipeFrame(layer, t.Edge, shown)
+		}
+	}
+}
+
+// setTextEffect fades a text layer and covers a share of its text from an edge. The
+// shadow isn't drawn while either applies and the outline isn't while the text is
+// covered, as textoverlay draws them for all of the text at full strength.
+func (p *Pipeline) setTextEffect(layer *overlayLayer, fade, cover float64, edge string) {
+	p.textMutex.Lock()
+	defer p.textMutex.Unlock()
+	layer.textFade, layer.textCover, layer.coverEdge = fade, cover, edge
+
+	style := layer.textStyle.Faded(1 - fade)
+	layer.element.SetProperty("color", style.Color.ARGB())
+	outlineColor := color.Color{A: 255} // The textoverlay default
+	if style.Outline != nil {
+		outlineColor = *style.Outline
+	}
+	layer.element.SetProperty("outline-color", outlineColor.ARGB())
+	outline := layer.textStyle.Outline == nil || !layer.textStyle.Outline.IsTransparent()
+	layer.element.SetProperty("draw-outline", outline && cover == 0)
+	layer.element.SetProperty("draw-shadow", layer.textStyle.Background.IsTransparent() && fade == 0 && cover == 0)
+	if layer.lastText != "" {
+		layer.element.SetProperty("text", layer.textMarkup(layer.lastText))
+	}
+}
+
+// textMarkup returns the markup of a text with the running transition applied,
+// textMutex must be held
+func (layer *overlayLayer) textMarkup(text string) string {
+	style := layer.textStyle.Faded(1 - layer.textFade)
+	if layer.textCover == 0 {
+		return style.Markup(text)
+	}
+	return style.RevealMarkup(text, 1-layer.textCover, layer.coverEdge)
+}
+
+// prepareWipe renders the steps of the image wipes of a layer, animations are wiped on
+// their first frame. Without steps images are faded instead.
+func (p *Pipeline) prepareWipe(layer *overlayLayer) {
+	p.layoutMutex.Lock()
+	img := layer.currentImage()
+	p.layoutMutex.Unlock()
+
+	edges := map[string]bool{}
+	for _, t := range []*Transition{layer.transitionIn, layer.transitionOut} {
+		if t != nil && t.Kind == transitionWipe {
+			edges[t.Edge] = true
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+
+	var frames map[string][]*image.NRGBA
+	if img != nil {
+		frames = map[string][]*image.NRGBA{}
+		for edge := range edges {
+			frames[edge] = wipeFrames(img, edge)
+		}
+	} else {
+		p.logger.Warnf("Overlay %s image wipe not prepared without an image, fading instead", layer.name)
+	}
+
+	p.layoutMutex.Lock()
+	layer.wipeFrames, layer.wipeStep = frames, wipeSteps
+	p.layoutMutex.Unlock()
+}
+
+// wipeFrames returns img uncovered from edge in wipeSteps steps, the first one fully
+// covered
+func wipeFrames(img *image.NRGBA, edge string) []*image.NRGBA {
+	frames := make([]*image.NRGBA, wipeSteps)
+	for step := range frames {
+		frames[step] = image.NewNRGBA(img.Bounds())
+		shown := RevealRect(img.Bounds(), float64(step)/wipeSteps, edge)
+		draw.Draw(frames[step], shown, img, shown.Min, draw.Src)
+	}
+	return frames
+}
+
+// RevealRect returns the part of bounds shown when a share of it is uncovered from edge
+func RevealRect(bounds image.Rectangle, share float64, edge string) image.Rectangle {
+	r := bounds
+	width := int(math.Round(share * float64(bounds.Dx())))
+	height := int(math.Round(share * float64(bounds.Dy())))
+	switch edge {
+	case "right":
+		r.Min.X = r.Max.X - width
+	case "top":
+		r.Max.Y = r.Min.Y + height
+	case "bottom":
+		r.Min.Y = r.Max.Y - height
+	default:
+		r.Max.X = r.Min.X + width
+	}
+	return r
+}
+
+// setWipeFrame shows the wipe step of an image layer closest to the shown share,
+// layoutMutex must be held
+func (p *Pipeline) setWipeFrame(layer *overlayLayer, edge string, shown float64) {
+	frames := layer.wipeFrames[edge]
+	if len(frames) == 0 {
+		layer.element.SetProperty("alpha", layer.alpha*shown)
+		return
+	}
+
+	step := int(math.Round(shown * wipeSteps))
+	if step == layer.wipeStep {
+		return
+	}
+	layer.wipeStep = step
+	frame := layer.currentImage()
+	if step < wipeSteps {
+		frame = frames[step]
+	}
+	if frame != nil {
+		setOverlayImage(layer.element, frame)
+	}
+}
+
+// releaseLayerImages drops the decoded images and wipe steps of the layers
+func (p *Pipeline) releaseLayerImages() {
+	p.layoutMutex.Lock()
+	defer p.layoutMutex.Unlock()
+	for _, layer := range p.layers {
+		layer.imageSources, layer.imageFrames, layer.wipeFrames = nil, nil, nil
+		// Pre-scaling still running is dropped
+		layer.imageGeneration++
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"video-graphic-overlay-gstreamer/internal/api"
+	"video-graphic-overlay-gstreamer/internal/channel"
 	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/metrics"
 	"video-graphic-overlay-gstreamer/internal/pipeline"
 	"video-graphic-overlay-gstreamer/pkg/logger"
 )
@@ -27,10 +31,23 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if len(cfg.Channels) > 0 || serving(cfg) {
+		runChannels(configPath, cfg, log)
+		return
+	}
+
 	log.Infof("Starting video graphic overlay pipeline")
 	log.Infof("HLS Input: %s", cfg.Input.HLSUrl)
 	log.Infof("UDP Output: %s:%d", cfg.Output.Host, cfg.Output.Port)
 
+	// Exit with a failure status once cleanup has run if the pipeline failed
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -66,6 +83,21 @@ func main() {
 		cancel()
 	case err := <-errChan:
 		log.Errorf("Pipeline error: %v", err)
+		exitCode = 1
+		cancel()
+	case <-p.Done():
+		if err := p.Err(); err != nil {
+			var pipelineErr *pipeline.PipelineError
+			if errors.As(err, &pipelineErr) && pipelineErr.Domain != "" {
+				log.Errorf("Pipeline failed: %v (%s code %d)", err, pipelineErr.Domain, pipelineErr.Code)
+			} else {
+				log.Errorf("Pipeline failed: %v", err)
+			}
+			if pipelineErr != nil && pipelineErr.Debug != "" {
+				log.Errorf("Debug: %s", pipelineErr.Debug)
+			}
+			exitCode = 1
+		}
 		cancel()
 	}
 
@@ -76,3 +108,94 @@ func main() {
 
 	log.Info("Pipeline stopped successfully")
 }
+
+// server is an HTTP endpoint running next to the channels
+type server interface {
+	Start() error
+	Stop() error
+}
+
+// serving tells whether the control API or the metrics endpoint is enabled, they
+// need the channel manager
+func serving(cfg *config.Config) bool {
+	return cfg.API.Enabled || cfg.Metrics.Enabled
+}
+
+// runChannels runs every channel of a multi-channel configuration, and the control API
+// and metrics endpoint when enabled, until SIGINT or SIGTERM. SIGHUP reloads the configuration, only changed
+// channels are restarted.
+func runChannels(configPath string, cfg *config.Config, log *logger.Logger) {
+	channels := channelConfigs(cfg)
+	log.Infof("Starting %d channels", len(channels))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := channel.NewManager(log.Logger)
+	if err := manager.Start(ctx, channels); err != nil {
+		log.Fatalf("Failed to start channels: %v", err)
+	}
+
+	var servers []server
+	if cfg.API.Enabled {
+		servers = append(servers, api.NewServer(cfg.API.Listen, manager, log.Logger))
+	}
+	if cfg.Metrics.Enabled {
+		servers = append(servers, metrics.NewServer(cfg.Metrics.Listen, manager, log.Logger))
+	}
+	for i, server := range servers {
+		if err := server.Start(); err != nil {
+			for _, started := range servers[:i] {
+				started.Stop()
+			}
+			manager.Stop()
+			log.Fatalf("Failed to start HTTP server: %v", err)
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			log.Infof("Received signal %v, shutting down...", sig)
+			break
+		}
+
+		log.Info("Reloading configuration...")
+		reloaded, err := config.Load(configPath)
+		if err != nil {
+			log.Errorf("Failed to reload configuration: %v", err)
+			continue
+		}
+		if len(reloaded.Channels) == 0 && !serving(reloaded) {
+			log.Error("Reloaded configuration has no channels, keeping the current ones")
+			continue
+		}
+		if err := manager.Reload(channelConfigs(reloaded)); err != nil {
+			log.Errorf("Failed to apply configuration: %v", err)
+		}
+	}
+
+	for _, server := range servers {
+		if err := server.Stop(); err != nil {
+			log.Warnf("Error stopping HTTP server: %v", err)
+		}
+	}
+	cancel()
+	manager.Stop()
+	log.Info("Application shutdown complete")
+}
+
+// channelConfigs returns the channels of cfg. A configuration without channels runs
+// as a single channel named "default" so the control API and metrics can cover it.
+func channelConfigs(cfg *config.Config) []config.ChannelConfig {
+	if len(cfg.Channels) > 0 {
+		return cfg.Channels
+	}
+	return []config.ChannelConfig{{
+		Name:          "default",
+		RestartPolicy: config.RestartOnFailure,
+		Config:        *cfg,
+	}}
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestFilterStreamsByBitrate(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080
+1080p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360
+360p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720
+720p.m3u8
+`), "http://example.com/master.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse master playlist: %v", err)
+	}
+
+	streams, err := playlist.FilterStreams(pipeline.StreamFilter{})
+	if err != nil || len(streams) != 3 || streams[0].Bandwidth != 800000 || streams[2].Bandwidth != 5000000 {
+		t.Errorf("Expected all streams by ascending bandwidth, got %+v", streams)
+	}
+
+	streams, err = playlist.FilterStreams(pipeline.StreamFilter{MinBitrate: 1000000, MaxBitrate: 3000000})
+	if err != nil || len(streams) != 1 || streams[0].Height != 720 {
+		t.Errorf("Expected only the 720p stream, got %+v", streams)
+	}
+
+	if streams, err := playlist.FilterStreams(pipeline.StreamFilter{MinBitrate: 6000000}); !errors.Is(err, pipeline.ErrNoMatchingStream) {
+		t.Errorf("Expected no streams, got %+v, %v", streams, err)
+	}
+}
+
+func TestAdaptiveController(t *testing.T) {
+	variants := []pipeline.HLSStream{
+		{Bandwidth: 5000000, URL: "1080p.m3u8"},
+		{Bandwidth: 800000, URL: "360p.m3u8"},
+		{Bandwidth: 2500000, URL: "720p.m3u8"},
+	}
+	controller := pipeline.NewAdaptiveController(variants, 10*time.Second, 0.8)
+	start := time.Now()
+
+	if controller.Current().Bandwidth != 800000 {
+		t.Fatalf("Expected to start at the lowest variant, got %+v", controller.Current())
+	}
+	if _, ok := controller.Decide(start.Add(time.Minute)); ok {
+		t.Error("Expected no switch without throughput samples")
+	}
+
+	// 10 Mbps is enough for every variant, but up-switches wait for the hold time
+	controller.AddSample(1250000, time.Second)
+	if _, ok := controller.Decide(start.Add(time.Second)); ok {
+		t.Error("Expected no switch within the hold time")
+	}
+
+	// Switch up one step at a time
+	stream, ok := controller.Decide(start.Add(11 * time.Second))
+	if !ok || stream.URL != "720p.m3u8" {
+		t.Errorf("Expected switch up to 720p, got %+v (%v)", stream, ok)
+	}
+	if _, ok := controller.Decide(start.Add(12 * time.Second)); ok {
+		t.Error("Expected hold time to restart after a switch")
+	}
+
+	// A low buffer blocks switching up
+	controller.SetBufferLevel(40)
+	if _, ok := controller.Decide(start.Add(30 * time.Second)); ok {
+		t.Error("Expected no up-switch with a low buffer")
+	}
+
+	// Throughput collapse switches down immediately
+	controller.SetBufferLevel(100)
+	for i := 0; i < 10; i++ {
+		controller.AddSample(100000, time.Second)
+	}
+	stream, ok = controller.Decide(start.Add(31 * time.Second))
+	if !ok || stream.URL != "360p.m3u8" {
+		t.Errorf("Expected switch down to 360p, got %+v (%v)", stream, ok)
+	}
+}
+
+func TestAdaptiveControllerDrainingBuffer(t *testing.T) {
+	variants := []pipeline.HLSStream{
+		{Bandwidth: 800000, URL: "360p.m3u8"},
+		{Bandwidth: 2500000, URL: "720p.m3u8"},
+	}
+	controller := pipeline.NewAdaptiveController(variants, 0, 0.8)
+	start := time.Now()
+
+	controller.AddSample(1250000, time.Second)
+	if stream, ok := controller.Decide(start); !ok || stream.URL != "720p.m3u8" {
+		t.Fatalf("Expected switch up to 720p, got %+v (%v)", stream, ok)
+	}
+
+	// Throughput looks fine but the buffer is draining
+	controller.SetBufferLevel(10)
+	if stream, ok := controller.Decide(start.Add(time.Second)); !ok || stream.URL != "360p.m3u8" {
+		t.Errorf("Expected switch down to 360p, got %+v (%v)", stream, ok)
+	}
+}
@@ -0,0 +1,202 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+// solidImage returns an opaque image of one color
+func solidImage(width, height int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func writeTestPNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageAnimationGIF(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}}
+	full := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+	for i := range full.Pix {
+		full.Pix[i] = 1
+	}
+	corner := image.NewPaletted(image.Rect(2, 2, 4, 4), palette)
+	for i := range corner.Pix {
+		corner.Pix[i] = 2
+	}
+
+	path := filepath.Join(t.TempDir(), "logo.gif")
+	var b bytes.Buffer
+	err := gif.EncodeAll(&b, &gif.GIF{
+		Image:    []*image.Paletted{full, corner},
+		Delay:    []int{20, 0},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	anim, err := pipeline.LoadImageAnimation(config.ImageOverlay{Path: path, Loop: true})
+	if err != nil || anim == nil {
+		t.Fatalf("Expected an animation, got %v, %v", anim, err)
+	}
+	if len(anim.Frames) != 2 || anim.Delays[0] != 200*time.Millisecond || anim.Delays[1] != 100*time.Millisecond {
+		t.Fatalf("Expected 2 frames of 200ms and the default 100ms, got %d frames %v", len(anim.Frames), anim.Delays)
+	}
+	// The second frame is drawn over the first
+	if c := anim.Frames[1].NRGBAAt(0, 0); c.R != 255 {
+		t.Errorf("Expected the first frame to show through, got %v", c)
+	}
+	if c := anim.Frames[1].NRGBAAt(3, 3); c.B != 255 {
+		t.Errorf("Expected the second frame in the corner, got %v", c)
+	}
+}
+
+// apngChunk returns a PNG chunk with its checksum
+func apngChunk(kind string, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(len(data)))
+	b.WriteString(kind)
+	b.Write(data)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(kind), data...)))
+	return b.Bytes()
+}
+
+// pngChunks splits an encoded PNG into its IHDR and image data
+func pngChunks(t *testing.T, img image.Image) (header, data []byte) {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	encoded := b.Bytes()
+	for pos := 8; pos+12 <= len(encoded); {
+		length := int(binary.BigEndian.Uint32(encoded[pos:]))
+		kind := string(encoded[pos+4 : pos+8])
+		chunk := encoded[pos+8 : pos+8+length]
+		switch kind {
+		case "IHDR":
+			header = chunk
+		case "IDAT":
+			data = append(data, chunk...)
+		}
+		pos += 12 + length
+	}
+	return header, data
+}
+
+func TestImageAnimationAPNG(t *testing.T) {
+	header, first := pngChunks(t, solidImage(4, 4, color.NRGBA{R: 255, A: 255}))
+	_, second := pngChunks(t, solidImage(2, 2, color.NRGBA{G: 255, A: 255}))
+
+	frameControl := func(seq, width, height, x, y int, delayMs uint16, dispose byte) []byte {
+		var b bytes.Buffer
+		for _, v := range []uint32{uint32(seq), uint32(width), uint32(height), uint32(x), uint32(y)} {
+			binary.Write(&b, binary.BigEndian, v)
+		}
+		binary.Write(&b, binary.BigEndian, delayMs)
+		binary.Write(&b, binary.BigEndian, uint16(1000))
+		b.Write([]byte{dispose, 0})
+		return b.Bytes()
+	}
+
+	var apng bytes.Buffer
+	apng.WriteString("\x89PNG\r\n\x1a\n")
+	apng.Write(apngChunk("IHDR", header))
+	apng.Write(apngChunk("acTL", []byte{0, 0, 0, 2, 0, 0, 0, 0}))
+	apng.Write(apngChunk("fcTL", frameControl(0, 4, 4, 0, 0, 40, 0)))
+	apng.Write(apngChunk("IDAT", first))
+	apng.Write(apngChunk("fcTL", frameControl(1, 2, 2, 2, 0, 80, 0)))
+	apng.Write(apngChunk("fdAT", append([]byte{0, 0, 0, 2}, second...)))
+	apng.Write(apngChunk("IEND", nil))
+
+	path := filepath.Join(t.TempDir(), "logo.png")
+	if err := os.WriteFile(path, apng.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	anim, err := pipeline.LoadImageAnimation(config.ImageOverlay{Path: path})
+	if err != nil || anim == nil {
+		t.Fatalf("Expected an animation, got %v, %v", anim, err)
+	}
+	if len(anim.Frames) != 2 || anim.Delays[0] != 40*time.Millisecond || anim.Delays[1] != 80*time.Millisecond {
+		t.Fatalf("Expected frames of 40ms and 80ms, got %d frames %v", len(anim.Frames), anim.Delays)
+	}
+	if c := anim.Frames[1].NRGBAAt(3, 0); c.G != 255 || c.R != 0 {
+		t.Errorf("Expected the second frame at its offset, got %v", c)
+	}
+	if c := anim.Frames[1].NRGBAAt(0, 3); c.R != 255 {
+		t.Errorf("Expected the first frame around the second, got %v", c)
+	}
+
+	// A still PNG is no animation
+	still := filepath.Join(t.TempDir(), "still.png")
+	writeTestPNG(t, still, solidImage(2, 2, color.NRGBA{A: 255}))
+	if anim, err := pipeline.LoadImageAnimation(config.ImageOverlay{Path: still}); err != nil || anim != nil {
+		t.Errorf("Expected no animation for a still image, got %v, %v", anim, err)
+	}
+}
+
+func TestImageAnimationSequence(t *testing.T) {
+	dir := t.TempDir()
+	for i := 1; i <= 3; i++ {
+		writeTestPNG(t, filepath.Join(dir, fmt.Sprintf("logo_%04d.png", i)), solidImage(2, 2, color.NRGBA{A: 255}))
+	}
+
+	for _, path := range []string{filepath.Join(dir, "logo_%04d.png"), filepath.Join(dir, "logo_*.png"), dir} {
+		anim, err := pipeline.LoadImageAnimation(config.ImageOverlay{Path: path, FrameRate: 10})
+		if err != nil || anim == nil {
+			t.Errorf("%s: expected an animation, got %v, %v", path, anim, err)
+			continue
+		}
+		if len(anim.Files) != 3 || filepath.Base(anim.Files[0]) != "logo_0001.png" || anim.Duration() != 300*time.Millisecond {
+			t.Errorf("%s: expected 3 frames from logo_0001.png over 300ms, got %v over %v", path, anim.Files, anim.Duration())
+		}
+	}
+
+	if _, err := pipeline.LoadImageAnimation(config.ImageOverlay{Path: filepath.Join(dir, "other_*.png"), FrameRate: 10}); err == nil {
+		t.Error("Expected an error for a sequence without frames")
+	}
+}
+
+func TestImageAnimationFrameAt(t *testing.T) {
+	anim := &pipeline.ImageAnimation{Delays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, Loop: true}
+	tests := map[time.Duration]int{0: 0, 99 * time.Millisecond: 0, 100 * time.Millisecond: 1, 299 * time.Millisecond: 1, 300 * time.Millisecond: 0, 450 * time.Millisecond: 1}
+	for elapsed, expected := range tests {
+		if frame := anim.FrameAt(elapsed); frame != expected {
+			t.Errorf("Looped after %v: expected frame %d, got %d", elapsed, expected, frame)
+		}
+	}
+
+	anim.Loop = false
+	if frame := anim.FrameAt(time.Second); frame != 1 {
+		t.Errorf("Played once: expected the last frame to hold, got %d", frame)
+	}
+}
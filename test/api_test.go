@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"video-graphic-overlay-gstreamer/internal/api"
+	"video-graphic-overlay-gstreamer/internal/channel"
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestOverlayUpdateApply(t *testing.T) {
+	overlay := config.OverlayConfig{Enabled: true, Type: "text"}
+	text, x, visible := "Breaking news", 40, false
+
+	update := pipeline.OverlayUpdate{Text: &text, X: &x, Visible: &visible}
+	if err := update.Apply(&overlay); err != nil {
+		t.Fatalf("Failed to apply update: %v", err)
+	}
+	if overlay.Text.Content != text || overlay.Position.X != x || overlay.Enabled {
+		t.Errorf("Unexpected overlay after update: %+v", overlay)
+	}
+
+	image := "/nonexistent/logo.png"
+	err := pipeline.OverlayUpdate{Image: &image}.Apply(&overlay)
+	if !errors.Is(err, pipeline.ErrInvalidOverlayUpdate) {
+		t.Errorf("Expected an image on a text overlay to be rejected, got %v", err)
+	}
+
+	overlay.Type = "image"
+	err = pipeline.OverlayUpdate{Image: &image}.Apply(&overlay)
+	if !errors.Is(err, pipeline.ErrInvalidOverlayUpdate) || overlay.Image.Path != "" {
+		t.Errorf("Expected a missing image to be rejected, got %v", err)
+	}
+}
+
+func TestOverlayUpdateApplyLayer(t *testing.T) {
+	layers := []config.LayerConfig{
+		{Name: "clock", OverlayConfig: config.OverlayConfig{Enabled: true, Type: "text"}},
+		{Name: "logo", OverlayConfig: config.OverlayConfig{Enabled: true, Type: "image"}},
+	}
+	overlay := config.OverlayConfig{Enabled: true, Layers: layers}
+
+	text, x := "{{.time}}", 40
+	if err := (pipeline.OverlayUpdate{Text: &text, X: &x}).ApplyLayer(&overlay, "clock"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if overlay.Layers[0].Text.Content != text || overlay.Layers[0].Position.X != x {
+		t.Errorf("Unexpected layer after update: %+v", overlay.Layers[0])
+	}
+	if layers[0].Text.Content != "" {
+		t.Error("Expected the update to copy the layers")
+	}
+
+	err := pipeline.OverlayUpdate{Text: &text}.ApplyLayer(&overlay, "ticker")
+	if !errors.Is(err, pipeline.ErrUnknownLayer) {
+		t.Errorf("Expected an unknown layer error, got %v", err)
+	}
+	err = pipeline.OverlayUpdate{Text: &text}.ApplyLayer(&overlay, "")
+	if !errors.Is(err, pipeline.ErrInvalidOverlayUpdate) {
+		t.Errorf("Expected text on a layered overlay to be rejected, got %v", err)
+	}
+
+	visible := false
+	if err := (pipeline.OverlayUpdate{Visible: &visible}).ApplyLayer(&overlay, ""); err != nil || overlay.Enabled {
+		t.Errorf("Expected the overlay to be hidden, got %v", err)
+	}
+}
+
+func TestAPIUnknownChannel(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	manager := channel.NewManager(logger)
+	if err := manager.Start(context.Background(), nil); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	server := httptest.NewServer(api.NewServer("", manager, logger).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/channels")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var statuses []channel.Status
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode channel list: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(statuses) != 0 {
+		t.Errorf("Expected an empty channel list, got %d %v", resp.StatusCode, statuses)
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/api/channels/news"},
+		{http.MethodPost, "/api/channels/news/stop"},
+		{http.MethodPatch, "/api/channels/news/overlay"},
+		{http.MethodGet, "/api/channels/news/overlay/layers/logo"},
+	} {
+		request, _ := http.NewRequest(req.method, server.URL+req.path, nil)
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", req.method, req.path, resp.StatusCode)
+		}
+	}
+}
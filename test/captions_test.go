@@ -0,0 +1,64 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestAppendCCData(t *testing.T) {
+	cea608 := []byte{0xFC, 0x94, 0x2C}  // Valid field 1 pair
+	dtvcc := []byte{0xFF, 0x02, 0x21}   // Valid DTVCC packet start
+	padding := []byte{0xFA, 0x00, 0x00} // cc_valid unset
+	partial := []byte{0xFC, 0x80}       // Not a whole triplet
+
+	data := append(append(append(append([]byte{}, cea608...), padding...), dtvcc...), partial...)
+	pending := pipeline.AppendCCData(nil, data, 100)
+	if expected := append(append([]byte{}, cea608...), dtvcc...); !bytes.Equal(pending, expected) {
+		t.Errorf("Expected the valid triplets %x, got %x", expected, pending)
+	}
+
+	// The oldest triplets go beyond the limit
+	pending = pipeline.AppendCCData(pending, cea608, 7)
+	if expected := append(append([]byte{}, dtvcc...), cea608...); !bytes.Equal(pending, expected) {
+		t.Errorf("Expected the newest triplets %x, got %x", expected, pending)
+	}
+}
+
+func TestCaptionsCarried(t *testing.T) {
+	tests := map[string]bool{"h264": true, "": true, "h265": false, "vp8": false, "vp9": false}
+	for codec, expected := range tests {
+		if carried := pipeline.CaptionsCarried(codec); carried != expected {
+			t.Errorf("%q: expected carried %t, got %t", codec, expected, carried)
+		}
+	}
+}
+
+func TestConfigCaptions(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "captions.yaml")
+	if err := os.WriteFile(tmpFile, []byte("output:\n  port: 5004\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.Load(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !cfg.Output.Captions.Passthrough || cfg.Output.Captions.BurnIn {
+		t.Errorf("Expected captions passed through and not burnt in by default, got %+v", cfg.Output.Captions)
+	}
+
+	data := "output:\n  captions:\n    passthrough: false\n    burn_in: true\n"
+	if err := os.WriteFile(tmpFile, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if cfg, err = config.Load(tmpFile); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Output.Captions.Passthrough || !cfg.Output.Captions.BurnIn {
+		t.Errorf("Expected burnt-in captions only, got %+v", cfg.Output.Captions)
+	}
+}
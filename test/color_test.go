@@ -0,0 +1,91 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"video-graphic-overlay-gstreamer/internal/color"
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint32
+	}{
+		{"white", 0xFFFFFFFF},
+		{"Black", 0xFF000000},
+		{"steelblue", 0xFF4682B4},
+		{"transparent", 0x00000000},
+		{"#f80", 0xFFFF8800},
+		{"#FF8800", 0xFFFF8800},
+		{"0x00ff00", 0xFF00FF00},
+		{"336699", 0xFF336699},
+		{"#80000000", 0x80000000},
+		{"rgb(255, 0, 0)", 0xFFFF0000},
+		{"rgb(100%, 50%, 0%)", 0xFFFF8000},
+		{"rgba(0,0,0,0.7)", 0xB3000000},
+		{"rgba(0, 100, 200, 0.8)", 0xCC0064C8},
+		{"rgba(255, 255, 255, 50%)", 0x80FFFFFF},
+	}
+
+	for _, test := range tests {
+		c, err := color.Parse(test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.input, err)
+			continue
+		}
+		if c.ARGB() != test.expected {
+			t.Errorf("%q: expected 0x%08X, got 0x%08X", test.input, test.expected, c.ARGB())
+		}
+	}
+}
+
+func TestParseColorInvalid(t *testing.T) {
+	for _, input := range []string{
+		"", "notacolor", "#12345", "#ggg", "rgb(1, 2)", "rgba(1, 2, 3)",
+		"rgb(256, 0, 0)", "rgba(0, 0, 0, 1.5)", "rgb(0, 0, 0", "hsl(0, 0%, 0%)",
+	} {
+		if _, err := color.Parse(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestTextStyleMarkup(t *testing.T) {
+	style, err := pipeline.ParseTextStyle(config.TextOverlay{
+		Color:      "yellow",
+		Outline:    "transparent",
+		Background: "rgba(0,0,0,0.7)",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse style: %v", err)
+	}
+	if style.Color.ARGB() != 0xFFFFFF00 {
+		t.Errorf("Expected yellow text, got %s", style.Color)
+	}
+	if style.Outline == nil || !style.Outline.IsTransparent() {
+		t.Errorf("Expected a transparent outline, got %v", style.Outline)
+	}
+
+	markup := style.Markup("A & B\nline 2")
+	if strings.Count(markup, "<span background='#000000' bgalpha='70%'>") != 2 {
+		t.Errorf("Expected a box per line, got %q", markup)
+	}
+	if !strings.Contains(markup, "A &amp; B") {
+		t.Errorf("Expected escaped text, got %q", markup)
+	}
+
+	plain, err := pipeline.ParseTextStyle(config.TextOverlay{Color: "white"})
+	if err != nil {
+		t.Fatalf("Failed to parse style: %v", err)
+	}
+	if text := plain.Markup("A & <b>B</b>"); text != "A &amp; &lt;b&gt;B&lt;/b&gt;" {
+		t.Errorf("Expected text without a background escaped, got %q", text)
+	}
+
+	if _, err := pipeline.ParseTextStyle(config.TextOverlay{Background: "rgba(0,0,0)"}); err == nil {
+		t.Error("Expected an error for an invalid background")
+	}
+}
@@ -89,3 +89,227 @@ func TestConfigValidation(t *testing.T) {
 		t.Error("Bitrate should be positive in default config")
 	}
 }
+
+func TestConfigChannels(t *testing.T) {
+	tmpFile := "/tmp/test_channels_config.yaml"
+	defer os.Remove(tmpFile)
+
+	data := `
+output:
+  host: "239.0.0.1"
+  bitrate: 3000000
+input:
+  backup_urls: ["https://backup.example.com/playlist.m3u8"]
+channels:
+  - name: news
+    input:
+      hls_url: "https://example.com/news.m3u8"
+    output:
+      port: 5000
+  - name: sports
+    restart_policy: never
+    input:
+      hls_url: "https://example.com/sports.m3u8"
+      backup_urls: []
+    output:
+      port: 5002
+      bitrate: 6000000
+`
+	if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := config.Load(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.Channels) != 2 {
+		t.Fatalf("Expected 2 channels, got %d", len(cfg.Channels))
+	}
+
+	news, sports := cfg.Channels[0], cfg.Channels[1]
+	if news.Name != "news" || news.RestartPolicy != config.RestartOnFailure {
+		t.Errorf("Unexpected news channel %q with policy %q", news.Name, news.RestartPolicy)
+	}
+	if news.Output.Host != "239.0.0.1" || news.Output.Bitrate != 3000000 || news.Output.Port != 5000 {
+		t.Errorf("Expected news output to inherit defaults, got %+v", news.Output)
+	}
+	if news.Output.VideoCodec != "h264" {
+		t.Errorf("Expected built-in default codec, got %s", news.Output.VideoCodec)
+	}
+	if len(news.Input.BackupURLs) != 1 {
+		t.Errorf("Expected news to inherit backup URLs, got %v", news.Input.BackupURLs)
+	}
+
+	if sports.RestartPolicy != config.RestartNever {
+		t.Errorf("Expected restart policy never, got %q", sports.RestartPolicy)
+	}
+	if sports.Output.Bitrate != 6000000 || sports.Output.Port != 5002 {
+		t.Errorf("Expected sports output overrides, got %+v", sports.Output)
+	}
+	if len(sports.Input.BackupURLs) != 0 {
+		t.Errorf("Expected sports to clear backup URLs, got %v", sports.Input.BackupURLs)
+	}
+}
+
+func TestConfigChannelOptions(t *testing.T) {
+	tmpFile := "/tmp/test_channel_options_config.yaml"
+	defer os.Remove(tmpFile)
+
+	data := `
+overlay:
+  graphics:
+    options:
+      shape: "box"
+  ticker:
+    options:
+      token: "shared"
+  layers:
+    - name: crawl
+      type: "ticker"
+      ticker:
+        options:
+          token: "layer"
+channels:
+  - name: news
+    overlay:
+      graphics:
+        options:
+          label: "NEWS"
+      ticker:
+        options:
+          region: "north"
+  - name: sports
+`
+	if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.Load(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	news, sports := cfg.Channels[0], cfg.Channels[1]
+	if options := news.Overlay.Graphics.Options; len(options) != 2 || options["label"] != "NEWS" || options["shape"] != "box" {
+		t.Errorf("Expected news options on top of the defaults, got %v", options)
+	}
+	if options := news.Overlay.Ticker.Options; len(options) != 2 || options["region"] != "north" {
+		t.Errorf("Expected news ticker options on top of the defaults, got %v", options)
+	}
+
+	// Options of one channel don't leak into the others or the defaults
+	for name, options := range map[string]map[string]string{
+		"sports graphics":  sports.Overlay.Graphics.Options,
+		"default graphics": cfg.Overlay.Graphics.Options,
+		"sports ticker":    sports.Overlay.Ticker.Options,
+		"default ticker":   cfg.Overlay.Ticker.Options,
+	} {
+		if len(options) != 1 {
+			t.Errorf("%s: expected the default option only, got %v", name, options)
+		}
+	}
+
+	news.Overlay.Layers[0].Ticker.Options["token"] = "changed"
+	if token := sports.Overlay.Layers[0].Ticker.Options["token"]; token != "layer" {
+		t.Errorf("Expected channel layers not to share options, got %q", token)
+	}
+}
+
+func TestConfigChannelsInvalid(t *testing.T) {
+	tmpFile := "/tmp/test_invalid_channels_config.yaml"
+	defer os.Remove(tmpFile)
+
+	tests := map[string]string{
+		"missing name":   "channels:\n  - output:\n      port: 5000\n",
+		"duplicate name": "channels:\n  - name: a\n  - name: a\n",
+		"bad policy":     "channels:\n  - name: a\n    restart_policy: always\n",
+	}
+	for name, data := range tests {
+		if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if _, err := config.Load(tmpFile); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	tmpFile := "/tmp/test_layers_config.yaml"
+	defer os.Remove(tmpFile)
+
+	data := `
+overlay:
+  layers:
+    - name: clock
+      z_order: 2
+      text:
+        content: "{{.time}}"
+      position:
+        anchor: "top-right"
+    - name: logo
+      type: "image"
+      image:
+        path: "/path/to/logo.png"
+        alpha: 0.8
+    - name: lower-third
+      z_order: 1
+      enabled: false
+`
+	if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.Load(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	layers := cfg.Overlay.LayerList()
+	if len(layers) != 3 {
+		t.Fatalf("Expected 3 layers, got %d", len(layers))
+	}
+	order := []string{layers[0].Name, layers[1].Name, layers[2].Name}
+	if order[0] != "logo" || order[1] != "lower-third" || order[2] != "clock" {
+		t.Errorf("Expected layers in z-order, got %v", order)
+	}
+
+	clock := layers[2]
+	if !clock.Enabled || clock.Type != "text" || clock.Text.FontSize != 24 || clock.Position.Anchor != "top-right" {
+		t.Errorf("Expected the clock layer on top of the overlay defaults, got %+v", clock)
+	}
+	if layers[1].Enabled {
+		t.Error("Expected the lower-third layer to be disabled")
+	}
+
+	cfg.Overlay.Enabled = false
+	for _, layer := range cfg.Overlay.LayerList() {
+		if layer.Enabled {
+			t.Errorf("Expected layer %s hidden with the overlay", layer.Name)
+		}
+	}
+
+	single := config.OverlayConfig{Enabled: true, Type: "text"}.LayerList()
+	if len(single) != 1 || single[0].Name != config.MainLayer {
+		t.Errorf("Expected an overlay without layers to be the main layer, got %+v", single)
+	}
+}
+
+func TestConfigLayersInvalid(t *testing.T) {
+	tmpFile := "/tmp/test_invalid_layers_config.yaml"
+	defer os.Remove(tmpFile)
+
+	tests := map[string]string{
+		"missing name":   "overlay:\n  layers:\n    - type: text\n",
+		"duplicate name": "overlay:\n  layers:\n    - name: a\n    - name: a\n",
+		"nested layers":  "overlay:\n  layers:\n    - name: a\n      layers:\n        - name: b\n",
+		"channel layers": "channels:\n  - name: news\n    overlay:\n      layers:\n        - name: a\n        - name: a\n",
+	}
+	for name, data := range tests {
+		if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if _, err := config.Load(tmpFile); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		domain    string
+		code      int
+		fromInput bool
+		expected  pipeline.ErrorType
+	}{
+		{"Input read failure", pipeline.ErrorDomainResource, 9, true, pipeline.ErrorTypeNetwork},
+		{"Input not found", pipeline.ErrorDomainResource, 3, true, pipeline.ErrorTypeNetwork},
+		{"UDP write failure", pipeline.ErrorDomainResource, 10, false, pipeline.ErrorTypeOutput},
+		{"Local resource busy", pipeline.ErrorDomainResource, 4, false, pipeline.ErrorTypeResource},
+		{"Not authorized", pipeline.ErrorDomainResource, 15, true, pipeline.ErrorTypeConfiguration},
+		{"Decoder failure", pipeline.ErrorDomainStream, 7, true, pipeline.ErrorTypeDecoding},
+		{"Demux failure", pipeline.ErrorDomainStream, 9, true, pipeline.ErrorTypeDecoding},
+		{"Encoder failure", pipeline.ErrorDomainStream, 8, false, pipeline.ErrorTypeEncoding},
+		{"Missing key", pipeline.ErrorDomainStream, 13, true, pipeline.ErrorTypeInput},
+		{"Missing plugin", pipeline.ErrorDomainCore, 12, true, pipeline.ErrorTypeConfiguration},
+		{"Output negotiation", pipeline.ErrorDomainCore, 7, false, pipeline.ErrorTypeEncoding},
+		{"Library settings", pipeline.ErrorDomainLibrary, 5, false, pipeline.ErrorTypeConfiguration},
+		{"Unknown domain from input", "g-io-error-quark", 1, true, pipeline.ErrorTypeInput},
+		{"Unknown domain", "", 0, false, pipeline.ErrorTypeUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pipeline.ClassifyError(tc.domain, tc.code, tc.fromInput); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerBackoff(t *testing.T) {
+	handler := pipeline.NewErrorHandler(5, time.Second, 5*time.Second)
+	start := time.Now()
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		err := pipeline.NewPipelineError(pipeline.ErrorTypeNetwork, "souphttpsrc0", "read failed", "")
+		err.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		delay, retry := handler.HandleError(err)
+		if !retry || delay != want {
+			t.Errorf("Attempt %d: expected retry after %s, got %s (retry %v)", i+1, want, delay, retry)
+		}
+	}
+
+	err := pipeline.NewPipelineError(pipeline.ErrorTypeNetwork, "souphttpsrc0", "read failed", "")
+	err.Timestamp = start.Add(5 * time.Minute)
+	if _, retry := handler.HandleError(err); retry {
+		t.Error("Expected retries to run out after 5 consecutive attempts")
+	}
+
+	// Running long enough without errors starts the backoff over
+	err = pipeline.NewPipelineError(pipeline.ErrorTypeDecoding, "avdec_h264-0", "decoding failed", "")
+	err.Timestamp = start.Add(time.Hour)
+	if delay, retry := handler.HandleError(err); !retry || delay != time.Second {
+		t.Errorf("Expected retry after 1s once recovered, got %s (retry %v)", delay, retry)
+	}
+	if handler.Attempts() != 1 || handler.GetRetryCount(pipeline.ErrorTypeNetwork) != 0 {
+		t.Errorf("Expected counters to be reset, got %d attempts", handler.Attempts())
+	}
+}
+
+func TestErrorHandlerConfigurationNotRetried(t *testing.T) {
+	handler := pipeline.NewErrorHandler(0, time.Second, time.Minute)
+
+	var notified *pipeline.PipelineError
+	handler.SetErrorCallback(func(err *pipeline.PipelineError) { notified = err })
+
+	err := pipeline.NewPipelineError(pipeline.ErrorTypeConfiguration, "x264enc0", "invalid settings", "")
+	if _, retry := handler.HandleError(err); retry {
+		t.Error("Expected configuration errors not to be retried")
+	}
+	if notified != err || handler.GetLastError() != err {
+		t.Error("Expected the error to be recorded and reported")
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestInputSwitcherFailover(t *testing.T) {
+	inputs := []string{"http://primary/index.m3u8", "http://backup/index.m3u8"}
+	switcher := pipeline.NewInputSwitcher(inputs, true, 3*time.Second, 30*time.Second)
+	start := time.Now()
+
+	// Startup is allowed to take longer than the timeout
+	if _, ok := switcher.CheckStall(start.Add(5 * time.Second)); ok {
+		t.Error("Expected no failover during startup")
+	}
+
+	switcher.Activity(start.Add(6 * time.Second))
+	if _, ok := switcher.CheckStall(start.Add(8 * time.Second)); ok {
+		t.Error("Expected no failover while video flows")
+	}
+
+	index, ok := switcher.CheckStall(start.Add(10 * time.Second))
+	if !ok || index != 1 {
+		t.Fatalf("Expected failover to the backup, got %d (%v)", index, ok)
+	}
+
+	// Errors from the replaced input right after the switch are ignored
+	if _, ok := switcher.Failed(start.Add(10500 * time.Millisecond)); ok {
+		t.Error("Expected errors within the grace period to be ignored")
+	}
+
+	index, ok = switcher.Failed(start.Add(12 * time.Second))
+	if !ok || index != 2 || switcher.Name(index) != "slate" {
+		t.Fatalf("Expected failover to the slate, got %d (%v)", index, ok)
+	}
+	if _, ok := switcher.CheckStall(start.Add(time.Hour)); ok {
+		t.Error("Expected the slate to never stall")
+	}
+
+	// Late errors while the slate plays don't switch again
+	for _, at := range []time.Duration{20 * time.Second, time.Minute} {
+		if index, ok := switcher.Failed(start.Add(at)); ok {
+			t.Errorf("Expected no switch away from the slate, got %d", index)
+		}
+	}
+	if switcher.Active() != 2 {
+		t.Errorf("Expected the slate to stay active, got %d", switcher.Active())
+	}
+}
+
+func TestInputSwitcherFailback(t *testing.T) {
+	inputs := []string{"http://primary/index.m3u8", "http://backup/index.m3u8"}
+	switcher := pipeline.NewInputSwitcher(inputs, false, 3*time.Second, 30*time.Second)
+	start := time.Now()
+
+	if _, ok := switcher.Failed(start.Add(2 * time.Second)); !ok || switcher.Active() != 1 {
+		t.Fatalf("Expected failover to the backup, active %d", switcher.Active())
+	}
+	if standby := switcher.Standby(); len(standby) != 1 || standby[0] != 0 {
+		t.Fatalf("Expected the primary to be health checked, got %v", standby)
+	}
+
+	// A failed health check restarts the healthy period
+	switcher.ReportHealth(0, true, start.Add(10*time.Second))
+	switcher.ReportHealth(0, false, start.Add(20*time.Second))
+	switcher.ReportHealth(0, true, start.Add(25*time.Second))
+	if _, ok := switcher.Failback(start.Add(50 * time.Second)); ok {
+		t.Error("Expected no failback before the primary was healthy for 30s")
+	}
+
+	index, ok := switcher.Failback(start.Add(55 * time.Second))
+	if !ok || index != 0 || switcher.Active() != 0 {
+		t.Errorf("Expected failback to the primary, got %d (%v)", index, ok)
+	}
+
+	// Without a slate the last input wraps around to the primary
+	switcher.Failed(start.Add(60 * time.Second))
+	if index, ok := switcher.Failed(start.Add(65 * time.Second)); !ok || index != 0 {
+		t.Errorf("Expected failover to wrap to the primary, got %d (%v)", index, ok)
+	}
+}
@@ -0,0 +1,65 @@
+package test
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestBoxRenderer(t *testing.T) {
+	renderer, err := pipeline.NewRenderer(config.OverlayConfig{
+		Type:     "graphics",
+		Graphics: config.GraphicsOverlay{Renderer: "box", Height: 20, Color: "rgba(0, 0, 255, 0.5)"},
+		Position: config.PositionConfig{Anchor: "bottom-left"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create box renderer: %v", err)
+	}
+
+	frame := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	if err := renderer.Render(frame, pipeline.TemplateContext{}); err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+
+	// Straight alpha, the color is not premultiplied
+	if c := frame.NRGBAAt(0, 80); c.B != 255 || c.A != 128 {
+		t.Errorf("Expected the box at the bottom, got %v", c)
+	}
+	if c := frame.NRGBAAt(199, 99); c.B != 255 {
+		t.Errorf("Expected the box to fill the width, got %v", c)
+	}
+	if c := frame.NRGBAAt(0, 79); c.A != 0 {
+		t.Errorf("Expected transparent pixels above the box, got %v", c)
+	}
+}
+
+type solidRenderer struct{}
+
+func (solidRenderer) Render(frame *image.NRGBA, _ pipeline.TemplateContext) error {
+	for i := range frame.Pix {
+		frame.Pix[i] = 255
+	}
+	return nil
+}
+
+func TestRegisterRenderer(t *testing.T) {
+	overlay := config.OverlayConfig{Type: "graphics", Graphics: config.GraphicsOverlay{Renderer: "solid"}}
+	if _, err := pipeline.NewRenderer(overlay); err == nil || !strings.Contains(err.Error(), "box") {
+		t.Errorf("Expected an unknown renderer error listing the renderers, got %v", err)
+	}
+
+	pipeline.RegisterRenderer("solid", func(config.OverlayConfig) (pipeline.Renderer, error) {
+		return solidRenderer{}, nil
+	})
+	if _, err := pipeline.NewRenderer(overlay); err != nil {
+		t.Errorf("Expected the registered renderer, got %v", err)
+	}
+
+	overlay.Graphics = config.GraphicsOverlay{Renderer: "box", Color: "nope"}
+	if _, err := pipeline.NewRenderer(overlay); err == nil {
+		t.Error("Expected an invalid box color to be rejected")
+	}
+}
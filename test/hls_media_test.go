@@ -0,0 +1,227 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+const mediaPlaylist = `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-KEY:METHOD=AES-128,URI="keys/1.key",IV=0x000102030405060708090a0b0c0d0e0f
+#EXT-X-PROGRAM-DATE-TIME:2024-05-01T12:00:00.000Z
+#EXTINF:6.000,first
+seg100.ts
+#EXT-X-BYTERANGE:1000@0
+#EXTINF:5.500,
+all.ts
+#EXT-X-BYTERANGE:2000
+#EXTINF:6.000,
+all.ts
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-DISCONTINUITY
+#EXTINF:4.000,
+https://other.example.com/seg103.ts
+#EXT-X-ENDLIST
+`
+
+func TestParseMediaPlaylist(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMediaPlaylistFrom(strings.NewReader(mediaPlaylist),
+		"http://example.com/live/720p/index.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse media playlist: %v", err)
+	}
+
+	if playlist.TargetDuration != 6 || playlist.MediaSequence != 100 || !playlist.EndList {
+		t.Errorf("Unexpected playlist header %+v", playlist)
+	}
+	if len(playlist.Segments) != 4 {
+		t.Fatalf("Expected 4 segments, got %d", len(playlist.Segments))
+	}
+	if playlist.LastSequenceNumber() != 103 {
+		t.Errorf("Expected last sequence 103, got %d", playlist.LastSequenceNumber())
+	}
+	if playlist.Duration() != 21500*time.Millisecond {
+		t.Errorf("Expected duration 21.5s, got %s", playlist.Duration())
+	}
+
+	first := playlist.Segments[0]
+	if first.URL != "http://example.com/live/720p/seg100.ts" || first.Title != "first" {
+		t.Errorf("Unexpected first segment %+v", first)
+	}
+	if first.Key == nil || first.Key.URI != "http://example.com/live/720p/keys/1.key" || len(first.Key.IV) != 16 {
+		t.Errorf("Unexpected key %+v", first.Key)
+	}
+
+	second, third := playlist.Segments[1], playlist.Segments[2]
+	if !second.ProgramDateTime.Equal(time.Date(2024, 5, 1, 12, 0, 6, 0, time.UTC)) {
+		t.Errorf("Expected program date time to be extrapolated, got %s", second.ProgramDateTime)
+	}
+	if third.ByteRange == nil || third.ByteRange.Offset != 1000 || third.ByteRange.Length != 2000 {
+		t.Errorf("Expected byte range to continue previous range, got %+v", third.ByteRange)
+	}
+
+	last := playlist.Segments[3]
+	if !last.Discontinuity || last.DiscontinuitySequence != 1 || last.Key != nil {
+		t.Errorf("Unexpected last segment %+v", last)
+	}
+	if !last.ProgramDateTime.IsZero() {
+		t.Errorf("Expected program date time to reset after discontinuity, got %s", last.ProgramDateTime)
+	}
+}
+
+func TestParseMediaPlaylistErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		errLine string
+	}{
+		{
+			name:    "Master playlist",
+			content: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\n",
+			errLine: "line 2:",
+		},
+		{
+			name:    "Segment without EXTINF",
+			content: "#EXTM3U\n#EXT-X-TARGETDURATION:6\nseg.ts\n",
+			errLine: "line 3:",
+		},
+		{
+			name:    "Invalid byte range",
+			content: "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6,\n#EXT-X-BYTERANGE:abc\nseg.ts\n",
+			errLine: "line 4:",
+		},
+		{
+			name:    "Unknown key method",
+			content: "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-KEY:METHOD=ROT13,URI=\"k\"\n",
+			errLine: "line 3:",
+		},
+		{
+			name:    "Missing target duration",
+			content: "#EXTM3U\n#EXTINF:6,\nseg.ts\n",
+			errLine: "missing required",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pipeline.ParseHLSMediaPlaylistFrom(strings.NewReader(tc.content), "http://example.com/index.m3u8")
+			if err == nil {
+				t.Fatal("Expected parse error, got nil")
+			}
+			if !strings.HasPrefix(err.Error(), tc.errLine) {
+				t.Errorf("Expected error to start with %q, got %q", tc.errLine, err.Error())
+			}
+		})
+	}
+
+	_, err := pipeline.ParseHLSMediaPlaylistFrom(strings.NewReader(testCases[0].content), "http://example.com/index.m3u8")
+	if !errors.Is(err, pipeline.ErrMasterPlaylist) {
+		t.Errorf("Expected ErrMasterPlaylist for a master playlist, got %v", err)
+	}
+}
+
+// livePlaylist renders a live media playlist window
+func livePlaylist(first int, durations ...float64) *pipeline.HLSMediaPlaylist {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	for i, duration := range durations {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\nseg%d.ts\n", duration, first+i)
+	}
+	playlist, err := pipeline.ParseHLSMediaPlaylistFrom(strings.NewReader(b.String()), "http://example.com/index.m3u8")
+	if err != nil {
+		panic(err)
+	}
+	return playlist
+}
+
+func TestPlaylistInspector(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	inspector := pipeline.NewPlaylistInspector("http://example.com/index.m3u8", logger)
+	start := time.Now()
+
+	if issues := inspector.Inspect(livePlaylist(10, 6, 6, 6), start); len(issues) != 0 {
+		t.Errorf("Expected no issues for first load, got %v", issues)
+	}
+
+	// Window advanced normally, one segment too long
+	issues := inspector.Inspect(livePlaylist(11, 6, 6, 7.2), start.Add(6*time.Second))
+	if len(issues) != 1 || issues[0].Type != pipeline.PlaylistIssueTargetDuration || issues[0].Sequence != 13 {
+		t.Errorf("Expected target duration violation for segment 13, got %v", issues)
+	}
+
+	// Unchanged within 1.5 target durations is fine, beyond it is stale (reported once)
+	if issues := inspector.Inspect(livePlaylist(11, 6, 6, 7.2), start.Add(12*time.Second)); len(issues) != 0 {
+		t.Errorf("Expected no issues, got %v", issues)
+	}
+	issues = inspector.Inspect(livePlaylist(11, 6, 6, 7.2), start.Add(16*time.Second))
+	if len(issues) != 1 || issues[0].Type != pipeline.PlaylistIssueStale {
+		t.Errorf("Expected stale playlist, got %v", issues)
+	}
+	if issues := inspector.Inspect(livePlaylist(11, 6, 6, 7.2), start.Add(19*time.Second)); len(issues) != 0 {
+		t.Errorf("Expected stale playlist to be reported once, got %v", issues)
+	}
+
+	// Segments 14 and 15 expired before being seen
+	issues = inspector.Inspect(livePlaylist(16, 6, 6, 6), start.Add(25*time.Second))
+	if len(issues) != 1 || issues[0].Type != pipeline.PlaylistIssueSequenceGap || issues[0].Sequence != 14 {
+		t.Errorf("Expected sequence gap at 14, got %v", issues)
+	}
+
+	issues = inspector.Inspect(livePlaylist(0, 6), start.Add(31*time.Second))
+	if len(issues) != 1 || issues[0].Type != pipeline.PlaylistIssueSequenceReset {
+		t.Errorf("Expected sequence reset, got %v", issues)
+	}
+
+	window := inspector.Window()
+	if window.FirstSequence != 0 || window.LastSequence != 0 || window.SegmentCount != 1 {
+		t.Errorf("Unexpected live window %+v", window)
+	}
+}
+
+func TestPlaylistInspectorPolling(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1,\nseg0.ts\n#EXT-X-ENDLIST\n")
+	}))
+	defer server.Close()
+
+	inspector := pipeline.NewPlaylistInspector(server.URL+"/index.m3u8", logger)
+	issues := make(chan pipeline.PlaylistIssue, 1)
+	inspector.SetIssueCallback(func(issue pipeline.PlaylistIssue) { issues <- issue })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	inspector.Start(ctx)
+
+	deadline := time.After(time.Second)
+	for inspector.Window().LastFetch.IsZero() {
+		select {
+		case issue := <-issues:
+			t.Fatalf("Unexpected issue %v", issue)
+		case <-deadline:
+			t.Fatal("Inspector did not poll the playlist")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if window := inspector.Window(); !window.EndList || window.SegmentCount != 1 {
+		t.Errorf("Unexpected live window %+v", window)
+	}
+}
@@ -0,0 +1,324 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+const masterPlaylist = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AVERAGE-BANDWIDTH=1000000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720,FRAME-RATE=29.970
+720p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=640000,CODECS="avc1.42e01e,mp4a.40.2",RESOLUTION=640x360
+/live/360p/index.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=4000000,CODECS="avc1.640028,mp4a.40.2",RESOLUTION=1920x1080
+https://cdn.example.com/1080p/index.m3u8
+`
+
+func TestParseMasterPlaylistAttributes(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(masterPlaylist),
+		"https://origin.example.com/live/channel/master.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse master playlist: %v", err)
+	}
+
+	if len(playlist.Streams) != 3 {
+		t.Fatalf("Expected 3 streams, got %d", len(playlist.Streams))
+	}
+
+	stream := playlist.Streams[0]
+	if stream.Codecs != "avc1.4d401f,mp4a.40.2" {
+		t.Errorf("Expected quoted codecs to be preserved, got %q", stream.Codecs)
+	}
+	if stream.Bandwidth != 1280000 || stream.AverageBandwidth != 1000000 {
+		t.Errorf("Unexpected bandwidth %d / %d", stream.Bandwidth, stream.AverageBandwidth)
+	}
+	if stream.Width != 1280 || stream.Height != 720 {
+		t.Errorf("Expected 1280x720, got %dx%d", stream.Width, stream.Height)
+	}
+	if stream.FrameRate != 29.97 {
+		t.Errorf("Expected frame rate 29.97, got %f", stream.FrameRate)
+	}
+
+	if playlist.BaseURL != "https://origin.example.com/live/channel/" {
+		t.Errorf("Unexpected base URL %s", playlist.BaseURL)
+	}
+}
+
+func TestParseMasterPlaylistResolvesURIs(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(masterPlaylist),
+		"https://origin.example.com/live/channel/master.m3u8?token=abc")
+	if err != nil {
+		t.Fatalf("Failed to parse master playlist: %v", err)
+	}
+
+	expected := []string{
+		"https://origin.example.com/live/channel/720p/index.m3u8",
+		"https://origin.example.com/live/360p/index.m3u8",
+		"https://cdn.example.com/1080p/index.m3u8",
+	}
+
+	for i, url := range expected {
+		if playlist.Streams[i].URL != url {
+			t.Errorf("Stream %d: expected URL %s, got %s", i, url, playlist.Streams[i].URL)
+		}
+	}
+}
+
+func TestParseMasterPlaylistErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		errLine string
+	}{
+		{
+			name:    "Missing header",
+			content: "#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\n",
+			errLine: "line 1:",
+		},
+		{
+			name:    "Unterminated quoted string",
+			content: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,CODECS=\"avc1\nlow.m3u8\n",
+			errLine: "line 2:",
+		},
+		{
+			name:    "Missing bandwidth",
+			content: "#EXTM3U\n\n#EXT-X-STREAM-INF:RESOLUTION=640x360\nlow.m3u8\n",
+			errLine: "line 3:",
+		},
+		{
+			name:    "Invalid resolution",
+			content: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,RESOLUTION=640by360\nlow.m3u8\n",
+			errLine: "line 2:",
+		},
+		{
+			name:    "Missing variant URI",
+			content: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n#EXT-X-STREAM-INF:BANDWIDTH=2\nhigh.m3u8\n",
+			errLine: "line 3:",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(tc.content), "http://example.com/master.m3u8")
+			if err == nil {
+				t.Fatal("Expected parse error, got nil")
+			}
+			if !strings.HasPrefix(err.Error(), tc.errLine) {
+				t.Errorf("Expected error to start with %q, got %q", tc.errLine, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseAttributeList(t *testing.T) {
+	attrs, err := pipeline.ParseAttributeList(`METHOD=AES-128,URI="key,1.bin",IV=0x1F2e,RESOLUTION=320x240`)
+	if err != nil {
+		t.Fatalf("Failed to parse attribute list: %v", err)
+	}
+
+	if method, _ := attrs.Enum("METHOD"); method != "AES-128" {
+		t.Errorf("Expected METHOD AES-128, got %s", method)
+	}
+	if uri, _ := attrs.QuotedString("URI"); uri != "key,1.bin" {
+		t.Errorf("Expected URI key,1.bin, got %s", uri)
+	}
+	if iv, err := attrs.Hex("IV"); err != nil || len(iv) != 2 || iv[0] != 0x1f || iv[1] != 0x2e {
+		t.Errorf("Unexpected IV %x (%v)", iv, err)
+	}
+	if _, err := attrs.QuotedString("METHOD"); err == nil {
+		t.Error("Expected error reading enumerated value as quoted string")
+	}
+
+	for _, invalid := range []string{`A=1,`, `A=1,A=2`, `a=1`, `A`, `A="x"B=1`} {
+		if _, err := pipeline.ParseAttributeList(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+const renditionPlaylist = `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Deutsch",LANGUAGE="de",DEFAULT=NO,AUTOSELECT=YES,URI="audio/de.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Español",LANGUAGE="es",URI="subs/es.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="CC1",LANGUAGE="en",INSTREAM-ID="CC1"
+#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720,AUDIO="aac",SUBTITLES="subs",CLOSED-CAPTIONS="cc"
+video/720p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,AUDIO="aac",CLOSED-CAPTIONS=NONE
+video/360p.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,RESOLUTION=640x360,URI="video/360p-iframes.m3u8"
+`
+
+func TestParseMasterPlaylistRenditions(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(renditionPlaylist),
+		"http://example.com/live/master.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse master playlist: %v", err)
+	}
+
+	if len(playlist.Renditions) != 4 {
+		t.Fatalf("Expected 4 renditions, got %d", len(playlist.Renditions))
+	}
+	if len(playlist.IFrameStreams) != 1 || playlist.IFrameStreams[0].URL != "http://example.com/live/video/360p-iframes.m3u8" {
+		t.Errorf("Unexpected I-frame streams %+v", playlist.IFrameStreams)
+	}
+
+	stream := playlist.Streams[0]
+	if stream.Audio != "aac" || stream.Subtitles != "subs" || stream.ClosedCaptions != "cc" {
+		t.Errorf("Unexpected group references %+v", stream)
+	}
+	if playlist.Streams[1].ClosedCaptions != "" {
+		t.Errorf("Expected CLOSED-CAPTIONS=NONE to leave group empty, got %q", playlist.Streams[1].ClosedCaptions)
+	}
+
+	audio := playlist.RenditionGroup(pipeline.RenditionTypeAudio, "aac")
+	if len(audio) != 2 || audio[1].URI != "http://example.com/live/audio/de.m3u8" {
+		t.Errorf("Unexpected audio group %+v", audio)
+	}
+
+	testCases := []struct {
+		name     string
+		language string
+		rendName string
+		expected string
+	}{
+		{name: "By language", language: "de", expected: "Deutsch"},
+		{name: "By three letter language", language: "deu", expected: "Deutsch"},
+		{name: "By name", rendName: "english", language: "de", expected: "English"},
+		{name: "Default", language: "fr", expected: "English"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rendition := playlist.SelectRendition(pipeline.RenditionTypeAudio, "aac", tc.language, tc.rendName)
+			if rendition == nil || rendition.Name != tc.expected {
+				t.Errorf("Expected rendition %s, got %+v", tc.expected, rendition)
+			}
+		})
+	}
+
+	if !playlist.HasDemuxedRenditions(&stream, pipeline.RenditionTypeAudio) {
+		t.Error("Expected audio renditions to be demuxed")
+	}
+}
+
+func TestFilteredMasterPlaylist(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(renditionPlaylist),
+		"http://example.com/live/master.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse master playlist: %v", err)
+	}
+
+	filtered, err := playlist.Filtered(pipeline.StreamFilter{MaxWidth: 640})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(playlist.Streams) != 2 {
+		t.Errorf("Expected the original playlist unchanged, got %d streams", len(playlist.Streams))
+	}
+
+	// The encoded playlist plays from another location
+	encoded, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(filtered.Encode()),
+		"file:///tmp/overlay-master.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse encoded playlist: %v\n%s", err, filtered.Encode())
+	}
+	if len(encoded.Streams) != 1 || encoded.Streams[0].URL != "http://example.com/live/video/360p.m3u8" {
+		t.Errorf("Expected only the 360p variant, got %+v", encoded.Streams)
+	}
+	if stream := encoded.Streams[0]; stream.Width != 640 || stream.Audio != "aac" || stream.Bandwidth != 800000 {
+		t.Errorf("Expected the variant attributes kept, got %+v", stream)
+	}
+	if len(encoded.IFrameStreams) != 1 || encoded.IFrameStreams[0].URL != "http://example.com/live/video/360p-iframes.m3u8" {
+		t.Errorf("Unexpected I-frame streams %+v", encoded.IFrameStreams)
+	}
+	if len(encoded.Renditions) != 4 {
+		t.Fatalf("Expected 4 renditions, got %d", len(encoded.Renditions))
+	}
+	for i, rendition := range encoded.Renditions {
+		if rendition != playlist.Renditions[i] {
+			t.Errorf("Rendition %d: expected %+v, got %+v", i, playlist.Renditions[i], rendition)
+		}
+	}
+
+	if _, err := playlist.Filtered(pipeline.StreamFilter{MaxWidth: 320}); !errors.Is(err, pipeline.ErrNoMatchingStream) {
+		t.Errorf("Expected ErrNoMatchingStream, got %v", err)
+	}
+}
+
+const filterPlaylist = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=8000000,RESOLUTION=3840x2160,FRAME-RATE=60.000,CODECS="hvc1.2.4.L153.B0,mp4a.40.2"
+2160p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,FRAME-RATE=50.000,CODECS="avc1.640028,mp4a.40.2"
+1080p50.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=4500000,RESOLUTION=1920x1080,FRAME-RATE=25.000,CODECS="hvc1.2.4.L120.B0,mp4a.40.2"
+1080p-hevc.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,FRAME-RATE=25.000,CODECS="avc1.64001f,ec-3"
+720p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,FRAME-RATE=25.000,CODECS="avc1.4d401e,mp4a.40.2"
+360p.m3u8
+`
+
+func TestSelectBestStreamFiltered(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(filterPlaylist), "http://example.com/master.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse master playlist: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		criteria string
+		filter   pipeline.StreamFilter
+		expected string
+	}{
+		{"No filter", "highest", pipeline.StreamFilter{}, "2160p.m3u8"},
+		{"Video codec only", "highest", pipeline.StreamFilter{Codecs: []string{"avc1"}}, "1080p50.m3u8"},
+		{"Codec alias", "bandwidth", pipeline.StreamFilter{Codecs: []string{"h264"}}, "1080p50.m3u8"},
+		{"Audio codec restricted", "highest", pipeline.StreamFilter{Codecs: []string{"avc1", "mp4a"}}, "1080p50.m3u8"},
+		{"Frame rate", "highest", pipeline.StreamFilter{Codecs: []string{"avc1"}, MaxFrameRate: 30}, "720p.m3u8"},
+		{"Max bitrate", "highest", pipeline.StreamFilter{MaxBitrate: 1000000}, "360p.m3u8"},
+		{"Min bitrate", "lowest", pipeline.StreamFilter{MinBitrate: 4000000}, "1080p-hevc.m3u8"},
+		{"Max resolution", "highest", pipeline.StreamFilter{MaxWidth: 1280, MaxHeight: 720}, "720p.m3u8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stream, err := playlist.SelectBestStreamFiltered(tc.criteria, tc.filter)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.HasSuffix(stream.URL, "/"+tc.expected) {
+				t.Errorf("Expected %s, got %s", tc.expected, stream.URL)
+			}
+		})
+	}
+}
+
+func TestSelectBestStreamFilteredNoMatch(t *testing.T) {
+	playlist, err := pipeline.ParseHLSMasterPlaylistFrom(strings.NewReader(filterPlaylist), "http://example.com/master.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse master playlist: %v", err)
+	}
+
+	_, err = playlist.SelectBestStreamFiltered("highest", pipeline.StreamFilter{
+		Codecs:     []string{"avc1", "mp4a"},
+		MinBitrate: 1000000,
+		MaxBitrate: 3000000,
+	})
+	if !errors.Is(err, pipeline.ErrNoMatchingStream) {
+		t.Fatalf("Expected ErrNoMatchingStream, got %v", err)
+	}
+
+	var noMatch *pipeline.NoMatchingStreamError
+	if !errors.As(err, &noMatch) || len(noMatch.Rejected) != 5 {
+		t.Fatalf("Expected every variant to be listed as rejected, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `360p.m3u8: bandwidth 800000 below minimum 1000000`) ||
+		!strings.Contains(err.Error(), `720p.m3u8: codec "ec-3" not allowed`) {
+		t.Errorf("Expected rejection reasons in error, got %q", err.Error())
+	}
+}
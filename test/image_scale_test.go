@@ -0,0 +1,78 @@
+package test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestImageSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		image         config.ImageOverlay
+		video         [2]int
+		width, height int
+	}{
+		{"native", config.ImageOverlay{}, [2]int{1920, 1080}, 200, 100},
+		{"scale", config.ImageOverlay{Scale: 0.5}, [2]int{1920, 1080}, 100, 50},
+		{"width", config.ImageOverlay{Width: 300}, [2]int{1920, 1080}, 300, 150},
+		{"height", config.ImageOverlay{Height: 40}, [2]int{1920, 1080}, 80, 40},
+		{"fit in box", config.ImageOverlay{Width: 300, Height: 60}, [2]int{1920, 1080}, 120, 60},
+		{"percent 1080p", config.ImageOverlay{WidthPercent: 10}, [2]int{1920, 1080}, 192, 96},
+		{"percent 360p", config.ImageOverlay{WidthPercent: 10}, [2]int{640, 360}, 64, 32},
+		{"percent before caps", config.ImageOverlay{WidthPercent: 10}, [2]int{0, 0}, 200, 100},
+		{"percent first", config.ImageOverlay{WidthPercent: 10, Width: 300, Scale: 2}, [2]int{640, 360}, 64, 32},
+	}
+
+	for _, test := range tests {
+		width, height := pipeline.ImageSize(test.image, 200, 100, test.video[0], test.video[1])
+		if width != test.width || height != test.height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", test.name, test.width, test.height, width, height)
+		}
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	// A red square on transparent pixels
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 4; y < 12; y++ {
+		for x := 4; x < 12; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+
+	for _, size := range []int{6, 40} {
+		scaled := pipeline.ScaleImage(src, size, size)
+		if scaled.Bounds().Dx() != size || scaled.Bounds().Dy() != size {
+			t.Fatalf("Expected %dx%d, got %v", size, size, scaled.Bounds())
+		}
+		if c := scaled.NRGBAAt(size/2, size/2); c != (color.NRGBA{R: 255, A: 255}) {
+			t.Errorf("%d: expected opaque red in the middle, got %v", size, c)
+		}
+		if c := scaled.NRGBAAt(0, 0); c.A != 0 {
+			t.Errorf("%d: expected transparent corners, got %v", size, c)
+		}
+		// Edge pixels blend alpha, not color
+		for x := 0; x < size; x++ {
+			if c := scaled.NRGBAAt(x, size/2); c.A > 0 && (c.R < 250 || c.G > 0 || c.B > 0) {
+				t.Errorf("%d: expected red edges without dark fringes, got %v at x=%d", size, c, x)
+			}
+		}
+	}
+
+	// Shrinking a fine checkerboard averages it instead of picking pixels
+	checker := image.NewGray(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if (x+y)%2 == 0 {
+				checker.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	if c := pipeline.ScaleImage(checker, 4, 4).NRGBAAt(1, 1); c.R < 120 || c.R > 135 {
+		t.Errorf("Expected mid gray, got %v", c)
+	}
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"video-graphic-overlay-gstreamer/internal/channel"
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/metrics"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+// scrapeMetrics returns the metrics endpoint output for the channels of manager
+func scrapeMetrics(t *testing.T, manager *channel.Manager, logger logrus.FieldLogger) string {
+	t.Helper()
+	server := httptest.NewServer(metrics.NewServer("", manager, logger).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read scrape: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	return string(body)
+}
+
+func TestMetricsScrape(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	manager := channel.NewManager(logger)
+	if err := manager.Start(context.Background(), nil); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+
+	body := scrapeMetrics(t, manager, logger)
+	for _, metric := range []string{"video_overlay_channels 0", "go_goroutines"} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("Expected %q in scrape:\n%s", metric, body)
+		}
+	}
+}
+
+func TestMetricsScrapeChannel(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	// The input is never reachable, the channel stays down
+	tmpFile := filepath.Join(t.TempDir(), "channels.yaml")
+	data := `
+channels:
+  - name: news
+    restart_policy: never
+    input:
+      hls_url: "http://127.0.0.1:1/news.m3u8"
+    output:
+      port: 5000
+    pipeline:
+      auto_restart: false
+`
+	if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.Load(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	manager := channel.NewManager(logger)
+	if err := manager.Start(context.Background(), cfg.Channels); err != nil {
+		t.Fatalf("Failed to start manager: %v", err)
+	}
+	defer manager.Stop()
+
+	body := scrapeMetrics(t, manager, logger)
+	for _, metric := range []string{
+		"video_overlay_channels 1",
+		`video_overlay_channel_up{channel="news"}`,
+		`video_overlay_channel_restarts_total{channel="news"} 0`,
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("Expected %q in scrape:\n%s", metric, body)
+		}
+	}
+}
+
+// snapshotStats returns the counters as a pipeline reports them
+func snapshotStats(counters *pipeline.StatsCounters, now time.Time) pipeline.Stats {
+	var stats pipeline.Stats
+	counters.Snapshot(&stats, now)
+	return stats
+}
+
+func TestStatsCountersDropped(t *testing.T) {
+	var counters pipeline.StatsCounters
+
+	// QoS messages report the total since the element started
+	counters.AddDropped("queue", 5)
+	counters.AddDropped("queue", 8)
+	counters.AddDropped("encoder", 2)
+	stats := snapshotStats(&counters, time.Now())
+	if stats.FramesDropped != 10 {
+		t.Errorf("Expected 10 dropped frames, got %d", stats.FramesDropped)
+	}
+
+	// A lower total comes from an element recreated by a restart
+	counters.AddDropped("queue", 3)
+	stats = snapshotStats(&counters, time.Now())
+	if stats.FramesDropped != 13 {
+		t.Errorf("Expected 13 dropped frames after the element reset, got %d", stats.FramesDropped)
+	}
+
+	// A new build counts from the totals of its own elements
+	counters.ResetBuild()
+	counters.AddDropped("queue", 4)
+	stats = snapshotStats(&counters, time.Now())
+	if stats.FramesDropped != 17 {
+		t.Errorf("Expected 17 dropped frames after a rebuild, got %d", stats.FramesDropped)
+	}
+}
+
+func TestStatsCountersBitrate(t *testing.T) {
+	var counters pipeline.StatsCounters
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	counters.AddEncoded(1000, start)
+	counters.AddEncoded(1000, start.Add(2*time.Second))
+	stats := snapshotStats(&counters, start.Add(2*time.Second))
+	if stats.EncoderBytes != 2000 || stats.EncoderBitrate != 0 {
+		t.Errorf("Expected 2000 bytes and no bitrate before the window is complete, got %d, %v",
+			stats.EncoderBytes, stats.EncoderBitrate)
+	}
+
+	counters.AddEncoded(500, start.Add(5*time.Second))
+	stats = snapshotStats(&counters, start.Add(6*time.Second))
+	if stats.EncoderBitrate != 4000 {
+		t.Errorf("Expected 4000 bps over the first window, got %v", stats.EncoderBitrate)
+	}
+
+	// The last bitrate is kept while the next window fills
+	counters.AddEncoded(100, start.Add(8*time.Second))
+	stats = snapshotStats(&counters, start.Add(9*time.Second))
+	if stats.EncoderBitrate != 4000 {
+		t.Errorf("Expected the bitrate of the last window, got %v", stats.EncoderBitrate)
+	}
+
+	// An encoder that stopped producing has no bitrate
+	stats = snapshotStats(&counters, start.Add(16*time.Second))
+	if stats.EncoderBitrate != 0 {
+		t.Errorf("Expected no bitrate for a stalled encoder, got %v", stats.EncoderBitrate)
+	}
+
+	counters.AddEncoded(100, start.Add(20*time.Second))
+	counters.ResetBuild()
+	stats = snapshotStats(&counters, start.Add(20*time.Second))
+	if stats.EncoderBitrate != 0 || stats.EncoderBytes != 2700 {
+		t.Errorf("Expected the bitrate reset and the bytes kept after a rebuild, got %v, %d",
+			stats.EncoderBitrate, stats.EncoderBytes)
+	}
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"testing"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestResolvePosition(t *testing.T) {
+	// A 200x100 bug on 1920x1080 video
+	tests := []struct {
+		position config.PositionConfig
+		x, y     int
+	}{
+		{config.PositionConfig{X: 10, Y: 20}, 10, 20},
+		{config.PositionConfig{X: 10, Y: 20, Anchor: "top-left"}, 10, 20},
+		{config.PositionConfig{X: 10, Y: 20, Anchor: "bottom-right"}, 1710, 960},
+		{config.PositionConfig{X: 10, Y: 20, Anchor: "top-right"}, 1710, 20},
+		{config.PositionConfig{X: 10, Y: 20, Anchor: "bottom-left"}, 10, 960},
+		{config.PositionConfig{Anchor: "center"}, 860, 490},
+		{config.PositionConfig{X: 10, Y: -10, Anchor: "center"}, 870, 480},
+		{config.PositionConfig{Y: 5, Anchor: "bottom-center"}, 860, 975},
+		{config.PositionConfig{X: 5, Y: 10, Anchor: "bottom-right", Units: "percent"}, 1624, 872},
+		{config.PositionConfig{Anchor: "bottom-right", SafeArea: "title"}, 1624, 926},
+		{config.PositionConfig{Anchor: "top-left", SafeArea: "action"}, 67, 37},
+		{config.PositionConfig{Anchor: "center", SafeArea: "title"}, 860, 490},
+	}
+
+	for _, test := range tests {
+		x, y := pipeline.ResolvePosition(test.position, 1920, 1080, 200, 100)
+		if x != test.x || y != test.y {
+			t.Errorf("%+v: expected %d,%d, got %d,%d", test.position, test.x, test.y, x, y)
+		}
+	}
+}
+
+func TestValidatePosition(t *testing.T) {
+	valid := []config.PositionConfig{
+		{},
+		{Anchor: "bottom-right", Units: "percent", SafeArea: "title"},
+		{Anchor: "center-left", Units: "pixels", SafeArea: "action"},
+	}
+	for _, position := range valid {
+		if err := pipeline.ValidatePosition(position); err != nil {
+			t.Errorf("%+v: unexpected error %v", position, err)
+		}
+	}
+
+	invalid := []config.PositionConfig{
+		{Anchor: "bottom-middle"},
+		{Units: "em"},
+		{SafeArea: "graphics"},
+	}
+	for _, position := range invalid {
+		if err := pipeline.ValidatePosition(position); err == nil {
+			t.Errorf("%+v: expected an error", position)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestScheduleActive(t *testing.T) {
+	started := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC) // A Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 6, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		windows  []config.ScheduleWindow
+		now      time.Time
+		expected bool
+	}{
+		{"no windows", nil, at(3, 12, 0), true},
+		{"once inside", []config.ScheduleWindow{{From: "2024-06-03T10:00:00Z", Until: "2024-06-03T12:00:00Z"}}, at(3, 11, 0), true},
+		{"once after", []config.ScheduleWindow{{From: "2024-06-03T10:00:00Z", Until: "2024-06-03T12:00:00Z"}}, at(3, 12, 0), false},
+		{"once open end", []config.ScheduleWindow{{From: "2024-06-03 10:00"}}, at(9, 0, 0), true},
+		{"daily inside", []config.ScheduleWindow{{From: "09:00", Until: "17:30"}}, at(5, 17, 29), true},
+		{"daily outside", []config.ScheduleWindow{{From: "09:00", Until: "17:30"}}, at(5, 17, 30), false},
+		{"daily past midnight", []config.ScheduleWindow{{From: "22:00", Until: "02:00"}}, at(4, 1, 0), true},
+		{"weekday", []config.ScheduleWindow{{From: "09:00", Until: "17:00", Days: []string{"mon", "Friday"}}}, at(7, 10, 0), true},
+		{"other weekday", []config.ScheduleWindow{{From: "09:00", Until: "17:00", Days: []string{"mon", "fri"}}}, at(4, 10, 0), false},
+		{"relative", []config.ScheduleWindow{{From: "10m", Until: "1h"}}, at(3, 8, 30), true},
+		{"relative before", []config.ScheduleWindow{{Until: "10m"}}, at(3, 8, 10), false},
+		{"any window", []config.ScheduleWindow{{Until: "10m"}, {From: "08:05", Until: "08:15"}}, at(3, 8, 10), true},
+	}
+
+	for _, test := range tests {
+		schedule, err := pipeline.NewSchedule(config.ScheduleConfig{Timezone: "UTC", Windows: test.windows})
+		if err != nil {
+			t.Fatalf("%s: failed to parse schedule: %v", test.name, err)
+		}
+		if active := schedule.Active(test.now, started); active != test.expected {
+			t.Errorf("%s: expected active=%t, got %t", test.name, test.expected, active)
+		}
+	}
+}
+
+func TestScheduleDaylightSaving(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+	schedule, err := pipeline.NewSchedule(config.ScheduleConfig{
+		Timezone: "Europe/Berlin",
+		Windows:  []config.ScheduleWindow{{From: "09:00", Until: "17:00"}, {From: "23:00", Until: "03:30"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse schedule: %v", err)
+	}
+
+	// Clocks go forward an hour on 2026-03-29 and back an hour on 2026-10-25
+	tests := map[time.Time]bool{
+		time.Date(2026, 3, 29, 9, 30, 0, 0, location):   true,
+		time.Date(2026, 3, 29, 17, 30, 0, 0, location):  false,
+		time.Date(2026, 3, 29, 3, 15, 0, 0, location):   true,
+		time.Date(2026, 10, 25, 8, 30, 0, 0, location):  false,
+		time.Date(2026, 10, 25, 16, 30, 0, 0, location): true,
+		time.Date(2026, 10, 25, 3, 45, 0, 0, location):  false,
+	}
+	started := time.Date(2026, 3, 1, 0, 0, 0, 0, location)
+	for now, expected := range tests {
+		if active := schedule.Active(now, started); active != expected {
+			t.Errorf("%s: expected active=%t, got %t", now, expected, active)
+		}
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	tests := map[string]config.ScheduleConfig{
+		"empty window":  {Windows: []config.ScheduleWindow{{}}},
+		"bad time":      {Windows: []config.ScheduleWindow{{From: "noon"}}},
+		"mixed forms":   {Windows: []config.ScheduleWindow{{From: "09:00", Until: "1h"}}},
+		"daily no from": {Windows: []config.ScheduleWindow{{Until: "17:00"}}},
+		"days on once":  {Windows: []config.ScheduleWindow{{From: "2024-06-03 10:00", Days: []string{"mon"}}}},
+		"bad weekday":   {Windows: []config.ScheduleWindow{{From: "09:00", Days: []string{"someday"}}}},
+		"bad time zone": {Timezone: "Mars/Olympus"},
+	}
+	for name, cfg := range tests {
+		if _, err := pipeline.NewSchedule(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
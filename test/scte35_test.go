@@ -0,0 +1,277 @@
+package test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+// Sample sections from the SCTE-35 specification
+const (
+	spliceInsertHex = "fc302f000000000000fffff014054800008f7feffe7369c02efe0052ccf500000000000a0008435545490000013562dba30a"
+	timeSignalHex   = "fc3034000000000000fffff00506fe72bd0050001e021c435545494800008e7fcf0001a599b00808000000002ca0a18a3402009ac9d17e"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Invalid hex: %v", err)
+	}
+	return data
+}
+
+func TestParseSpliceInsert(t *testing.T) {
+	section, err := pipeline.ParseSpliceInfoSection(mustHex(t, spliceInsertHex))
+	if err != nil {
+		t.Fatalf("Failed to parse section: %v", err)
+	}
+
+	insert := section.SpliceInsert
+	if section.CommandType != pipeline.SpliceCommandInsert || insert == nil {
+		t.Fatalf("Expected splice_insert, got %+v", section)
+	}
+	if insert.EventID != 0x4800008F || !insert.OutOfNetwork || insert.Immediate || !insert.AutoReturn {
+		t.Errorf("Unexpected splice_insert %+v", insert)
+	}
+
+	cue, ok := section.Cue()
+	if !ok || cue.Type != pipeline.CueOut || !cue.HasPTS || cue.PTS != 0x07369C02E {
+		t.Errorf("Unexpected cue %+v", cue)
+	}
+	if cue.Duration.Round(time.Millisecond) != 60294*time.Millisecond {
+		t.Errorf("Expected 60.294s break, got %s", cue.Duration)
+	}
+}
+
+func TestParseTimeSignal(t *testing.T) {
+	section, err := pipeline.ParseSpliceInfoSection(mustHex(t, timeSignalHex))
+	if err != nil {
+		t.Fatalf("Failed to parse section: %v", err)
+	}
+
+	if len(section.Segmentations) != 1 || section.Segmentations[0].TypeID != 0x34 {
+		t.Fatalf("Expected provider placement opportunity descriptor, got %+v", section.Segmentations)
+	}
+
+	cue, ok := section.Cue()
+	if !ok || cue.Type != pipeline.CueOut || cue.EventID != 0x4800008E || cue.PTS != 0x072BD0050 {
+		t.Errorf("Unexpected cue %+v", cue)
+	}
+	if cue.Duration != 307*time.Second {
+		t.Errorf("Expected 307s break, got %s", cue.Duration)
+	}
+}
+
+func TestParseSpliceInfoSectionErrors(t *testing.T) {
+	corrupted := mustHex(t, spliceInsertHex)
+	corrupted[20] ^= 0xFF
+
+	testCases := map[string][]byte{
+		"Wrong table":    {0x00, 0x30, 0x00},
+		"Truncated":      mustHex(t, spliceInsertHex)[:20],
+		"CRC mismatch":   corrupted,
+		"Too short":      {0xFC},
+		"Length too big": mustHex(t, "fc30ff00"),
+	}
+
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := pipeline.ParseSpliceInfoSection(data); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestSegmentCues(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXTINF:6,
+seg10.ts
+#EXT-X-CUE-OUT:DURATION=30
+#EXTINF:6,
+seg11.ts
+#EXT-X-CUE-OUT-CONT:ElapsedTime=6,Duration=30
+#EXTINF:6,
+seg12.ts
+#EXT-X-CUE-IN
+#EXTINF:6,
+seg13.ts
+#EXT-X-DATERANGE:ID="splice-1",START-DATE="2024-05-01T12:00:00Z",PLANNED-DURATION=60,SCTE35-OUT=0x` + timeSignalHex + `
+#EXT-X-CUE-OUT:60
+#EXTINF:6,
+seg14.ts
+#EXT-X-DATERANGE:ID="splice-2",START-DATE="2024-05-01T12:01:00Z",SCTE35-IN=0xFC00
+#EXTINF:6,
+seg15.ts
+`
+	playlist, err := pipeline.ParseHLSMediaPlaylistFrom(strings.NewReader(content), "http://example.com/index.m3u8")
+	if err != nil {
+		t.Fatalf("Failed to parse playlist: %v", err)
+	}
+
+	var cues []pipeline.CueEvent
+	for _, segment := range playlist.Segments {
+		segmentCues, err := segment.Cues()
+		if err != nil && segment.SequenceNumber != 15 {
+			t.Errorf("Unexpected error for segment %d: %v", segment.SequenceNumber, err)
+		}
+		cues = append(cues, segmentCues...)
+	}
+
+	if len(cues) != 4 {
+		t.Fatalf("Expected 4 cues, got %v", cues)
+	}
+	if cues[0].Type != pipeline.CueOut || cues[0].SequenceNumber != 11 || cues[0].Duration != 30*time.Second {
+		t.Errorf("Unexpected CUE-OUT %v", cues[0])
+	}
+	if cues[1].Type != pipeline.CueIn || cues[1].SequenceNumber != 13 {
+		t.Errorf("Unexpected CUE-IN %v", cues[1])
+	}
+	// The daterange wins over the CUE-OUT tag next to it
+	if cues[2].Section == nil || cues[2].EventID != 0x4800008E || cues[2].Duration != 307*time.Second {
+		t.Errorf("Expected cue decoded from SCTE35-OUT, got %v", cues[2])
+	}
+	// An undecodable SCTE35-IN still ends the break
+	if cues[3].Type != pipeline.CueIn || cues[3].Section != nil || cues[3].Source != pipeline.CueSourcePlaylist {
+		t.Errorf("Expected fallback CUE-IN, got %v", cues[3])
+	}
+}
+
+func TestSegmentCuesInvalidMarkers(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-CUE-OUT:DURATION=soon
+#EXTINF:6,
+seg10.ts
+#EXT-X-DATERANGE:ID=unquoted
+#EXT-X-CUE-IN
+#EXTINF:6,
+seg11.ts
+#EXTINF:6,
+seg12.ts
+`
+	playlist, err := pipeline.ParseHLSMediaPlaylistFrom(strings.NewReader(content), "http://example.com/index.m3u8")
+	if err != nil {
+		t.Fatalf("Expected bad ad markers to leave the playlist readable, got %v", err)
+	}
+	if len(playlist.Segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %d", len(playlist.Segments))
+	}
+
+	cues, err := playlist.Segments[0].Cues()
+	if len(cues) != 0 || err == nil || !strings.Contains(err.Error(), "line 4: #EXT-X-CUE-OUT") {
+		t.Errorf("Expected the bad CUE-OUT reported without a cue, got %v, %v", cues, err)
+	}
+	cues, err = playlist.Segments[1].Cues()
+	if len(cues) != 1 || cues[0].Type != pipeline.CueIn || err == nil || !strings.Contains(err.Error(), "line 7: #EXT-X-DATERANGE") {
+		t.Errorf("Expected the CUE-IN kept and the bad daterange reported, got %v, %v", cues, err)
+	}
+	if cues, err := playlist.Segments[2].Cues(); len(cues) != 0 || err != nil {
+		t.Errorf("Expected no cues, got %v, %v", cues, err)
+	}
+}
+
+func TestPlaylistInspectorCues(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	inspector := pipeline.NewPlaylistInspector("http://example.com/index.m3u8", logger)
+
+	window := func(first int, markers map[int]string) *pipeline.HLSMediaPlaylist {
+		var b strings.Builder
+		fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+		for sequence := first; sequence < first+4; sequence++ {
+			if marker, ok := markers[sequence]; ok {
+				b.WriteString(marker + "\n")
+			}
+			fmt.Fprintf(&b, "#EXTINF:6,\nseg%d.ts\n", sequence)
+		}
+		playlist, err := pipeline.ParseHLSMediaPlaylistFrom(strings.NewReader(b.String()), "http://example.com/index.m3u8")
+		if err != nil {
+			t.Fatalf("Failed to parse playlist: %v", err)
+		}
+		return playlist
+	}
+	start := time.Now()
+
+	// Markers of the window at startup are playing or past already
+	inspector.Inspect(window(10, map[int]string{11: "#EXT-X-CUE-OUT:30"}), start)
+	if cues := inspector.TakeCues(); len(cues) != 0 {
+		t.Errorf("Expected no cues from the first window, got %v", cues)
+	}
+
+	// A marker on an added segment is cued with its distance from the end of the playlist
+	inspector.Inspect(window(12, map[int]string{14: "#EXT-X-CUE-IN", 15: "#EXT-X-CUE-OUT:30"}), start.Add(12*time.Second))
+	cues := inspector.TakeCues()
+	if len(cues) != 2 {
+		t.Fatalf("Expected 2 cues, got %v", cues)
+	}
+	if cues[0].Type != pipeline.CueIn || cues[0].SequenceNumber != 14 || cues[0].EdgeOffset != 12*time.Second {
+		t.Errorf("Unexpected CUE-IN %+v", cues[0])
+	}
+	if cues[1].Type != pipeline.CueOut || cues[1].SequenceNumber != 15 || cues[1].EdgeOffset != 6*time.Second {
+		t.Errorf("Unexpected CUE-OUT %+v", cues[1])
+	}
+
+	// After a reset the new window is skipped like the first one
+	inspector.Inspect(window(0, map[int]string{2: "#EXT-X-CUE-OUT:30"}), start.Add(18*time.Second))
+	if cues := inspector.TakeCues(); len(cues) != 0 {
+		t.Errorf("Expected no cues after a sequence reset, got %v", cues)
+	}
+	inspector.Inspect(window(1, map[int]string{4: "#EXT-X-CUE-IN"}), start.Add(24*time.Second))
+	if cues := inspector.TakeCues(); len(cues) != 1 || cues[0].SequenceNumber != 4 {
+		t.Errorf("Expected the CUE-IN of segment 4, got %v", cues)
+	}
+}
+
+func TestCueRepeats(t *testing.T) {
+	section, err := pipeline.ParseSpliceInfoSection(mustHex(t, spliceInsertHex))
+	if err != nil {
+		t.Fatalf("Failed to parse section: %v", err)
+	}
+	streamCue, _ := section.Cue()
+	streamCue.Source = pipeline.CueSourceStream
+	now := time.Now()
+	streamCue.Timestamp = now
+
+	var repeats pipeline.CueRepeats
+	if repeats.Repeated(streamCue) {
+		t.Fatal("Expected the first cue to pass")
+	}
+
+	// The same event in the playlist, from a DATERANGE with the section
+	playlistCue := streamCue
+	playlistCue.Source = pipeline.CueSourcePlaylist
+	playlistCue.Timestamp = now.Add(10 * time.Second)
+	if !repeats.Repeated(playlistCue) {
+		t.Error("Expected the playlist cue of the same event to be dropped")
+	}
+
+	// A CUE-OUT tag has no event ID, it matches the stream cue of the same type
+	tagCue := pipeline.CueEvent{Type: pipeline.CueOut, Source: pipeline.CueSourcePlaylist, EventID: 15, Timestamp: now.Add(20 * time.Second)}
+	if repeats.Repeated(streamCue) || !repeats.Repeated(tagCue) {
+		t.Error("Expected the CUE-OUT tag to repeat the stream cue")
+	}
+
+	// Cues of another type, the same source or long after don't match
+	streamIn := streamCue
+	streamIn.Type = pipeline.CueIn
+	streamIn.Timestamp = now.Add(30 * time.Second)
+	if repeats.Repeated(streamIn) {
+		t.Error("Expected a cue of another type to pass")
+	}
+	tagCue.Timestamp = now.Add(3 * time.Minute)
+	if repeats.Repeated(tagCue) {
+		t.Error("Expected a cue after the repeat window to pass")
+	}
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestParseSubtitlesSRT(t *testing.T) {
+	data := "1\r\n00:00:01,000 --> 00:00:03,500\r\nHello <i>world</i>\r\n\r\n" +
+		"2\r\n00:01:02,250 --> 00:01:04,000\r\nFish &amp; chips\r\nsecond line\r\n"
+
+	cues, err := pipeline.ParseSubtitles(data)
+	if err != nil {
+		t.Fatalf("Failed to parse SRT: %v", err)
+	}
+	expected := []pipeline.SubtitleCue{
+		{Start: time.Second, End: 3500 * time.Millisecond, Text: "Hello world"},
+		{Start: 62250 * time.Millisecond, End: 64 * time.Second, Text: "Fish & chips\nsecond line"},
+	}
+	if len(cues) != len(expected) {
+		t.Fatalf("Expected %d cues, got %+v", len(expected), cues)
+	}
+	for i := range expected {
+		if cues[i] != expected[i] {
+			t.Errorf("Cue %d: expected %+v, got %+v", i+1, expected[i], cues[i])
+		}
+	}
+}
+
+func TestParseSubtitlesWebVTT(t *testing.T) {
+	data := `WEBVTT - Live captions
+X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000
+
+NOTE Checked by the
+subtitle desk
+
+STYLE
+::cue { color: yellow }
+
+intro
+00:05.000 --> 00:07.000 align:start line:10%
+<v Anna>Good evening</v>
+
+01:00:00.000 --> 01:00:02.000
+<c.yellow>Breaking</c> news
+`
+	cues, err := pipeline.ParseSubtitles(data)
+	if err != nil {
+		t.Fatalf("Failed to parse WebVTT: %v", err)
+	}
+	if len(cues) != 2 {
+		t.Fatalf("Expected 2 cues, got %+v", cues)
+	}
+	if cues[0] != (pipeline.SubtitleCue{Start: 5 * time.Second, End: 7 * time.Second, Text: "Good evening"}) {
+		t.Errorf("Expected the first cue without settings and voice tag, got %+v", cues[0])
+	}
+	if cues[1].Start != time.Hour || cues[1].Text != "Breaking news" {
+		t.Errorf("Expected the second cue after an hour, got %+v", cues[1])
+	}
+
+	if _, err := pipeline.ParseSubtitles("WEBVTT\n\n00:01.000 --> soon\nText\n"); err == nil {
+		t.Error("Expected an error for an invalid cue time")
+	}
+}
+
+func TestLoadSubtitles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "captions.srt")
+	if err := os.WriteFile(path, []byte("1\n00:00:00,500 --> 00:00:01,000\nHi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cues, err := pipeline.LoadSubtitles(path)
+	if err != nil || len(cues) != 1 || cues[0].Text != "Hi" {
+		t.Errorf("Expected one cue, got %+v, %v", cues, err)
+	}
+	if _, err := pipeline.LoadSubtitles(filepath.Join(t.TempDir(), "missing.vtt")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestSubtitleText(t *testing.T) {
+	tests := map[string]string{
+		"plain":                                 "plain",
+		"<i>italic</i> and <b>bold</b>":         "italic and bold",
+		"  padded  \n\n second ":                "padded\nsecond",
+		"<span foreground=\"red\">pango</span>": "pango",
+		"a &lt;tag&gt; &amp; more":              "a <tag> & more",
+	}
+	for input, expected := range tests {
+		if text := pipeline.SubtitleText(input); text != expected {
+			t.Errorf("%q: expected %q, got %q", input, expected, text)
+		}
+	}
+}
+
+func TestSubtitleTrack(t *testing.T) {
+	track := pipeline.NewSubtitleTrack([]pipeline.SubtitleCue{
+		{Start: 4 * time.Second, End: 6 * time.Second, Text: "second"},
+		{Start: time.Second, End: 3 * time.Second, Text: "first"},
+	})
+	// HLS repeats a cue spanning segments in each of them
+	track.Add(pipeline.SubtitleCue{Start: 4 * time.Second, End: 6 * time.Second, Text: "second"})
+	track.Add(pipeline.SubtitleCue{Start: 5 * time.Second, End: 8 * time.Second, Text: "overlap"})
+	if track.Len() != 3 {
+		t.Errorf("Expected the repeated cue once, got %d cues", track.Len())
+	}
+
+	tests := map[time.Duration]string{
+		0:                       "",
+		time.Second:             "first",
+		3 * time.Second:         "",
+		4500 * time.Millisecond: "second",
+		5 * time.Second:         "second\noverlap",
+		7 * time.Second:         "overlap",
+		8 * time.Second:         "",
+	}
+	for at, expected := range tests {
+		if text := track.TextAt(at); text != expected {
+			t.Errorf("At %v: expected %q, got %q", at, expected, text)
+		}
+	}
+
+	track.Prune(4 * time.Second)
+	if track.Len() != 2 || track.TextAt(time.Second) != "" {
+		t.Errorf("Expected the first cue pruned, got %d cues", track.Len())
+	}
+}
+
+func TestConfigSubtitles(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "subtitles.yaml")
+	data := `
+overlay:
+  layers:
+    - name: captions
+      type: "subtitles"
+      subtitles:
+        offset_ms: -500
+    - name: open-captions
+      type: "subtitles"
+      subtitles:
+        source: "file"
+        path: "/path/to/captions.vtt"
+`
+	if err := os.WriteFile(tmpFile, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.Load(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	layers := cfg.Overlay.LayerList()
+	if len(layers) != 2 {
+		t.Fatalf("Expected 2 layers, got %d", len(layers))
+	}
+	if s := layers[0].Subtitles; s.Source != "rendition" || s.OffsetMs != -500 {
+		t.Errorf("Expected the rendition source by default with cues 500ms earlier, got %+v", s)
+	}
+	if s := layers[1].Subtitles; s.Source != "file" || s.Path != "/path/to/captions.vtt" {
+		t.Errorf("Expected file cues, got %+v", s)
+	}
+	if layers[1].Text.FontSize != 24 {
+		t.Errorf("Expected subtitles drawn with the default text style, got %+v", layers[1].Text)
+	}
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestTextTemplateRender(t *testing.T) {
+	started := time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+	ctx := pipeline.TemplateContext{
+		Now:     time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC),
+		Started: started,
+		PTS:     90 * time.Second,
+		Channel: "news",
+	}
+
+	tests := []struct {
+		template string
+		timezone string
+		expected string
+	}{
+		{"Live Stream", "", "Live Stream"},
+		{"{{.timestamp}} - Channel 1", "UTC", "2024-03-01 12:30:45 - Channel 1"},
+		{"{{.date}} {{.time}} {{.unix}}", "UTC", "2024-03-01 12:30:45 1709296245"},
+		{"{{.time}}", "Europe/Berlin", "13:30:45"},
+		{`{{format "15:04" now}}`, "America/New_York", "07:30"},
+		{`{{format "15:04" (in "Asia/Tokyo" now)}}`, "UTC", "21:30"},
+		{"{{channel}} up {{uptime}} at {{pts}}", "UTC", "news up 1h30m45s at 1m30s"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := pipeline.NewTextTemplate(test.template, test.timezone)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", test.template, err)
+		}
+		text, err := tmpl.Render(ctx)
+		if err != nil {
+			t.Fatalf("Failed to render %q: %v", test.template, err)
+		}
+		if text != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.template, test.expected, text)
+		}
+	}
+}
+
+func TestTextTemplateErrors(t *testing.T) {
+	if _, err := pipeline.NewTextTemplate("{{.timestamp", ""); err == nil {
+		t.Error("Expected a parse error for an unclosed action")
+	}
+	if _, err := pipeline.NewTextTemplate("{{.time}}", "Mars/Olympus"); err == nil {
+		t.Error("Expected an error for an unknown time zone")
+	}
+
+	tmpl, err := pipeline.NewTextTemplate("{{.missing}}", "")
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	if _, err := tmpl.Render(pipeline.TemplateContext{Now: time.Now()}); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+}
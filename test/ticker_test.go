@@ -0,0 +1,132 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestTickerText(t *testing.T) {
+	text := pipeline.TickerText([]string{"Markets up", "", "  Rain\nlater  "}, " • ")
+	if text != "Markets up • Rain later" {
+		t.Errorf("Expected single-line items joined by the separator, got %q", text)
+	}
+}
+
+func TestTickerMarkup(t *testing.T) {
+	items, err := pipeline.ParseTickerFeed([]byte(`["Fish & chips", "<b>Sale</b>"]`))
+	if err != nil {
+		t.Fatalf("Failed to parse feed: %v", err)
+	}
+	text := pipeline.TickerText(items, " | ")
+
+	// Items are plain text, with and without a bar behind them
+	for _, background := range []string{"", "rgba(0,0,0,0.7)"} {
+		style, err := pipeline.ParseTextStyle(config.TextOverlay{Background: background})
+		if err != nil {
+			t.Fatalf("Failed to parse style: %v", err)
+		}
+		markup := style.Markup(text)
+		if !strings.Contains(markup, "Fish &amp; chips | &lt;b&gt;Sale&lt;/b&gt;") {
+			t.Errorf("Background %q: expected the items escaped, got %q", background, markup)
+		}
+	}
+}
+
+func TestParseTickerFeed(t *testing.T) {
+	tests := map[string]string{
+		"strings": `["One", "Two"]`,
+		"objects": `[{"text": "One"}, {"title": "Two"}]`,
+		"wrapped": `{"updated": "now", "items": ["One", {"text": "Two"}]}`,
+	}
+	for name, feed := range tests {
+		items, err := pipeline.ParseTickerFeed([]byte(feed))
+		if err != nil {
+			t.Errorf("%s: failed to parse feed: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(items, []string{"One", "Two"}) {
+			t.Errorf("%s: expected [One Two], got %v", name, items)
+		}
+	}
+
+	for _, feed := range []string{`{"entries": []}`, `"One"`, `[1, 2]`, `not json`} {
+		if _, err := pipeline.ParseTickerFeed([]byte(feed)); err == nil {
+			t.Errorf("Expected an error for feed %s", feed)
+		}
+	}
+}
+
+func TestTickerSources(t *testing.T) {
+	ctx := context.Background()
+
+	source, err := pipeline.NewTickerSource(config.TickerOverlay{Items: []string{"Static"}})
+	if err != nil {
+		t.Fatalf("Failed to create static source: %v", err)
+	}
+	if items, err := source.Items(ctx); err != nil || !reflect.DeepEqual(items, []string{"Static"}) {
+		t.Errorf("Expected the configured items, got %v, %v", items, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ticker.txt")
+	if err := os.WriteFile(path, []byte("# Headlines\nFirst\n\n  Second  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source, err = pipeline.NewTickerSource(config.TickerOverlay{Source: "file", Path: path})
+	if err != nil {
+		t.Fatalf("Failed to create file source: %v", err)
+	}
+	if items, err := source.Items(ctx); err != nil || !reflect.DeepEqual(items, []string{"First", "Second"}) {
+		t.Errorf("Expected the file lines, got %v, %v", items, err)
+	}
+
+	feed := `{"items": ["Live"]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(feed))
+	}))
+	defer server.Close()
+
+	source, err = pipeline.NewTickerSource(config.TickerOverlay{Source: "http", URL: server.URL + "/feed.json"})
+	if err != nil {
+		t.Fatalf("Failed to create http source: %v", err)
+	}
+	if items, err := source.Items(ctx); err != nil || !reflect.DeepEqual(items, []string{"Live"}) {
+		t.Errorf("Expected the feed items, got %v, %v", items, err)
+	}
+
+	source, _ = pipeline.NewTickerSource(config.TickerOverlay{Source: "http", URL: server.URL + "/missing.json"})
+	if _, err := source.Items(ctx); err == nil {
+		t.Error("Expected an error for a missing feed")
+	}
+}
+
+func TestTickerSourceInvalid(t *testing.T) {
+	tests := map[string]config.TickerOverlay{
+		"static without items": {Source: "static"},
+		"file without path":    {Source: "file"},
+		"http without url":     {Source: "http"},
+	}
+	for name, ticker := range tests {
+		if _, err := pipeline.NewTickerSource(ticker); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	_, err := pipeline.NewTickerSource(config.TickerOverlay{Source: "rss"})
+	if err == nil || !strings.Contains(err.Error(), "file, http, static") {
+		t.Errorf("Expected an unknown source error listing the sources, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"video-graphic-overlay-gstreamer/internal/color"
+	"video-graphic-overlay-gstreamer/internal/config"
+	"video-graphic-overlay-gstreamer/internal/pipeline"
+)
+
+func TestTransitionProgress(t *testing.T) {
+	tests := []struct {
+		easing   string
+		elapsed  time.Duration
+		expected float64
+	}{
+		{"linear", 0, 0},
+		{"linear", 250 * time.Millisecond, 0.25},
+		{"linear", time.Second, 1},
+		{"linear", 2 * time.Second, 1},
+		{"ease-in", 500 * time.Millisecond, 0.125},
+		{"ease-out", 500 * time.Millisecond, 0.875},
+		{"ease-in-out", 500 * time.Millisecond, 0.5},
+		{"", 250 * time.Millisecond, 0.0625}, // ease-in-out
+	}
+
+	for _, test := range tests {
+		transition, err := pipeline.NewTransition(config.TransitionConfig{Type: "fade", DurationMs: 1000, Easing: test.easing})
+		if err != nil {
+			t.Fatalf("%s: failed to parse transition: %v", test.easing, err)
+		}
+		if progress := transition.Progress(test.elapsed); math.Abs(progress-test.expected) > 1e-9 {
+			t.Errorf("%s after %v: expected %f, got %f", test.easing, test.elapsed, test.expected, progress)
+		}
+	}
+}
+
+func TestTransitionDefaults(t *testing.T) {
+	transition, err := pipeline.NewTransition(config.TransitionConfig{})
+	if err != nil || transition != nil {
+		t.Fatalf("Expected no transition without a type, got %v, %v", transition, err)
+	}
+
+	transition, err = pipeline.NewTransition(config.TransitionConfig{Type: "slide"})
+	if err != nil {
+		t.Fatalf("Failed to parse transition: %v", err)
+	}
+	if transition.Duration != 500*time.Millisecond || transition.Edge != "left" {
+		t.Errorf("Expected 500ms from the left, got %v from the %s", transition.Duration, transition.Edge)
+	}
+}
+
+func TestTransitionInvalid(t *testing.T) {
+	tests := map[string]config.TransitionConfig{
+		"type":     {Type: "spin"},
+		"easing":   {Type: "fade", Easing: "bounce"},
+		"edge":     {Type: "wipe", Edge: "middle"},
+		"duration": {Type: "fade", DurationMs: -1},
+	}
+	for name, cfg := range tests {
+		if _, err := pipeline.NewTransition(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRevealMarkup(t *testing.T) {
+	style := pipeline.TextStyle{Color: color.Color{R: 255, G: 255, B: 255, A: 255}}
+	hidden := "<span fgalpha='1' bgalpha='1'>"
+
+	tests := []struct {
+		edge     string
+		reveal   float64
+		expected string
+	}{
+		{"left", 1, "a&amp;cd\nef"},
+		{"left", 0.5, "a&amp;" + hidden + "cd</span>\ne" + hidden + "f</span>"},
+		{"right", 0.5, hidden + "a&amp;</span>cd\n" + hidden + "e</span>f"},
+		{"top", 0.5, "a&amp;cd\n" + hidden + "ef</span>"},
+		{"bottom", 0.5, hidden + "a&amp;cd</span>\nef"},
+		{"left", 0, hidden + "a&amp;cd</span>\n" + hidden + "ef</span>"},
+	}
+	for _, test := range tests {
+		if markup := style.RevealMarkup("a&cd\nef", test.reveal, test.edge); markup != test.expected {
+			t.Errorf("%s %.1f: expected %q, got %q", test.edge, test.reveal, test.expected, markup)
+		}
+	}
+
+	style.Background = color.Color{A: 255}
+	markup := style.RevealMarkup("ab", 0.5, "left")
+	if !strings.HasPrefix(markup, "<span background='#000000' bgalpha='100%'> a") ||
+		!strings.HasSuffix(markup, hidden+"b</span>"+hidden+" </span></span>") {
+		t.Errorf("Expected the box to be covered with the text, got %q", markup)
+	}
+}
+
+func TestTextStyleFaded(t *testing.T) {
+	style := pipeline.TextStyle{Color: color.Color{R: 255, A: 200}}
+	faded := style.Faded(0.5)
+	if faded.Color.A != 100 || faded.Color.R != 255 {
+		t.Errorf("Expected half the text alpha, got %v", faded.Color)
+	}
+	if faded.Outline == nil || faded.Outline.A != 128 {
+		t.Errorf("Expected the default black outline faded, got %v", faded.Outline)
+	}
+	if !faded.Background.IsTransparent() {
+		t.Errorf("Expected no background box, got %v", faded.Background)
+	}
+	if style.Faded(1).Outline != nil {
+		t.Error("Expected an unfaded style to keep the default outline")
+	}
+}
+
+func TestRevealRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 40)
+	tests := map[string]image.Rectangle{
+		"left":   image.Rect(0, 0, 25, 40),
+		"right":  image.Rect(75, 0, 100, 40),
+		"top":    image.Rect(0, 0, 100, 10),
+		"bottom": image.Rect(0, 30, 100, 40),
+	}
+	for edge, expected := range tests {
+		if r := pipeline.RevealRect(bounds, 0.25, edge); r != expected {
+			t.Errorf("%s: expected %v, got %v", edge, expected, r)
+		}
+	}
+}